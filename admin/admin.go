@@ -0,0 +1,719 @@
+// Package admin is irclogsme-admin: looking after networks, channels and the command queue, and
+// running database maintenance, without writing documents by hand. Everything goes through the
+// logger's Database, so it works on whatever the logger does.
+package admin
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/lukegb/irclogsme"
+	"github.com/lukegb/irclogsme/archive"
+	"github.com/lukegb/irclogsme/export"
+	"github.com/lukegb/irclogsme/importer"
+	"github.com/lukegb/irclogsme/logger"
+	"io"
+	"labix.org/v2/mgo/bson"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+var errUsage = errors.New("bad usage")
+
+type command struct {
+	usage string
+	run   func(a *admin, args []string) error
+}
+
+// commands, by name. "network" and "channel" have subcommands of their own.
+var commands = map[string]command{
+	"networks": {"networks", (*admin).listNetworks},
+	"network":  {"network show|add|edit|enable|disable <network> [flags]", (*admin).network},
+	"channels": {"channels <network>", (*admin).listChannels},
+	"channel":  {"channel add|edit|enable|disable|remove <network> <channel> [flags]", (*admin).channel},
+	"join":     {"join <network> <channel> [key]", (*admin).join},
+	"part":     {"part <network> <channel>", (*admin).part},
+	"tell":     {"tell <network> <nick or channel> <message>", (*admin).tell},
+	"pending":  {"pending", (*admin).pending},
+	"migrate":  {"migrate [-to N] [-dry_run]", (*admin).migrate},
+	"reindex":  {"reindex", (*admin).reindex},
+	"import":   {"import -format irssi|weechat|znc|hexchat|eggdrop [flags] <network> <channel> <file>...", (*admin).importLogs},
+	"export":   {"export [-format text|jsonl|csv|html] [-archive tar.gz|zip] [-from DATE] [-to DATE] [-o FILE] <network> <channel>", (*admin).exportLogs},
+}
+
+var commandOrder = []string{"networks", "network", "channels", "channel", "join", "part", "tell", "pending", "migrate", "reindex", "import", "export"}
+
+type admin struct {
+	db         logger.Database
+	archiveDir string
+	out        io.Writer
+}
+
+func (a *admin) run(args []string) error {
+	if len(args) == 0 {
+		return errUsage
+	}
+	cmd, ok := commands[args[0]]
+	if !ok {
+		return fmt.Errorf("no command %q", args[0])
+	}
+	return cmd.run(a, args[1:])
+}
+
+func (a *admin) admin() (logger.Admin, error) {
+	return logger.AdminFor(a.db)
+}
+
+// findNetwork looks a network up by name
+func (a *admin) findNetwork(name string) (irclogsme.NetworkConfig, error) {
+	adm, err := a.admin()
+	if err != nil {
+		return irclogsme.NetworkConfig{}, err
+	}
+	nets, err := adm.Networks()
+	if err != nil {
+		return irclogsme.NetworkConfig{}, err
+	}
+	for _, net := range nets {
+		if net.Name == name {
+			return net, nil
+		}
+	}
+	return irclogsme.NetworkConfig{}, fmt.Errorf("no network %q", name)
+}
+
+// runningNetwork is findNetwork for commands to the logger, which won't be running a disabled one
+func (a *admin) runningNetwork(name string) (irclogsme.NetworkConfig, error) {
+	net, err := a.findNetwork(name)
+	if err == nil && !net.Enabled {
+		err = fmt.Errorf("network %s is disabled, so the logger isn't connected to it - network enable %s first", net.Name, net.Name)
+	}
+	return net, err
+}
+
+// checkNetwork stops us saving a network the logger would choke on
+func (a *admin) checkNetwork(net irclogsme.NetworkConfig) error {
+	if net.Name == "" {
+		return errors.New("networks need a name")
+	}
+	if net.Nick == "" {
+		return errors.New("networks need a nick")
+	}
+	if len(net.IrcServers) == 0 {
+		return errors.New("networks need at least one server")
+	}
+	if net.CaseMapping != "" && !irclogsme.ValidCaseMapping(net.CaseMapping) {
+		return fmt.Errorf("unknown casemapping %q", net.CaseMapping)
+	}
+	if net.Retention.Days < 0 {
+		return errors.New("retention days can't be negative")
+	}
+	if err := net.CheckTimezones(); err != nil {
+		return err
+	}
+
+	adm, err := a.admin()
+	if err != nil {
+		return err
+	}
+	nets, err := adm.Networks()
+	if err != nil {
+		return err
+	}
+	for _, other := range nets {
+		if other.Name == net.Name && other.Id != net.Id {
+			return fmt.Errorf("there's already a network called %q", net.Name)
+		}
+	}
+	return nil
+}
+
+func (a *admin) saveNetwork(net irclogsme.NetworkConfig) (irclogsme.NetworkConfig, error) {
+	if err := a.checkNetwork(net); err != nil {
+		return net, err
+	}
+	adm, err := a.admin()
+	if err != nil {
+		return net, err
+	}
+	return adm.SaveNetwork(net)
+}
+
+func (a *admin) enqueue(cmd irclogsme.CommandMessage) error {
+	adm, err := a.admin()
+	if err != nil {
+		return err
+	}
+	cmd, err = adm.EnqueueCommand(cmd)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(a.out, "queued %s\n", describeCommand(cmd))
+	return nil
+}
+
+func describeCommand(cmd irclogsme.CommandMessage) string {
+	switch cmd.Type {
+	case irclogsme.CMT_START_LOGGING:
+		return "join " + cmd.Channel
+	case irclogsme.CMT_STOP_LOGGING:
+		return "part " + cmd.Channel
+	case irclogsme.CMT_TELL:
+		return fmt.Sprintf("tell %s %q", cmd.Target, cmd.Message)
+	case irclogsme.CMT_CONNECT:
+		return "connect"
+	case irclogsme.CMT_DISCONNECT:
+		return "disconnect"
+	}
+	return fmt.Sprintf("[unknown %d]", cmd.Type)
+}
+
+func (a *admin) listNetworks(args []string) error {
+	if len(args) != 0 {
+		return errUsage
+	}
+	adm, err := a.admin()
+	if err != nil {
+		return err
+	}
+	nets, err := adm.Networks()
+	if err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(a.out, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tENABLED\tNICK\tCHANNELS\tSERVERS")
+	for _, net := range nets {
+		fmt.Fprintf(w, "%s\t%v\t%s\t%d\t%s\n", net.Name, net.Enabled, net.Nick, len(net.Channels), strings.Join(net.IrcServers, ","))
+	}
+	return w.Flush()
+}
+
+// listFlag is a flag that can be given more than once
+type listFlag []string
+
+func (l *listFlag) String() string { return strings.Join(*l, ", ") }
+func (l *listFlag) Set(v string) error {
+	*l = append(*l, v)
+	return nil
+}
+
+func splitList(v string) []string {
+	res := make([]string, 0)
+	for _, item := range strings.Split(v, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			res = append(res, item)
+		}
+	}
+	return res
+}
+
+// networkFlags are the settings add and edit take. Only the ones given change anything.
+func networkFlags(fs *flag.FlagSet, net *irclogsme.NetworkConfig) func() {
+	var (
+		name             = fs.String("name", net.Name, "rename the network")
+		friendly         = fs.String("friendly", net.FriendlyName, "name to show people")
+		nick             = fs.String("nick", net.Nick, "nick to log as")
+		user             = fs.String("user", net.User, "username to log as")
+		servers          = fs.String("servers", strings.Join(net.IrcServers, ","), "comma separated host:port list, tried in order")
+		auth             = new(listFlag)
+		enabled          = fs.Bool("enabled", net.Enabled, "whether the logger connects")
+		caseMapping      = fs.String("case_mapping", net.CaseMapping, "CASEMAPPING until the network says otherwise")
+		chanTypes        = fs.String("chan_types", net.ChanTypes, "CHANTYPES until the network says otherwise")
+		archiveRaw       = fs.Bool("archive_raw", net.ArchiveRawLines, "keep raw lines so logs can be rebuilt")
+		retentionDays    = fs.Int("retention_days", net.Retention.Days, "days logs stay in the database - 0 is forever")
+		retentionArchive = fs.Bool("retention_archive", net.Retention.Archive, "archive expired days instead of deleting them")
+		timezone         = fs.String("timezone", net.Timezone, "IANA zone to split days in")
+	)
+	fs.Var(auth, "auth", "raw line to send on connecting - give it once per line, replaces the old ones")
+
+	return func() {
+		fs.Visit(func(f *flag.Flag) {
+			switch f.Name {
+			case "name":
+				net.Name = *name
+			case "friendly":
+				net.FriendlyName = *friendly
+			case "nick":
+				net.Nick = *nick
+			case "user":
+				net.User = *user
+			case "servers":
+				net.IrcServers = splitList(*servers)
+			case "auth":
+				net.AuthCommands = []string(*auth)
+			case "enabled":
+				net.Enabled = *enabled
+			case "case_mapping":
+				net.CaseMapping = *caseMapping
+			case "chan_types":
+				net.ChanTypes = *chanTypes
+			case "archive_raw":
+				net.ArchiveRawLines = *archiveRaw
+			case "retention_days":
+				net.Retention.Days = *retentionDays
+			case "retention_archive":
+				net.Retention.Archive = *retentionArchive
+			case "timezone":
+				net.Timezone = *timezone
+			}
+		})
+	}
+}
+
+func (a *admin) network(args []string) error {
+	if len(args) < 2 {
+		return errUsage
+	}
+	sub, name := args[0], args[1]
+
+	var net irclogsme.NetworkConfig
+	if sub == "add" {
+		if _, err := a.findNetwork(name); err == nil {
+			return fmt.Errorf("there's already a network called %q", name)
+		}
+		net = irclogsme.NetworkConfig{Name: name, FriendlyName: name, User: "irclogsme", Enabled: true, Channels: make(map[string]irclogsme.ChannelConfig)}
+	} else {
+		var err error
+		if net, err = a.findNetwork(name); err != nil {
+			return err
+		}
+	}
+
+	switch sub {
+	case "show":
+		out, err := json.MarshalIndent(net, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(a.out, "%s\n", out)
+		return nil
+	case "add", "edit":
+		fs := flag.NewFlagSet("network "+sub, flag.ContinueOnError)
+		apply := networkFlags(fs, &net)
+		if err := fs.Parse(args[2:]); err != nil {
+			return err
+		}
+		if fs.NArg() != 0 {
+			return errUsage
+		}
+		apply()
+	case "enable", "disable":
+		if len(args) != 2 {
+			return errUsage
+		}
+		net.Enabled = sub == "enable"
+	default:
+		return errUsage
+	}
+
+	net, err := a.saveNetwork(net)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(a.out, "saved network %s (%s) - restart the logger for it to notice\n", net.Name, net.Id.Hex())
+	return nil
+}
+
+func (a *admin) listChannels(args []string) error {
+	if len(args) != 1 {
+		return errUsage
+	}
+	net, err := a.findNetwork(args[0])
+	if err != nil {
+		return err
+	}
+	names := make([]string, 0, len(net.Channels))
+	for name := range net.Channels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	w := tabwriter.NewWriter(a.out, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "CHANNEL\tENABLED\tKEY\tTIMEZONE\tRETENTION")
+	for _, name := range names {
+		conf := net.Channels[name]
+		retention := "network's"
+		if conf.Retention != nil {
+			retention = describeRetention(*conf.Retention)
+		}
+		fmt.Fprintf(w, "%s\t%v\t%s\t%s\t%s\n", name, !conf.Disabled, conf.Key, net.TimezoneFor(name), retention)
+	}
+	return w.Flush()
+}
+
+func describeRetention(r irclogsme.RetentionPolicy) string {
+	if !r.Expires() {
+		return "forever"
+	}
+	if r.Archive {
+		return fmt.Sprintf("%d days, then archived", r.Days)
+	}
+	return fmt.Sprintf("%d days", r.Days)
+}
+
+func (a *admin) channel(args []string) error {
+	if len(args) < 3 {
+		return errUsage
+	}
+	sub, netName, channel := args[0], args[1], args[2]
+	net, err := a.findNetwork(netName)
+	if err != nil {
+		return err
+	}
+	if net.Channels == nil {
+		net.Channels = make(map[string]irclogsme.ChannelConfig)
+	}
+
+	name, found := net.FindChannel(channel)
+	if sub == "add" {
+		if found {
+			return fmt.Errorf("%s already has %s", net.Name, name)
+		}
+		if !irclogsme.IsChannelName(net.ChannelTypes(), channel) {
+			return fmt.Errorf("%q isn't a channel on %s", channel, net.Name)
+		}
+		name = channel
+	} else if !found {
+		return fmt.Errorf("%s has no channel %s", net.Name, channel)
+	}
+	conf := net.Channels[name]
+	if len(args) > 3 && sub != "add" && sub != "edit" {
+		return errUsage
+	}
+
+	var join, part bool
+	switch sub {
+	case "add", "edit":
+		fs := flag.NewFlagSet("channel "+sub, flag.ContinueOnError)
+		key := fs.String("key", conf.Key, "channel key")
+		timezone := fs.String("timezone", conf.Timezone, "IANA zone to split days in - empty for the network's")
+		retentionDays := fs.Int("retention_days", -1, "days logs stay in the database - 0 is forever, -1 follows the network")
+		retentionArchive := fs.Bool("retention_archive", false, "archive expired days instead of deleting them")
+		if err := fs.Parse(args[3:]); err != nil {
+			return err
+		}
+		if fs.NArg() != 0 {
+			return errUsage
+		}
+		set := make(map[string]bool)
+		fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+		if set["key"] {
+			conf.Key = *key
+		}
+		if set["timezone"] {
+			conf.Timezone = *timezone
+		}
+		if set["retention_days"] && *retentionDays < 0 {
+			conf.Retention = nil
+		} else if set["retention_days"] || set["retention_archive"] {
+			policy := irclogsme.RetentionPolicy{Days: *retentionDays, Archive: *retentionArchive}
+			if !set["retention_days"] {
+				if conf.Retention == nil {
+					return errors.New("-retention_archive needs -retention_days, the channel follows its network")
+				}
+				policy.Days = conf.Retention.Days
+			}
+			conf.Retention = &policy
+		}
+		join = sub == "add" && !conf.Disabled
+	case "enable":
+		conf.Disabled = false
+		join = true
+	case "disable":
+		conf.Disabled = true
+		part = true
+	case "remove":
+		part = !conf.Disabled
+	default:
+		return errUsage
+	}
+	if sub == "remove" {
+		delete(net.Channels, name)
+	} else {
+		net.Channels[name] = conf
+	}
+	if net, err = a.saveNetwork(net); err != nil {
+		return err
+	}
+	fmt.Fprintf(a.out, "saved %s on %s\n", name, net.Name)
+
+	// tell a running logger, so it doesn't need restarting
+	if !net.Enabled {
+		return nil
+	}
+	if join {
+		return a.enqueue(irclogsme.CommandMessage{NetworkId: net.Id, Type: irclogsme.CMT_START_LOGGING, Channel: name, Key: conf.Key})
+	}
+	if part {
+		return a.enqueue(irclogsme.CommandMessage{NetworkId: net.Id, Type: irclogsme.CMT_STOP_LOGGING, Channel: name})
+	}
+	return nil
+}
+
+func (a *admin) join(args []string) error {
+	if len(args) != 2 && len(args) != 3 {
+		return errUsage
+	}
+	net, err := a.runningNetwork(args[0])
+	if err != nil {
+		return err
+	}
+	cmd := irclogsme.CommandMessage{NetworkId: net.Id, Type: irclogsme.CMT_START_LOGGING, Channel: args[1]}
+	if len(args) == 3 {
+		cmd.Key = args[2]
+	}
+	return a.enqueue(cmd)
+}
+
+func (a *admin) part(args []string) error {
+	if len(args) != 2 {
+		return errUsage
+	}
+	net, err := a.runningNetwork(args[0])
+	if err != nil {
+		return err
+	}
+	return a.enqueue(irclogsme.CommandMessage{NetworkId: net.Id, Type: irclogsme.CMT_STOP_LOGGING, Channel: args[1]})
+}
+
+func (a *admin) tell(args []string) error {
+	if len(args) < 3 {
+		return errUsage
+	}
+	net, err := a.runningNetwork(args[0])
+	if err != nil {
+		return err
+	}
+	return a.enqueue(irclogsme.CommandMessage{NetworkId: net.Id, Type: irclogsme.CMT_TELL, Target: args[1], Message: strings.Join(args[2:], " ")})
+}
+
+func (a *admin) pending(args []string) error {
+	if len(args) != 0 {
+		return errUsage
+	}
+	cmds, err := a.db.FetchPendingCommands()
+	if err != nil {
+		return err
+	}
+	adm, err := a.admin()
+	if err != nil {
+		return err
+	}
+	nets, err := adm.Networks()
+	if err != nil {
+		return err
+	}
+	names := make(map[bson.ObjectId]string)
+	for _, net := range nets {
+		names[net.Id] = net.Name
+	}
+
+	w := tabwriter.NewWriter(a.out, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tNETWORK\tCOMMAND")
+	for _, cmd := range cmds {
+		network, ok := names[cmd.NetworkId]
+		if !ok {
+			network = "[unknown " + cmd.NetworkId.Hex() + "]"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\n", cmd.Id.Hex(), network, describeCommand(cmd))
+	}
+	return w.Flush()
+}
+
+func (a *admin) maintainer() (logger.Maintainer, error) {
+	m, ok := a.db.(logger.Maintainer)
+	if !ok {
+		return nil, errors.New("this database has no maintenance to run")
+	}
+	return m, nil
+}
+
+func (a *admin) migrate(args []string) error {
+	fs := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	target := fs.Int("to", 0, "stop after this migration - defaults to the latest")
+	dryRun := fs.Bool("dry_run", false, "report what would change without changing anything")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 0 {
+		return errUsage
+	}
+	m, err := a.maintainer()
+	if err != nil {
+		return err
+	}
+	return m.Migrate(*target, *dryRun)
+}
+
+func (a *admin) reindex(args []string) error {
+	if len(args) != 0 {
+		return errUsage
+	}
+	m, err := a.maintainer()
+	if err != nil {
+		return err
+	}
+	return m.Reindex()
+}
+
+func (a *admin) importLogs(args []string) error {
+	fs := flag.NewFlagSet("import", flag.ContinueOnError)
+	format := fs.String("format", "", "what wrote the logs: "+strings.Join(importer.FORMATS, ", "))
+	timezone := fs.String("tz", "", "IANA zone the logs' times are in - defaults to the channel's")
+	date := fs.String("date", "", "YYYY-MM-DD the logs start on, if they don't say and their file names don't either")
+	dryRun := fs.Bool("dry_run", false, "count what would be imported without importing it")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() < 3 || *format == "" {
+		return errUsage
+	}
+	net, err := a.findNetwork(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	channel, found := net.FindChannel(fs.Arg(1))
+	if !found {
+		return fmt.Errorf("%s has no channel %s - channel add it first", net.Name, fs.Arg(1))
+	}
+
+	opts := importer.Options{Format: *format, DryRun: *dryRun}
+	if *timezone != "" {
+		if opts.Location, err = irclogsme.LoadLocation(*timezone); err != nil {
+			return err
+		}
+	}
+	if *date != "" {
+		if opts.Date, err = time.Parse("2006-01-02", *date); err != nil {
+			return fmt.Errorf("bad -date: %s", err.Error())
+		}
+	}
+
+	var total importer.Result
+	for _, filename := range fs.Args()[2:] {
+		f, err := os.Open(filename)
+		if err != nil {
+			return err
+		}
+		opts.FileName = filename
+		res, err := importer.Import(a.db, net, channel, f, opts)
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("%s: %s", filename, err.Error())
+		}
+		fmt.Fprintf(a.out, "%s: %d lines, %d imported, %d already there, %d skipped\n", filename, res.Lines, res.Imported, res.Duplicates, res.Skipped)
+		total.Lines += res.Lines
+		total.Imported += res.Imported
+		total.Duplicates += res.Duplicates
+		total.Skipped += res.Skipped
+	}
+	if fs.NArg() > 3 {
+		fmt.Fprintf(a.out, "total: %d lines, %d imported, %d already there, %d skipped\n", total.Lines, total.Imported, total.Duplicates, total.Skipped)
+	}
+	if *dryRun {
+		fmt.Fprintln(a.out, "dry run - nothing was written")
+	}
+	return nil
+}
+
+// exportDays is every day of channel's logs, in the database or the archive, and how to read
+// one. The database's copy of a day wins, since that's the one still being written to.
+func (a *admin) exportDays(net irclogsme.NetworkConfig, channel string) ([]string, export.DayFunc, error) {
+	expirer, ok := a.db.(logger.Expirer)
+	if !ok {
+		return nil, nil, errors.New("this database can't list a channel's days, so it can't be exported")
+	}
+	// every day before one that can't have started yet is every day
+	dates, err := expirer.ExpiredDays(net.Id, channel, "9999-12-31")
+	if err != nil {
+		return nil, nil, err
+	}
+	inDb := make(map[string]bool)
+	for _, date := range dates {
+		inDb[date] = true
+	}
+	if a.archiveDir != "" {
+		archived, err := archive.Dates(a.archiveDir, net.Id, channel)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, date := range archived {
+			if !inDb[date] {
+				dates = append(dates, date)
+			}
+		}
+	}
+
+	return dates, func(date string) ([]irclogsme.LogMessage, error) {
+		if inDb[date] {
+			return expirer.DayMessages(net.Id, channel, date)
+		}
+		return archive.ReadDay(a.archiveDir, net.Id, channel, date)
+	}, nil
+}
+
+func (a *admin) exportLogs(args []string) error {
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	format := fs.String("format", export.FORMAT_TEXT, "how to write each day: "+strings.Join(export.FORMATS, ", "))
+	archiveType := fs.String("archive", export.ARCHIVE_TARGZ, "what to pack the days into: "+strings.Join(export.ARCHIVES, ", "))
+	from := fs.String("from", "", "YYYY-MM-DD of the first day to export - defaults to the first there is")
+	to := fs.String("to", "", "YYYY-MM-DD of the last day to export - defaults to the last there is")
+	output := fs.String("o", "", "file to write - defaults to <network>-<channel>.<archive>, - for stdout")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 2 {
+		return errUsage
+	}
+	for _, date := range []string{*from, *to} {
+		if _, err := time.Parse("2006-01-02", date); date != "" && err != nil {
+			return fmt.Errorf("bad date %q", date)
+		}
+	}
+	net, err := a.findNetwork(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	channel, found := net.FindChannel(fs.Arg(1))
+	if !found {
+		return fmt.Errorf("%s has no channel %s", net.Name, fs.Arg(1))
+	}
+	exp, err := export.New(net, channel, *format, *archiveType)
+	if err != nil {
+		return err
+	}
+
+	dates, day, err := a.exportDays(net, channel)
+	if err != nil {
+		return err
+	}
+	dates = export.InRange(dates, *from, *to)
+	if len(dates) == 0 {
+		return fmt.Errorf("%s on %s has no logs in that range", channel, net.Name)
+	}
+
+	filename := *output
+	if filename == "" {
+		filename = exp.FileName()
+	}
+	if filename == "-" {
+		return exp.Write(a.out, dates, day)
+	}
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	if err := exp.Write(f, dates, day); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "wrote %d days to %s\n", len(dates), filename)
+	return nil
+}
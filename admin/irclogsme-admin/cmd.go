@@ -0,0 +1,9 @@
+package main
+
+import (
+	"github.com/lukegb/irclogsme/admin"
+)
+
+func main() {
+	admin.Start()
+}
@@ -0,0 +1,46 @@
+package admin
+
+import (
+	"flag"
+	"fmt"
+	"github.com/lukegb/irclogsme/config"
+	"github.com/lukegb/irclogsme/logger"
+	"log"
+	"os"
+)
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: %s [flags] <command> [args]\n\ncommands:\n", os.Args[0])
+	for _, name := range commandOrder {
+		fmt.Fprintf(os.Stderr, "  %s\n", commands[name].usage)
+	}
+	fmt.Fprintf(os.Stderr, "\nadd -h after a command with flags to see them.\n\nflags:\n")
+	flag.PrintDefaults()
+}
+
+// Start runs irclogsme-admin. Like the other commands, its flags are only registered in here.
+func Start() {
+	loader := config.NewLoader(flag.CommandLine, config.DB|config.ARCHIVE)
+	loader.Schemes = logger.DB_SCHEMES
+	flag.Usage = usage
+	flag.Parse()
+	settings, err := loader.Load(config.Settings{DBConnString: "mongodb://localhost/irclogsme"})
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	db, err := logger.DbConnect(settings.DBConnString)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	a := &admin{db: db, archiveDir: settings.ArchiveDir, out: os.Stdout}
+	if err := a.run(flag.Args()); err == errUsage {
+		usage()
+		os.Exit(2)
+	} else if err == flag.ErrHelp {
+		os.Exit(2)
+	} else if err != nil {
+		log.Fatalln(err)
+	}
+}
@@ -0,0 +1,335 @@
+// Package archive keeps days of logs which have been moved out of the database. Each day is a
+// gzipped file of JSON messages, one per line, at <dir>/<network id>/<channel>/<date>.jsonl.gz.
+// Each channel also has an INDEX_FILE of "<id> <date>" lines so messages can be found by id.
+package archive
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"github.com/lukegb/irclogsme"
+	"io"
+	"io/ioutil"
+	"labix.org/v2/mgo/bson"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	SUFFIX     = ".jsonl.gz"
+	INDEX_FILE = "ids"
+)
+
+// PathSafe stops channel and network names escaping the directory they're meant to be in
+func PathSafe(name string) string {
+	name = strings.Replace(name, "/", "_", -1)
+	name = strings.Replace(name, "\x00", "_", -1)
+	if name == "." || name == ".." {
+		name = "_" + name
+	}
+	return name
+}
+
+func channelDir(dir string, networkId bson.ObjectId, channel string) string {
+	return filepath.Join(dir, networkId.Hex(), PathSafe(channel))
+}
+
+func dayFile(dir string, networkId bson.ObjectId, channel, splitDate string) string {
+	return filepath.Join(channelDir(dir, networkId, channel), PathSafe(splitDate)+SUFFIX)
+}
+
+// record is how a message is written down. bson.ObjectId won't unmarshal an empty id from JSON,
+// so ids are kept as hex strings.
+type record struct {
+	Id        string    `json:"id"`
+	NetworkId string    `json:"network_id"`
+	Channel   string    `json:"channel"`
+	Time      time.Time `json:"time"`
+	SplitDate string    `json:"split_date"`
+
+	Nick  string `json:"nick"`
+	Ident string `json:"ident"`
+	Host  string `json:"host"`
+
+	Account string `json:"account,omitempty"`
+	MsgId   string `json:"msgid,omitempty"`
+	ReplyTo string `json:"reply_to,omitempty"`
+
+	// files written before payloads were typed have no payload_version, but their target and
+	// payload were always strings (or null) so they read the same
+	Type           irclogsme.LogMessageType `json:"type"`
+	PayloadVersion int                      `json:"payload_version,omitempty"`
+	Target         string                   `json:"target,omitempty"`
+	Payload        string                   `json:"payload"`
+
+	RawId string `json:"raw_id,omitempty"`
+}
+
+func hexId(id bson.ObjectId) string {
+	if id == "" {
+		return ""
+	}
+	return id.Hex()
+}
+
+func objectId(s string) bson.ObjectId {
+	if !bson.IsObjectIdHex(s) {
+		return ""
+	}
+	return bson.ObjectIdHex(s)
+}
+
+func toRecord(msg irclogsme.LogMessage) record {
+	return record{
+		Id: hexId(msg.Id), NetworkId: hexId(msg.NetworkId), Channel: msg.Channel, Time: msg.Time, SplitDate: msg.SplitDate,
+		Nick: msg.Nick, Ident: msg.Ident, Host: msg.Host,
+		Account: msg.Account, MsgId: msg.MsgId, ReplyTo: msg.ReplyTo,
+		Type: msg.Type, PayloadVersion: msg.Data.Version, Target: msg.Data.Target, Payload: msg.Data.Text,
+		RawId: hexId(msg.RawId),
+	}
+}
+
+func (r record) message() irclogsme.LogMessage {
+	return irclogsme.LogMessage{
+		Id: objectId(r.Id), NetworkId: objectId(r.NetworkId), Channel: r.Channel, Time: r.Time, SplitDate: r.SplitDate,
+		Nick: r.Nick, Ident: r.Ident, Host: r.Host,
+		Account: r.Account, MsgId: r.MsgId, ReplyTo: r.ReplyTo,
+		Type: r.Type, Data: irclogsme.Payload{Version: irclogsme.PAYLOAD_VERSION, Text: r.Payload, Target: r.Target},
+		RawId: objectId(r.RawId),
+	}
+}
+
+type byTime []irclogsme.LogMessage
+
+func (l byTime) Len() int           { return len(l) }
+func (l byTime) Less(i, j int) bool { return l[i].Time.Before(l[j].Time) }
+func (l byTime) Swap(i, j int)      { l[i], l[j] = l[j], l[i] }
+
+// WriteDay archives a day of one channel's messages. If the day's already been archived the
+// two are merged, so it's safe to archive a day again if deleting it afterwards failed.
+func WriteDay(dir string, networkId bson.ObjectId, channel, splitDate string, msgs []irclogsme.LogMessage) error {
+	existing, err := ReadDay(dir, networkId, channel, splitDate)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	seen := make(map[bson.ObjectId]bool)
+	all := make([]irclogsme.LogMessage, 0, len(existing)+len(msgs))
+	for _, msg := range append(existing, msgs...) {
+		if msg.Id != "" && seen[msg.Id] {
+			continue
+		}
+		seen[msg.Id] = true
+		all = append(all, msg)
+	}
+	sort.Stable(byTime(all))
+
+	if err := os.MkdirAll(channelDir(dir, networkId, channel), 0755); err != nil {
+		return err
+	}
+	path := dayFile(dir, networkId, channel, splitDate)
+	tmp, err := ioutil.TempFile(filepath.Dir(path), ".archive")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	gz := gzip.NewWriter(tmp)
+	enc := json.NewEncoder(gz)
+	for _, msg := range all {
+		if err := enc.Encode(toRecord(msg)); err != nil {
+			tmp.Close()
+			return err
+		}
+	}
+	if err := gz.Close(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return err
+	}
+	return indexDay(dir, networkId, channel, splitDate, msgs)
+}
+
+// indexDay adds a day's ids to its channel's index, making the index from every archived day
+// first if the channel was archived before there were indexes
+func indexDay(dir string, networkId bson.ObjectId, channel, splitDate string, msgs []irclogsme.LogMessage) error {
+	path := filepath.Join(channelDir(dir, networkId, channel), INDEX_FILE)
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return writeIndex(dir, networkId, channel, path)
+	} else if err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	for _, msg := range msgs {
+		if msg.Id != "" {
+			w.WriteString(msg.Id.Hex() + " " + splitDate + "\n")
+		}
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func writeIndex(dir string, networkId bson.ObjectId, channel, path string) error {
+	dates, err := Dates(dir, networkId, channel)
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(path), ".index")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	w := bufio.NewWriter(tmp)
+	for _, date := range dates {
+		msgs, err := ReadDay(dir, networkId, channel, date)
+		if err != nil {
+			tmp.Close()
+			return err
+		}
+		for _, msg := range msgs {
+			if msg.Id != "" {
+				w.WriteString(msg.Id.Hex() + " " + date + "\n")
+			}
+		}
+	}
+	if err := w.Flush(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// ReadDay returns an archived day, oldest first. The error satisfies os.IsNotExist if the day
+// isn't archived.
+func ReadDay(dir string, networkId bson.ObjectId, channel, splitDate string) ([]irclogsme.LogMessage, error) {
+	return readFile(dayFile(dir, networkId, channel, splitDate))
+}
+
+func readFile(path string) ([]irclogsme.LogMessage, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	gz, err := gzip.NewReader(bufio.NewReader(f))
+	if err != nil {
+		return nil, err
+	}
+	defer gz.Close()
+
+	msgs := make([]irclogsme.LogMessage, 0)
+	dec := json.NewDecoder(gz)
+	for {
+		var r record
+		if err := dec.Decode(&r); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		msgs = append(msgs, r.message())
+	}
+	return msgs, nil
+}
+
+// Dates is every archived day for a channel, in order
+func Dates(dir string, networkId bson.ObjectId, channel string) ([]string, error) {
+	dates, err := dirDates(channelDir(dir, networkId, channel))
+	if os.IsNotExist(err) {
+		return []string{}, nil
+	}
+	return dates, err
+}
+
+func dirDates(chanDir string) ([]string, error) {
+	infos, err := ioutil.ReadDir(chanDir)
+	if err != nil {
+		return nil, err
+	}
+	dates := make([]string, 0, len(infos))
+	for _, info := range infos {
+		if strings.HasSuffix(info.Name(), SUFFIX) && !strings.HasPrefix(info.Name(), ".") {
+			dates = append(dates, strings.TrimSuffix(info.Name(), SUFFIX))
+		}
+	}
+	sort.Strings(dates)
+	return dates, nil
+}
+
+// FindLog looks for an archived message when all we've got is its id. Its id needn't say when
+// it was logged - imports and reprocessing make new ones - so we go by the channels' indexes,
+// or read every day of channels the logger hasn't indexed yet.
+func FindLog(dir string, id bson.ObjectId) (irclogsme.LogMessage, bool, error) {
+	chanDirs, err := filepath.Glob(filepath.Join(dir, "*", "*"))
+	if err != nil {
+		return irclogsme.LogMessage{}, false, err
+	}
+	for _, chanDir := range chanDirs {
+		if info, err := os.Stat(chanDir); err != nil || !info.IsDir() {
+			continue
+		}
+		dates, err := indexedDates(chanDir, id)
+		if err != nil {
+			return irclogsme.LogMessage{}, false, err
+		}
+		for _, date := range dates {
+			msgs, err := readFile(filepath.Join(chanDir, PathSafe(date)+SUFFIX))
+			if os.IsNotExist(err) {
+				continue
+			} else if err != nil {
+				return irclogsme.LogMessage{}, false, err
+			}
+			for _, msg := range msgs {
+				if msg.Id == id {
+					return msg, true, nil
+				}
+			}
+		}
+	}
+	return irclogsme.LogMessage{}, false, nil
+}
+
+// indexedDates is the days in chanDir the index says id might be in - all of them if there's
+// no index
+func indexedDates(chanDir string, id bson.ObjectId) ([]string, error) {
+	f, err := os.Open(filepath.Join(chanDir, INDEX_FILE))
+	if os.IsNotExist(err) {
+		return dirDates(chanDir)
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	prefix := id.Hex() + " "
+	dates := make([]string, 0, 1)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if line := scanner.Text(); strings.HasPrefix(line, prefix) {
+			dates = append(dates, line[len(prefix):])
+		}
+	}
+	return dates, scanner.Err()
+}
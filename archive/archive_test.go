@@ -0,0 +1,66 @@
+package archive
+
+import (
+	"github.com/lukegb/irclogsme"
+	"io/ioutil"
+	"labix.org/v2/mgo/bson"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func archivedMessage(networkId bson.ObjectId, id, text string, at time.Time) irclogsme.LogMessage {
+	return irclogsme.LogMessage{
+		Id: bson.ObjectIdHex(id), NetworkId: networkId, Channel: "#chan",
+		Time: at, SplitDate: at.Format("2006-01-02"), Nick: "alice",
+		Type: irclogsme.LMT_PRIVMSG, Data: irclogsme.TextPayload(text),
+	}
+}
+
+func TestFindLog(t *testing.T) {
+	dir, err := ioutil.TempDir("", "archive")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	networkId := bson.NewObjectId()
+	march := time.Date(2014, 3, 1, 12, 0, 0, 0, time.UTC)
+	// imported years after it was said, so its id is no help
+	imported := archivedMessage(networkId, "5f0000000000000000000001", "imported", march)
+	if err := WriteDay(dir, networkId, "#chan", "2014-03-01", []irclogsme.LogMessage{imported}); err != nil {
+		t.Fatal(err)
+	}
+	later := archivedMessage(networkId, "5f0000000000000000000002", "later", march.AddDate(0, 0, 5))
+	if err := WriteDay(dir, networkId, "#chan", "2014-03-06", []irclogsme.LogMessage{later}); err != nil {
+		t.Fatal(err)
+	}
+
+	find := func(when string) {
+		for _, want := range []irclogsme.LogMessage{imported, later} {
+			msg, ok, err := FindLog(dir, want.Id)
+			if err != nil || !ok || msg.Data.Text != want.Data.Text {
+				t.Errorf("%s: %s: %v %v %v", when, want.Data.Text, msg.Data.Text, ok, err)
+			}
+		}
+		if _, ok, err := FindLog(dir, bson.NewObjectId()); ok || err != nil {
+			t.Errorf("%s: found a message that isn't there: %v", when, err)
+		}
+	}
+	find("indexed")
+
+	// archives from before there were indexes get one the next time a day's written
+	index := filepath.Join(channelDir(dir, networkId, "#chan"), INDEX_FILE)
+	if err := os.Remove(index); err != nil {
+		t.Fatal(err)
+	}
+	find("unindexed")
+	if err := WriteDay(dir, networkId, "#chan", "2014-03-06", []irclogsme.LogMessage{later}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(index); err != nil {
+		t.Fatal(err)
+	}
+	find("reindexed")
+}
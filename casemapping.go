@@ -0,0 +1,80 @@
+package irclogsme
+
+import (
+	"strings"
+)
+
+const (
+	CASEMAPPING_ASCII          = "ascii"
+	CASEMAPPING_RFC1459        = "rfc1459"
+	CASEMAPPING_STRICT_RFC1459 = "strict-rfc1459"
+
+	// what we assume until a network tells us otherwise
+	DEFAULT_CASEMAPPING = CASEMAPPING_RFC1459
+	DEFAULT_CHANTYPES   = "#&+!"
+)
+
+func ValidCaseMapping(casemapping string) bool {
+	switch casemapping {
+	case CASEMAPPING_ASCII, CASEMAPPING_RFC1459, CASEMAPPING_STRICT_RFC1459:
+		return true
+	}
+	return false
+}
+
+// FoldName lowercases a nick or channel name the way the network compares them
+func FoldName(casemapping string, name string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= 'A' && r <= 'Z' {
+			return r + ('a' - 'A')
+		}
+		if casemapping == CASEMAPPING_ASCII {
+			return r
+		}
+		switch r {
+		case '[':
+			return '{'
+		case ']':
+			return '}'
+		case '\\':
+			return '|'
+		case '^':
+			if casemapping != CASEMAPPING_STRICT_RFC1459 {
+				return '~'
+			}
+		}
+		return r
+	}, name)
+}
+
+func IsChannelName(chantypes string, name string) bool {
+	return len(name) > 0 && strings.IndexByte(chantypes, name[0]) != -1
+}
+
+// the network's casemapping and channel prefixes, or the defaults if unconfigured
+func (n NetworkConfig) ChannelCaseMapping() string {
+	if n.CaseMapping == "" {
+		return DEFAULT_CASEMAPPING
+	}
+	return n.CaseMapping
+}
+
+func (n NetworkConfig) ChannelTypes() string {
+	if n.ChanTypes == "" {
+		return DEFAULT_CHANTYPES
+	}
+	return n.ChanTypes
+}
+
+// FindChannel looks up a channel in the config regardless of case, returning the name it's
+// configured (and logged) under
+func (n NetworkConfig) FindChannel(name string) (string, bool) {
+	casemapping := n.ChannelCaseMapping()
+	folded := FoldName(casemapping, name)
+	for channelName := range n.Channels {
+		if FoldName(casemapping, channelName) == folded {
+			return channelName, true
+		}
+	}
+	return name, false
+}
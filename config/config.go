@@ -0,0 +1,241 @@
+// Package config is the settings the irclogsme binaries share - where the database is, where to
+// listen and so on. Each setting can come from a flag, an environment variable or a JSON config
+// file; a flag beats the environment, which beats the file, which beats the binary's default.
+//
+// Flags are only registered when a binary asks for them, inside its Start, so importing this
+// package never clashes with anyone else's flags.
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	ENV_PREFIX = "IRCLOGSME_"
+
+	// the flag and environment variable (with ENV_PREFIX) naming the config file
+	CONFIG_FLAG = "config"
+)
+
+// Group is a set of settings a binary wants
+type Group uint
+
+const (
+	DB Group = 1 << iota
+	LISTEN
+	TLS
+	CORS
+	TIMEOUTS
+	ARCHIVE
+)
+
+type Settings struct {
+	DBConnString string `json:"db_string"`
+
+	ListenAddr string `json:"listen"`
+
+	TLSCert string `json:"tls_cert"`
+	TLSKey  string `json:"tls_key"`
+
+	// origins allowed to call the API from a browser - "*" for any
+	CORSOrigins []string `json:"cors_origins"`
+
+	// 0 is no timeout
+	ReadTimeout  Duration `json:"read_timeout"`
+	WriteTimeout Duration `json:"write_timeout"`
+
+	ArchiveDir string `json:"archive_dir"`
+}
+
+// Duration is a time.Duration that's "30s" in JSON
+type Duration time.Duration
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return errors.New("durations look like \"30s\"")
+	}
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// setting is one thing that can be set, by flag or environment variable or file
+type setting struct {
+	group Group
+	name  string
+	usage string
+	set   func(s *Settings, v string) error
+}
+
+func parseDuration(v string) (Duration, error) {
+	d, err := time.ParseDuration(v)
+	return Duration(d), err
+}
+
+var settings = []setting{
+	{DB, "db_string", "where the logs are - mongodb://, sqlite://, postgres:// and so on", func(s *Settings, v string) error {
+		s.DBConnString = v
+		return nil
+	}},
+	{LISTEN, "listen", "address to serve HTTP on, as host:port", func(s *Settings, v string) error {
+		s.ListenAddr = v
+		return nil
+	}},
+	{TLS, "tls_cert", "PEM certificate to serve HTTPS with - needs tls_key too", func(s *Settings, v string) error {
+		s.TLSCert = v
+		return nil
+	}},
+	{TLS, "tls_key", "PEM key for tls_cert", func(s *Settings, v string) error {
+		s.TLSKey = v
+		return nil
+	}},
+	{CORS, "cors_origins", "comma separated origins browsers may call the API from - * for any, empty for none", func(s *Settings, v string) error {
+		s.CORSOrigins = nil
+		for _, origin := range strings.Split(v, ",") {
+			if origin = strings.TrimSpace(origin); origin != "" {
+				s.CORSOrigins = append(s.CORSOrigins, origin)
+			}
+		}
+		return nil
+	}},
+	{TIMEOUTS, "read_timeout", "longest to spend reading a request - 0 for no limit", func(s *Settings, v string) (err error) {
+		s.ReadTimeout, err = parseDuration(v)
+		return
+	}},
+	{TIMEOUTS, "write_timeout", "longest to spend writing a response - 0 for no limit, which websockets need", func(s *Settings, v string) (err error) {
+		s.WriteTimeout, err = parseDuration(v)
+		return
+	}},
+	{ARCHIVE, "archive_dir", "where retention policies archive expired days, if anywhere", func(s *Settings, v string) error {
+		s.ArchiveDir = v
+		return nil
+	}},
+}
+
+func envName(name string) string {
+	return ENV_PREFIX + strings.ToUpper(name)
+}
+
+// Loader reads a binary's settings
+type Loader struct {
+	groups Group
+	fs     *flag.FlagSet
+
+	configFile *string
+	flags      map[string]*string
+
+	// for databases: the schemes this binary understands
+	Schemes []string
+
+	// where each setting came from, for error messages
+	sources map[string]string
+}
+
+// NewLoader registers flags on fs for the settings in groups. Call Load once fs is parsed.
+func NewLoader(fs *flag.FlagSet, groups Group) *Loader {
+	l := &Loader{
+		groups:  groups,
+		fs:      fs,
+		flags:   make(map[string]*string),
+		sources: make(map[string]string),
+	}
+	l.configFile = fs.String(CONFIG_FLAG, "", "JSON file of settings - also "+envName(CONFIG_FLAG))
+	for _, st := range settings {
+		if groups&st.group != 0 {
+			l.flags[st.name] = fs.String(st.name, "", st.usage+" - also "+envName(st.name))
+		}
+	}
+	return l
+}
+
+// Load works out the settings, starting from defaults, and checks them
+func (l *Loader) Load(defaults Settings) (*Settings, error) {
+	s := defaults
+	for _, st := range settings {
+		l.sources[st.name] = "the default"
+	}
+
+	path, pathFrom := *l.configFile, "-"+CONFIG_FLAG
+	if path == "" {
+		path, pathFrom = os.Getenv(envName(CONFIG_FLAG)), envName(CONFIG_FLAG)
+	}
+	if path != "" {
+		if err := l.loadFile(&s, path); err != nil {
+			return nil, fmt.Errorf("config file %s (from %s): %s", path, pathFrom, err.Error())
+		}
+	}
+
+	set := make(map[string]bool)
+	l.fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+
+	for _, st := range settings {
+		if l.groups&st.group == 0 {
+			continue
+		}
+		if set[st.name] {
+			if err := st.set(&s, *l.flags[st.name]); err != nil {
+				return nil, fmt.Errorf("-%s: %s", st.name, err.Error())
+			}
+			l.sources[st.name] = "-" + st.name
+		} else if v := os.Getenv(envName(st.name)); v != "" {
+			if err := st.set(&s, v); err != nil {
+				return nil, fmt.Errorf("%s: %s", envName(st.name), err.Error())
+			}
+			l.sources[st.name] = envName(st.name)
+		}
+	}
+
+	if err := l.validate(&s); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// loadFile applies whatever the file sets. Settings this binary doesn't use are allowed, so
+// every binary can share one file, but settings nobody's heard of aren't.
+func (l *Loader) loadFile(s *Settings, path string) error {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var keys map[string]json.RawMessage
+	if err := json.Unmarshal(b, &keys); err != nil {
+		return err
+	}
+	known := make(map[string]bool)
+	for _, st := range settings {
+		known[st.name] = true
+	}
+	for key := range keys {
+		if !known[key] {
+			return fmt.Errorf("unknown setting %q", key)
+		}
+	}
+	if err := json.Unmarshal(b, s); err != nil {
+		return err
+	}
+	for key := range keys {
+		l.sources[key] = path
+	}
+	return nil
+}
+
+// Source says where a setting's value came from
+func (l *Loader) Source(name string) string {
+	return l.sources[name]
+}
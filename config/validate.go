@@ -0,0 +1,136 @@
+package config
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Problems is everything wrong with a set of settings, so they can all be fixed in one go
+type Problems []string
+
+func (p Problems) Error() string {
+	return "bad settings:\n  " + strings.Join(p, "\n  ")
+}
+
+func (l *Loader) validate(s *Settings) error {
+	var problems Problems
+	bad := func(name, format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf("%s (from %s): %s", name, l.sources[name], fmt.Sprintf(format, args...)))
+	}
+
+	if l.groups&DB != 0 {
+		if s.DBConnString == "" {
+			bad("db_string", "not set - use -db_string, %s or a config file", envName("db_string"))
+		} else if err := checkScheme(s.DBConnString, l.Schemes); err != nil {
+			bad("db_string", "%s", err.Error())
+		}
+	}
+
+	if l.groups&LISTEN != 0 {
+		if err := checkListen(s.ListenAddr); err != nil {
+			bad("listen", "%s", err.Error())
+		}
+	}
+
+	if l.groups&TLS != 0 {
+		switch {
+		case s.TLSCert == "" && s.TLSKey == "":
+		case s.TLSCert == "":
+			bad("tls_cert", "not set, but tls_key is")
+		case s.TLSKey == "":
+			bad("tls_key", "not set, but tls_cert is")
+		default:
+			if _, err := tls.LoadX509KeyPair(s.TLSCert, s.TLSKey); err != nil {
+				bad("tls_cert", "can't load it with tls_key: %s", err.Error())
+			}
+		}
+	}
+
+	if l.groups&CORS != 0 {
+		for _, origin := range s.CORSOrigins {
+			if err := checkOrigin(origin); err != nil {
+				bad("cors_origins", "%q: %s", origin, err.Error())
+			}
+		}
+	}
+
+	if l.groups&TIMEOUTS != 0 {
+		if s.ReadTimeout < 0 {
+			bad("read_timeout", "can't be negative")
+		}
+		if s.WriteTimeout < 0 {
+			bad("write_timeout", "can't be negative")
+		}
+	}
+
+	if l.groups&ARCHIVE != 0 && s.ArchiveDir != "" {
+		// it's fine if it isn't there yet, the logger makes it
+		if info, err := os.Stat(s.ArchiveDir); err == nil && !info.IsDir() {
+			bad("archive_dir", "%s isn't a directory", s.ArchiveDir)
+		} else if err != nil && !os.IsNotExist(err) {
+			bad("archive_dir", "%s", err.Error())
+		}
+	}
+
+	if len(problems) > 0 {
+		return problems
+	}
+	return nil
+}
+
+func checkScheme(connString string, schemes []string) error {
+	at := strings.Index(connString, "://")
+	if at <= 0 {
+		return fmt.Errorf("%q isn't scheme://...", connString)
+	}
+	if len(schemes) == 0 {
+		return nil
+	}
+	scheme := connString[:at]
+	for _, s := range schemes {
+		if s == scheme {
+			return nil
+		}
+	}
+	return fmt.Errorf("can't use %s:// here - want one of %s", scheme, strings.Join(schemes, "://, ")+"://")
+}
+
+func checkListen(addr string) error {
+	if addr == "" {
+		return fmt.Errorf("not set")
+	}
+	_, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return err
+	}
+	n, err := strconv.Atoi(port)
+	if err != nil || n < 0 || n > 65535 {
+		return fmt.Errorf("bad port %q", port)
+	}
+	return nil
+}
+
+func checkOrigin(origin string) error {
+	if origin == "*" {
+		return nil
+	}
+	u, err := url.Parse(origin)
+	if err != nil {
+		return err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("want http:// or https://")
+	}
+	if u.Host == "" {
+		return fmt.Errorf("no host")
+	}
+	if (u.Path != "" && u.Path != "/") || u.RawQuery != "" || u.Fragment != "" {
+		return fmt.Errorf("an origin is just scheme://host[:port]")
+	}
+	return nil
+}
@@ -0,0 +1,155 @@
+// Package export writes a channel's history out as an archive of files, one per day, in a
+// format something other than irclogsme can read. Days are read and written one at a time, so
+// a range of years never has to fit in memory.
+package export
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"github.com/lukegb/irclogsme"
+	"github.com/lukegb/irclogsme/archive"
+	"io"
+	"sort"
+	"strings"
+	"time"
+)
+
+// what each day is written as
+const (
+	FORMAT_TEXT  = "text" // like irssi would log it
+	FORMAT_JSONL = "jsonl"
+	FORMAT_CSV   = "csv"
+	FORMAT_HTML  = "html"
+)
+
+// what the days are packed into
+const (
+	ARCHIVE_TARGZ = "tar.gz"
+	ARCHIVE_ZIP   = "zip"
+)
+
+var FORMATS = []string{FORMAT_TEXT, FORMAT_JSONL, FORMAT_CSV, FORMAT_HTML}
+var ARCHIVES = []string{ARCHIVE_TARGZ, ARCHIVE_ZIP}
+
+// DayFunc fetches one day of a channel's messages, oldest first
+type DayFunc func(splitDate string) ([]irclogsme.LogMessage, error)
+
+type Export struct {
+	Format  string
+	Archive string
+	// Name is what the archive's called, and the directory the days are in inside it
+	Name string
+	// Location is the zone times are written in - the channel's, so they match the days
+	Location *time.Location
+}
+
+// New is an export of one channel, named after it
+func New(netConf irclogsme.NetworkConfig, channel string, format, archiveType string) (*Export, error) {
+	e := &Export{
+		Format:   format,
+		Archive:  archiveType,
+		Name:     archive.PathSafe(netConf.Name + "-" + channel),
+		Location: netConf.LocationFor(channel),
+	}
+	if _, ok := writers[format]; !ok {
+		return nil, fmt.Errorf("no format %q - want one of %s", format, strings.Join(FORMATS, ", "))
+	}
+	if archiveType != ARCHIVE_TARGZ && archiveType != ARCHIVE_ZIP {
+		return nil, fmt.Errorf("no archive type %q - want one of %s", archiveType, strings.Join(ARCHIVES, ", "))
+	}
+	return e, nil
+}
+
+func (e *Export) FileName() string {
+	return e.Name + "." + e.Archive
+}
+
+func (e *Export) ContentType() string {
+	if e.Archive == ARCHIVE_ZIP {
+		return "application/zip"
+	}
+	return "application/gzip"
+}
+
+// InRange is the dates from..to, inclusive, in order. Either end can be "" to leave it open.
+func InRange(dates []string, from, to string) []string {
+	res := make([]string, 0, len(dates))
+	for _, date := range dates {
+		if (from == "" || date >= from) && (to == "" || date <= to) {
+			res = append(res, date)
+		}
+	}
+	sort.Strings(res)
+	return res
+}
+
+// Write writes each of dates to w, fetching them with day. Days with nothing in them are left
+// out. An error part way through leaves w with a truncated archive.
+func (e *Export) Write(w io.Writer, dates []string, day DayFunc) error {
+	writeDay := writers[e.Format]
+	ext := extensions[e.Format]
+
+	var gz *gzip.Writer
+	var tw *tar.Writer
+	var zw *zip.Writer
+	if e.Archive == ARCHIVE_ZIP {
+		zw = zip.NewWriter(w)
+	} else {
+		gz = gzip.NewWriter(w)
+		tw = tar.NewWriter(gz)
+	}
+
+	// tar wants sizes up front, so each day is rendered before it's written
+	var buf bytes.Buffer
+	for _, date := range dates {
+		msgs, err := day(date)
+		if err != nil {
+			return err
+		}
+		if len(msgs) == 0 {
+			continue
+		}
+		for n := range msgs {
+			msgs[n].Upgrade()
+			msgs[n].Time = msgs[n].Time.In(e.Location)
+		}
+
+		buf.Reset()
+		if err := writeDay(&buf, date, msgs); err != nil {
+			return err
+		}
+		name := e.Name + "/" + archive.PathSafe(date) + ext
+		modified := msgs[len(msgs)-1].Time
+
+		if zw != nil {
+			header := &zip.FileHeader{Name: name, Method: zip.Deflate}
+			header.SetModTime(modified)
+			f, err := zw.CreateHeader(header)
+			if err != nil {
+				return err
+			}
+			if _, err := buf.WriteTo(f); err != nil {
+				return err
+			}
+		} else {
+			header := &tar.Header{Name: name, Mode: 0644, Size: int64(buf.Len()), ModTime: modified, Typeflag: tar.TypeReg}
+			if err := tw.WriteHeader(header); err != nil {
+				return err
+			}
+			if _, err := buf.WriteTo(tw); err != nil {
+				return err
+			}
+		}
+	}
+
+	if zw != nil {
+		return zw.Close()
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
@@ -0,0 +1,166 @@
+package export
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"github.com/lukegb/irclogsme"
+	"github.com/lukegb/irclogsme/textformat"
+	"html/template"
+	"io"
+	"strings"
+	"time"
+)
+
+// a dayWriter writes one day's messages, already in the export's zone, as a whole file
+type dayWriter func(w io.Writer, splitDate string, msgs []irclogsme.LogMessage) error
+
+var writers = map[string]dayWriter{
+	FORMAT_TEXT:  writeText,
+	FORMAT_JSONL: writeJSONL,
+	FORMAT_CSV:   writeCSV,
+	FORMAT_HTML:  writeHTML,
+}
+
+var extensions = map[string]string{
+	FORMAT_TEXT:  ".log",
+	FORMAT_JSONL: ".jsonl",
+	FORMAT_CSV:   ".csv",
+	FORMAT_HTML:  ".html",
+}
+
+func messageId(msg irclogsme.LogMessage) string {
+	if msg.Id == "" {
+		return ""
+	}
+	return msg.Id.Hex()
+}
+
+// typeName is the type the way the API spells it
+func typeName(t irclogsme.LogMessageType) string {
+	return strings.ToLower(t.String())
+}
+
+func writeText(w io.Writer, splitDate string, msgs []irclogsme.LogMessage) error {
+	format := textformat.FORMATS[textformat.IRSSI]
+	bw := bufio.NewWriter(w)
+	if format.Opened != nil {
+		bw.WriteString(format.Opened(msgs[0].Time) + "\n")
+	}
+	for _, msg := range msgs {
+		bw.WriteString(format.Line(msg) + "\n")
+	}
+	return bw.Flush()
+}
+
+// Record is a message in a JSON Lines export
+type Record struct {
+	Id      string    `json:"id"`
+	Time    time.Time `json:"time"`
+	Type    string    `json:"type"`
+	Nick    string    `json:"nick"`
+	Ident   string    `json:"ident,omitempty"`
+	Host    string    `json:"host,omitempty"`
+	Account string    `json:"account,omitempty"`
+	MsgId   string    `json:"msgid,omitempty"`
+	ReplyTo string    `json:"reply_to,omitempty"`
+	Target  string    `json:"target,omitempty"`
+	Text    string    `json:"text,omitempty"`
+}
+
+func writeJSONL(w io.Writer, splitDate string, msgs []irclogsme.LogMessage) error {
+	enc := json.NewEncoder(w)
+	for _, msg := range msgs {
+		err := enc.Encode(Record{
+			Id: messageId(msg), Time: msg.Time, Type: typeName(msg.Type),
+			Nick: msg.Nick, Ident: msg.Ident, Host: msg.Host,
+			Account: msg.Account, MsgId: msg.MsgId, ReplyTo: msg.ReplyTo,
+			Target: msg.Data.Target, Text: msg.Data.Text,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+var CSV_HEADER = []string{"id", "time", "type", "nick", "ident", "host", "account", "target", "text"}
+
+func writeCSV(w io.Writer, splitDate string, msgs []irclogsme.LogMessage) error {
+	cw := csv.NewWriter(w)
+	cw.Write(CSV_HEADER)
+	for _, msg := range msgs {
+		cw.Write([]string{messageId(msg), msg.Time.Format(time.RFC3339), typeName(msg.Type), msg.Nick, msg.Ident, msg.Host, msg.Account, msg.Data.Target, msg.Data.Text})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// what goes in the message column of the HTML - events get spelt out, since they have no nick column
+func describe(msg irclogsme.LogMessage) string {
+	switch msg.Type {
+	case irclogsme.LMT_ACTION:
+		return "* " + msg.Nick + " " + msg.Data.Text
+	case irclogsme.LMT_JOIN:
+		return msg.Nick + " has joined"
+	case irclogsme.LMT_PART:
+		return msg.Nick + " has left" + reason(msg.Data.Text)
+	case irclogsme.LMT_QUIT:
+		return msg.Nick + " has quit" + reason(msg.Data.Text)
+	case irclogsme.LMT_KICK:
+		return msg.Data.Target + " was kicked by " + msg.Nick + reason(msg.Data.Text)
+	case irclogsme.LMT_TOPIC:
+		return msg.Nick + " changed the topic to: " + msg.Data.Text
+	case irclogsme.LMT_NICK:
+		return msg.Nick + " is now known as " + msg.Data.Text
+	}
+	return msg.Data.Text
+}
+
+func reason(s string) string {
+	if s == "" {
+		return ""
+	}
+	return " (" + s + ")"
+}
+
+var htmlTemplate = template.Must(template.New("day").Funcs(template.FuncMap{
+	"type":     typeName,
+	"describe": describe,
+	"anchor":   messageId,
+	"clock":    func(t time.Time) string { return t.Format("15:04:05") },
+	"said": func(msg irclogsme.LogMessage) bool {
+		return msg.Type == irclogsme.LMT_PRIVMSG || msg.Type == irclogsme.LMT_NOTICE
+	},
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Channel}} on {{.Date}}</title>
+<style>
+body { font-family: monospace; }
+td { vertical-align: top; padding: 0 0.5em; }
+td.time a { color: #888; text-decoration: none; }
+tr.event td.message, tr.notice td.message { color: #666; }
+</style>
+</head>
+<body>
+<h1>{{.Channel}} on {{.Date}}</h1>
+<table>
+{{range .Messages}}<tr class="{{type .Type}}{{if not (said .)}} event{{end}}" id="{{anchor .}}">
+<td class="time"><a href="#{{anchor .}}">{{clock .Time}}</a></td>
+<td class="nick">{{if said .}}{{.Nick}}{{end}}</td>
+<td class="message">{{describe .}}</td>
+</tr>
+{{end}}</table>
+</body>
+</html>
+`))
+
+func writeHTML(w io.Writer, splitDate string, msgs []irclogsme.LogMessage) error {
+	return htmlTemplate.Execute(w, struct {
+		Channel  string
+		Date     string
+		Messages []irclogsme.LogMessage
+	}{msgs[0].Channel, splitDate, msgs})
+}
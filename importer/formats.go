@@ -0,0 +1,473 @@
+package importer
+
+import (
+	"errors"
+	"fmt"
+	"github.com/lukegb/irclogsme"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// the formats we can read
+const (
+	FORMAT_IRSSI   = "irssi"
+	FORMAT_WEECHAT = "weechat"
+	FORMAT_ZNC     = "znc"
+	FORMAT_HEXCHAT = "hexchat"
+	FORMAT_EGGDROP = "eggdrop"
+)
+
+var FORMATS = []string{FORMAT_IRSSI, FORMAT_WEECHAT, FORMAT_ZNC, FORMAT_HEXCHAT, FORMAT_EGGDROP}
+
+var errNoDate = errors.New("no date for this line yet - the log doesn't say, so use -date")
+
+// Entry is one message from a log. Precision is how exact its Time is - a client that only
+// logged minutes can't tell us which second something happened in.
+type Entry struct {
+	Message   irclogsme.LogMessage
+	Precision time.Duration
+}
+
+// a parser reads one log, a line at a time, in order. ok is false for lines that aren't
+// messages - banners, mode changes, our own nick and the like.
+type parser interface {
+	Line(line string) (entry Entry, ok bool, err error)
+}
+
+func newParser(format string, c *clock) (parser, error) {
+	switch format {
+	case FORMAT_IRSSI:
+		return &irssiParser{c}, nil
+	case FORMAT_WEECHAT:
+		return &weechatParser{c}, nil
+	case FORMAT_ZNC:
+		return &zncParser{c}, nil
+	case FORMAT_HEXCHAT:
+		return &hexchatParser{c}, nil
+	case FORMAT_EGGDROP:
+		return &eggdropParser{c}, nil
+	}
+	return nil, fmt.Errorf("unknown format %q - want one of %s", format, strings.Join(FORMATS, ", "))
+}
+
+// clock knows what day a log is on, since most formats only put times on their lines
+type clock struct {
+	loc  *time.Location
+	date time.Time
+}
+
+func (c *clock) setDate(year int, month time.Month, day int) {
+	c.date = time.Date(year, month, day, 0, 0, 0, 0, c.loc)
+}
+
+// at is hh:mm:ss on the current day; sec is "" for logs which only have minutes
+func (c *clock) at(hour, min, sec string) (time.Time, time.Duration, error) {
+	if c.date.IsZero() {
+		return time.Time{}, 0, errNoDate
+	}
+	h, _ := strconv.Atoi(hour)
+	m, _ := strconv.Atoi(min)
+	precision := time.Minute
+	s := 0
+	if sec != "" {
+		s, _ = strconv.Atoi(sec)
+		precision = time.Second
+	}
+	return time.Date(c.date.Year(), c.date.Month(), c.date.Day(), h, m, s, 0, c.loc), precision, nil
+}
+
+func entry(t time.Time, precision time.Duration, lmt irclogsme.LogMessageType, nick string, data irclogsme.Payload) Entry {
+	return Entry{
+		Message:   irclogsme.LogMessage{Type: lmt, Time: t, Nick: nick, Data: data},
+		Precision: precision,
+	}
+}
+
+// withSource is e with the ident and host filled in
+func withSource(e Entry, ident, host string) Entry {
+	e.Message.Ident, e.Message.Host = ident, host
+	return e
+}
+
+// stripModes takes the @ or + off a nick, and any padding
+func stripModes(nick string) string {
+	return strings.TrimLeft(nick, " ~&@%+")
+}
+
+// splitSource splits nick!ident@host
+func splitSource(src string) (nick, ident, host string) {
+	nick = src
+	if bang := strings.IndexByte(src, '!'); bang != -1 {
+		nick, ident = src[:bang], src[bang+1:]
+		if at := strings.IndexByte(ident, '@'); at != -1 {
+			ident, host = ident[:at], ident[at+1:]
+		}
+	}
+	return
+}
+
+// irssi:
+//
+//	--- Log opened Mon Jan 02 15:04:05 2006
+//	15:04 <@nick> hello
+//	15:04 -!- nick [ident@host] has joined #chan
+//	--- Day changed Tue Jan 03 2006
+type irssiParser struct {
+	*clock
+}
+
+var (
+	irssiOpenedRegexp = regexp.MustCompile(`^--- Log opened \w+ (\w+ +\d+ \d+:\d+:\d+ \d+)$`)
+	irssiDayRegexp    = regexp.MustCompile(`^--- Day changed \w+ (\w+ +\d+ \d+)$`)
+	irssiTimeRegexp   = regexp.MustCompile(`^(\d{2}):(\d{2})(?::(\d{2}))? (.*)$`)
+
+	irssiPrivmsgRegexp = regexp.MustCompile(`^<([^>]+)> (.*)$`)
+	irssiActionRegexp  = regexp.MustCompile(`^ \* (\S+) ?(.*)$`)
+	irssiNoticeRegexp  = regexp.MustCompile(`^-([^:\s]+):\S+- ?(.*)$`)
+	irssiJoinRegexp    = regexp.MustCompile(`^-!- (\S+) \[([^@\]]*)@([^\]]*)\] has joined \S+$`)
+	irssiPartRegexp    = regexp.MustCompile(`^-!- (\S+) \[([^@\]]*)@([^\]]*)\] has left \S+ \[(.*)\]$`)
+	irssiQuitRegexp    = regexp.MustCompile(`^-!- (\S+) \[([^@\]]*)@([^\]]*)\] has quit \[(.*)\]$`)
+	irssiKickRegexp    = regexp.MustCompile(`^-!- (\S+) was kicked from \S+ by (\S+) \[(.*)\]$`)
+	irssiTopicRegexp   = regexp.MustCompile(`^-!- (\S+) changed the topic of \S+ to: ?(.*)$`)
+	irssiNickRegexp    = regexp.MustCompile(`^-!- (\S+) is now known as (\S+)$`)
+)
+
+func (p *irssiParser) Line(line string) (Entry, bool, error) {
+	if m := irssiOpenedRegexp.FindStringSubmatch(line); m != nil {
+		t, err := time.ParseInLocation("Jan _2 15:04:05 2006", m[1], p.loc)
+		if err != nil {
+			return Entry{}, false, err
+		}
+		p.setDate(t.Date())
+		return Entry{}, false, nil
+	}
+	if m := irssiDayRegexp.FindStringSubmatch(line); m != nil {
+		t, err := time.ParseInLocation("Jan _2 2006", m[1], p.loc)
+		if err != nil {
+			return Entry{}, false, err
+		}
+		p.setDate(t.Date())
+		return Entry{}, false, nil
+	}
+
+	m := irssiTimeRegexp.FindStringSubmatch(line)
+	if m == nil {
+		return Entry{}, false, nil
+	}
+	t, precision, err := p.at(m[1], m[2], m[3])
+	if err != nil {
+		return Entry{}, false, err
+	}
+	body := m[4]
+
+	if m := irssiPrivmsgRegexp.FindStringSubmatch(body); m != nil {
+		return entry(t, precision, irclogsme.LMT_PRIVMSG, stripModes(m[1]), irclogsme.TextPayload(m[2])), true, nil
+	} else if m := irssiActionRegexp.FindStringSubmatch(body); m != nil {
+		return entry(t, precision, irclogsme.LMT_ACTION, m[1], irclogsme.TextPayload(m[2])), true, nil
+	} else if m := irssiNoticeRegexp.FindStringSubmatch(body); m != nil {
+		return entry(t, precision, irclogsme.LMT_NOTICE, m[1], irclogsme.TextPayload(m[2])), true, nil
+	} else if m := irssiJoinRegexp.FindStringSubmatch(body); m != nil {
+		return withSource(entry(t, precision, irclogsme.LMT_JOIN, m[1], irclogsme.EmptyPayload()), m[2], m[3]), true, nil
+	} else if m := irssiPartRegexp.FindStringSubmatch(body); m != nil {
+		return withSource(entry(t, precision, irclogsme.LMT_PART, m[1], irclogsme.TextPayload(m[4])), m[2], m[3]), true, nil
+	} else if m := irssiQuitRegexp.FindStringSubmatch(body); m != nil {
+		return withSource(entry(t, precision, irclogsme.LMT_QUIT, m[1], irclogsme.TextPayload(m[4])), m[2], m[3]), true, nil
+	} else if m := irssiKickRegexp.FindStringSubmatch(body); m != nil {
+		return entry(t, precision, irclogsme.LMT_KICK, m[2], irclogsme.KickPayload(m[1], m[3])), true, nil
+	} else if m := irssiTopicRegexp.FindStringSubmatch(body); m != nil {
+		return entry(t, precision, irclogsme.LMT_TOPIC, m[1], irclogsme.TextPayload(m[2])), true, nil
+	} else if m := irssiNickRegexp.FindStringSubmatch(body); m != nil {
+		return entry(t, precision, irclogsme.LMT_NICK, m[1], irclogsme.TextPayload(m[2])), true, nil
+	}
+	return Entry{}, false, nil
+}
+
+// weechat, which puts the date on every line and tabs between the columns:
+//
+//	2006-01-02 15:04:05	@nick	hello
+//	2006-01-02 15:04:05	-->	nick (ident@host) has joined #chan
+type weechatParser struct {
+	*clock
+}
+
+var (
+	weechatLineRegexp = regexp.MustCompile(`^(\d{4})-(\d{2})-(\d{2}) (\d{2}):(\d{2}):(\d{2})\t([^\t]*)\t(.*)$`)
+
+	weechatJoinRegexp     = regexp.MustCompile(`^(\S+) \(([^@)]*)@([^)]*)\) has joined \S+$`)
+	weechatPartRegexp     = regexp.MustCompile(`^(\S+) \(([^@)]*)@([^)]*)\) has left \S+?(?: \((.*)\))?$`)
+	weechatQuitRegexp     = regexp.MustCompile(`^(\S+) \(([^@)]*)@([^)]*)\) has quit(?: \((.*)\))?$`)
+	weechatKickRegexp     = regexp.MustCompile(`^(\S+) has kicked (\S+)(?: \((.*)\))?$`)
+	weechatNickRegexp     = regexp.MustCompile(`^(\S+) is now known as (\S+)$`)
+	weechatTopicRegexp    = regexp.MustCompile(`^(\S+) has changed topic for \S+(?: from ".*")? to "(.*)"$`)
+	weechatUnsetRegexp    = regexp.MustCompile(`^(\S+) has unset topic for \S+$`)
+	weechatNoticeRegexp   = regexp.MustCompile(`^Notice\(([^)]+)\)(?: -> \S+)?: (.*)$`)
+	weechatActionRegexp   = regexp.MustCompile(`^(\S+) ?(.*)$`)
+	weechatNotANickRegexp = regexp.MustCompile(`^[-<=]|^$`)
+)
+
+func (p *weechatParser) Line(line string) (Entry, bool, error) {
+	m := weechatLineRegexp.FindStringSubmatch(line)
+	if m == nil {
+		return Entry{}, false, nil
+	}
+	year, _ := strconv.Atoi(m[1])
+	month, _ := strconv.Atoi(m[2])
+	day, _ := strconv.Atoi(m[3])
+	p.setDate(year, time.Month(month), day)
+	t, precision, err := p.at(m[4], m[5], m[6])
+	if err != nil {
+		return Entry{}, false, err
+	}
+	prefix, body := strings.TrimSpace(m[7]), m[8]
+
+	switch prefix {
+	case "-->":
+		if m := weechatJoinRegexp.FindStringSubmatch(body); m != nil {
+			return withSource(entry(t, precision, irclogsme.LMT_JOIN, m[1], irclogsme.EmptyPayload()), m[2], m[3]), true, nil
+		}
+	case "<--":
+		if m := weechatPartRegexp.FindStringSubmatch(body); m != nil {
+			return withSource(entry(t, precision, irclogsme.LMT_PART, m[1], irclogsme.TextPayload(m[4])), m[2], m[3]), true, nil
+		} else if m := weechatQuitRegexp.FindStringSubmatch(body); m != nil {
+			return withSource(entry(t, precision, irclogsme.LMT_QUIT, m[1], irclogsme.TextPayload(m[4])), m[2], m[3]), true, nil
+		} else if m := weechatKickRegexp.FindStringSubmatch(body); m != nil {
+			return entry(t, precision, irclogsme.LMT_KICK, m[1], irclogsme.KickPayload(m[2], m[3])), true, nil
+		}
+	case "--":
+		if m := weechatNickRegexp.FindStringSubmatch(body); m != nil {
+			return entry(t, precision, irclogsme.LMT_NICK, m[1], irclogsme.TextPayload(m[2])), true, nil
+		} else if m := weechatTopicRegexp.FindStringSubmatch(body); m != nil {
+			return entry(t, precision, irclogsme.LMT_TOPIC, m[1], irclogsme.TextPayload(m[2])), true, nil
+		} else if m := weechatUnsetRegexp.FindStringSubmatch(body); m != nil {
+			return entry(t, precision, irclogsme.LMT_TOPIC, m[1], irclogsme.TextPayload("")), true, nil
+		} else if m := weechatNoticeRegexp.FindStringSubmatch(body); m != nil {
+			return entry(t, precision, irclogsme.LMT_NOTICE, m[1], irclogsme.TextPayload(m[2])), true, nil
+		}
+	case "*":
+		if m := weechatActionRegexp.FindStringSubmatch(body); m != nil {
+			return entry(t, precision, irclogsme.LMT_ACTION, m[1], irclogsme.TextPayload(m[2])), true, nil
+		}
+	default:
+		if !weechatNotANickRegexp.MatchString(prefix) {
+			return entry(t, precision, irclogsme.LMT_PRIVMSG, stripModes(prefix), irclogsme.TextPayload(body)), true, nil
+		}
+	}
+	return Entry{}, false, nil
+}
+
+// ZNC's log module, one file per day, so the date comes from the file name or -date:
+//
+//	[15:04:05] <nick> hello
+//	[15:04:05] *** Joins: nick (ident@host)
+type zncParser struct {
+	*clock
+}
+
+var (
+	zncTimeRegexp = regexp.MustCompile(`^\[(\d{2}):(\d{2}):(\d{2})\] (.*)$`)
+
+	zncPrivmsgRegexp = regexp.MustCompile(`^<([^>]+)> (.*)$`)
+	zncJoinRegexp    = regexp.MustCompile(`^\*\*\* Joins: (\S+) \(([^@)]*)@([^)]*)\)$`)
+	zncPartRegexp    = regexp.MustCompile(`^\*\*\* Parts: (\S+) \(([^@)]*)@([^)]*)\) \((.*)\)$`)
+	zncQuitRegexp    = regexp.MustCompile(`^\*\*\* Quits: (\S+) \(([^@)]*)@([^)]*)\) \((.*)\)$`)
+	zncKickRegexp    = regexp.MustCompile(`^\*\*\* (\S+) was kicked by (\S+) \((.*)\)$`)
+	zncNickRegexp    = regexp.MustCompile(`^\*\*\* (\S+) is now known as (\S+)$`)
+	zncTopicRegexp   = regexp.MustCompile(`^\*\*\* (\S+) changes topic to '(.*)'$`)
+	zncActionRegexp  = regexp.MustCompile(`^\* (\S+) ?(.*)$`)
+	zncNoticeRegexp  = regexp.MustCompile(`^-(\S+)- (.*)$`)
+)
+
+func (p *zncParser) Line(line string) (Entry, bool, error) {
+	m := zncTimeRegexp.FindStringSubmatch(line)
+	if m == nil {
+		return Entry{}, false, nil
+	}
+	t, precision, err := p.at(m[1], m[2], m[3])
+	if err != nil {
+		return Entry{}, false, err
+	}
+	body := m[4]
+
+	if m := zncPrivmsgRegexp.FindStringSubmatch(body); m != nil {
+		return entry(t, precision, irclogsme.LMT_PRIVMSG, stripModes(m[1]), irclogsme.TextPayload(m[2])), true, nil
+	} else if m := zncJoinRegexp.FindStringSubmatch(body); m != nil {
+		return withSource(entry(t, precision, irclogsme.LMT_JOIN, m[1], irclogsme.EmptyPayload()), m[2], m[3]), true, nil
+	} else if m := zncPartRegexp.FindStringSubmatch(body); m != nil {
+		return withSource(entry(t, precision, irclogsme.LMT_PART, m[1], irclogsme.TextPayload(m[4])), m[2], m[3]), true, nil
+	} else if m := zncQuitRegexp.FindStringSubmatch(body); m != nil {
+		return withSource(entry(t, precision, irclogsme.LMT_QUIT, m[1], irclogsme.TextPayload(m[4])), m[2], m[3]), true, nil
+	} else if m := zncKickRegexp.FindStringSubmatch(body); m != nil {
+		return entry(t, precision, irclogsme.LMT_KICK, m[2], irclogsme.KickPayload(m[1], m[3])), true, nil
+	} else if m := zncNickRegexp.FindStringSubmatch(body); m != nil {
+		return entry(t, precision, irclogsme.LMT_NICK, m[1], irclogsme.TextPayload(m[2])), true, nil
+	} else if m := zncTopicRegexp.FindStringSubmatch(body); m != nil {
+		return entry(t, precision, irclogsme.LMT_TOPIC, m[1], irclogsme.TextPayload(m[2])), true, nil
+	} else if strings.HasPrefix(body, "***") {
+		// modes and the like
+		return Entry{}, false, nil
+	} else if m := zncActionRegexp.FindStringSubmatch(body); m != nil {
+		return entry(t, precision, irclogsme.LMT_ACTION, m[1], irclogsme.TextPayload(m[2])), true, nil
+	} else if m := zncNoticeRegexp.FindStringSubmatch(body); m != nil {
+		return entry(t, precision, irclogsme.LMT_NOTICE, m[1], irclogsme.TextPayload(m[2])), true, nil
+	}
+	return Entry{}, false, nil
+}
+
+// HexChat, which leaves the year off its lines - it's only in the BEGIN LOGGING banners:
+//
+//	**** BEGIN LOGGING AT Mon Jan  2 15:04:05 2006
+//	Jan 02 15:04:05 <nick>	hello
+//	Jan 02 15:04:05 -->	nick (ident@host) has joined #chan
+type hexchatParser struct {
+	*clock
+}
+
+var (
+	hexchatBeginRegexp = regexp.MustCompile(`^\*\*\*\* BEGIN LOGGING AT \w+ (\w+ +\d+ \d+:\d+:\d+ \d+)$`)
+	hexchatLineRegexp  = regexp.MustCompile(`^(\w{3}) +(\d{1,2}) (\d{2}):(\d{2}):(\d{2}) ([^\t]*)\t(.*)$`)
+
+	hexchatPrivmsgRegexp = regexp.MustCompile(`^<([^>]+)>$`)
+	hexchatNoticeRegexp  = regexp.MustCompile(`^-([^/\s-][^/\s]*?)(?:/\S+)?-$`)
+	hexchatJoinRegexp    = regexp.MustCompile(`^(\S+) \(([^@)]*)@([^)]*)\) has joined \S+$`)
+	hexchatPartRegexp    = regexp.MustCompile(`^(\S+) \(([^@)]*)@([^)]*)\) has left \S+?(?: \((.*)\))?$`)
+	hexchatQuitRegexp    = regexp.MustCompile(`^(\S+) has quit(?: \((.*)\))?$`)
+	hexchatKickRegexp    = regexp.MustCompile(`^(\S+) has kicked (\S+) from \S+?(?: \((.*)\))?$`)
+	hexchatNickRegexp    = regexp.MustCompile(`^(\S+) is now known as (\S+)$`)
+	hexchatTopicRegexp   = regexp.MustCompile(`^(\S+) has changed the topic to: ?(.*)$`)
+	hexchatActionRegexp  = regexp.MustCompile(`^(\S+) ?(.*)$`)
+)
+
+func (p *hexchatParser) Line(line string) (Entry, bool, error) {
+	if m := hexchatBeginRegexp.FindStringSubmatch(line); m != nil {
+		t, err := time.ParseInLocation("Jan _2 15:04:05 2006", m[1], p.loc)
+		if err != nil {
+			return Entry{}, false, err
+		}
+		p.setDate(t.Date())
+		return Entry{}, false, nil
+	}
+
+	m := hexchatLineRegexp.FindStringSubmatch(line)
+	if m == nil {
+		return Entry{}, false, nil
+	}
+	if p.date.IsZero() {
+		return Entry{}, false, errNoDate
+	}
+	month, err := time.Parse("Jan", m[1])
+	if err != nil {
+		return Entry{}, false, nil
+	}
+	day, _ := strconv.Atoi(m[2])
+	year := p.date.Year()
+	// a long session can see the new year in
+	if month.Month() < p.date.Month() {
+		year++
+	}
+	p.setDate(year, month.Month(), day)
+	t, precision, err := p.at(m[3], m[4], m[5])
+	if err != nil {
+		return Entry{}, false, err
+	}
+	prefix, body := m[6], m[7]
+
+	switch prefix {
+	case "-->":
+		if m := hexchatJoinRegexp.FindStringSubmatch(body); m != nil {
+			return withSource(entry(t, precision, irclogsme.LMT_JOIN, m[1], irclogsme.EmptyPayload()), m[2], m[3]), true, nil
+		}
+	case "<--":
+		if m := hexchatPartRegexp.FindStringSubmatch(body); m != nil {
+			return withSource(entry(t, precision, irclogsme.LMT_PART, m[1], irclogsme.TextPayload(m[4])), m[2], m[3]), true, nil
+		} else if m := hexchatQuitRegexp.FindStringSubmatch(body); m != nil {
+			return entry(t, precision, irclogsme.LMT_QUIT, m[1], irclogsme.TextPayload(m[2])), true, nil
+		} else if m := hexchatKickRegexp.FindStringSubmatch(body); m != nil {
+			return entry(t, precision, irclogsme.LMT_KICK, m[1], irclogsme.KickPayload(m[2], m[3])), true, nil
+		}
+	case "---":
+		if m := hexchatNickRegexp.FindStringSubmatch(body); m != nil {
+			return entry(t, precision, irclogsme.LMT_NICK, m[1], irclogsme.TextPayload(m[2])), true, nil
+		} else if m := hexchatTopicRegexp.FindStringSubmatch(body); m != nil {
+			return entry(t, precision, irclogsme.LMT_TOPIC, m[1], irclogsme.TextPayload(m[2])), true, nil
+		}
+	case "*":
+		if m := hexchatActionRegexp.FindStringSubmatch(body); m != nil {
+			return entry(t, precision, irclogsme.LMT_ACTION, m[1], irclogsme.TextPayload(m[2])), true, nil
+		}
+	default:
+		if m := hexchatPrivmsgRegexp.FindStringSubmatch(prefix); m != nil {
+			return entry(t, precision, irclogsme.LMT_PRIVMSG, stripModes(m[1]), irclogsme.TextPayload(body)), true, nil
+		} else if m := hexchatNoticeRegexp.FindStringSubmatch(prefix); m != nil {
+			return entry(t, precision, irclogsme.LMT_NOTICE, m[1], irclogsme.TextPayload(body)), true, nil
+		}
+	}
+	return Entry{}, false, nil
+}
+
+// eggdrop's channel logs, one file per day, with day markers in case a file runs over:
+//
+//	[15:04:05] <nick> hello
+//	[15:04:05] nick (ident@host) joined #chan.
+//	[00:00:00] --- Tue Jan  3 2006
+type eggdropParser struct {
+	*clock
+}
+
+var (
+	eggdropTimeRegexp = regexp.MustCompile(`^\[(\d{2}):(\d{2})(?::(\d{2}))?\] (.*)$`)
+	eggdropDayRegexp  = regexp.MustCompile(`^--- \w+ (\w+ +\d+ \d+)$`)
+
+	eggdropPrivmsgRegexp = regexp.MustCompile(`^<([^>]+)> (.*)$`)
+	eggdropActionRegexp  = regexp.MustCompile(`^Action: (\S+) ?(.*)$`)
+	eggdropNoticeRegexp  = regexp.MustCompile(`^-(\S+) \(([^@)]*)@([^)]*)\)(?::\S+)?- ?(.*)$`)
+	eggdropJoinRegexp    = regexp.MustCompile(`^(\S+) \(([^@)]*)@([^)]*)\) joined \S+\.$`)
+	eggdropPartRegexp    = regexp.MustCompile(`^(\S+) \(([^@)]*)@([^)]*)\) left [^\s:]+?(?: \((.*)\))?\.$`)
+	eggdropQuitRegexp    = regexp.MustCompile(`^(\S+) \(([^@)]*)@([^)]*)\) left irc: ?(.*)$`)
+	eggdropKickRegexp    = regexp.MustCompile(`^(\S+) kicked from \S+ by (\S+): ?(.*)$`)
+	eggdropNickRegexp    = regexp.MustCompile(`^Nick change: (\S+) -> (\S+)$`)
+	eggdropTopicRegexp   = regexp.MustCompile(`^Topic changed on \S+ by (\S+): ?(.*)$`)
+)
+
+func (p *eggdropParser) Line(line string) (Entry, bool, error) {
+	m := eggdropTimeRegexp.FindStringSubmatch(line)
+	if m == nil {
+		return Entry{}, false, nil
+	}
+	body := m[4]
+	if m := eggdropDayRegexp.FindStringSubmatch(body); m != nil {
+		t, err := time.ParseInLocation("Jan _2 2006", m[1], p.loc)
+		if err != nil {
+			return Entry{}, false, err
+		}
+		p.setDate(t.Date())
+		return Entry{}, false, nil
+	}
+	t, precision, err := p.at(m[1], m[2], m[3])
+	if err != nil {
+		return Entry{}, false, err
+	}
+
+	if m := eggdropPrivmsgRegexp.FindStringSubmatch(body); m != nil {
+		return entry(t, precision, irclogsme.LMT_PRIVMSG, stripModes(m[1]), irclogsme.TextPayload(m[2])), true, nil
+	} else if m := eggdropActionRegexp.FindStringSubmatch(body); m != nil {
+		return entry(t, precision, irclogsme.LMT_ACTION, m[1], irclogsme.TextPayload(m[2])), true, nil
+	} else if m := eggdropNoticeRegexp.FindStringSubmatch(body); m != nil {
+		return withSource(entry(t, precision, irclogsme.LMT_NOTICE, m[1], irclogsme.TextPayload(m[4])), m[2], m[3]), true, nil
+	} else if m := eggdropJoinRegexp.FindStringSubmatch(body); m != nil {
+		return withSource(entry(t, precision, irclogsme.LMT_JOIN, m[1], irclogsme.EmptyPayload()), m[2], m[3]), true, nil
+	} else if m := eggdropQuitRegexp.FindStringSubmatch(body); m != nil {
+		return withSource(entry(t, precision, irclogsme.LMT_QUIT, m[1], irclogsme.TextPayload(m[4])), m[2], m[3]), true, nil
+	} else if m := eggdropPartRegexp.FindStringSubmatch(body); m != nil {
+		return withSource(entry(t, precision, irclogsme.LMT_PART, m[1], irclogsme.TextPayload(m[4])), m[2], m[3]), true, nil
+	} else if m := eggdropKickRegexp.FindStringSubmatch(body); m != nil {
+		return entry(t, precision, irclogsme.LMT_KICK, m[2], irclogsme.KickPayload(m[1], m[3])), true, nil
+	} else if m := eggdropNickRegexp.FindStringSubmatch(body); m != nil {
+		return entry(t, precision, irclogsme.LMT_NICK, m[1], irclogsme.TextPayload(m[2])), true, nil
+	} else if m := eggdropTopicRegexp.FindStringSubmatch(body); m != nil {
+		nick, ident, host := splitSource(m[1])
+		return withSource(entry(t, precision, irclogsme.LMT_TOPIC, nick, irclogsme.TextPayload(m[2])), ident, host), true, nil
+	}
+	return Entry{}, false, nil
+}
@@ -0,0 +1,244 @@
+package importer
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// entryLine is the bits of an entry the parser tests care about
+func entryLine(e Entry) string {
+	msg := e.Message
+	s := fmt.Sprintf("%s/%s %s %s", msg.Time.Format("2006-01-02T15:04:05"), e.Precision, msg.Type, msg.Nick)
+	if msg.Ident != "" || msg.Host != "" {
+		s += "!" + msg.Ident + "@" + msg.Host
+	}
+	if msg.Data.Target != "" {
+		s += " target=" + msg.Data.Target
+	}
+	if msg.Data.Text != "" {
+		s += " :" + msg.Data.Text
+	}
+	return s
+}
+
+var parserTests = []struct {
+	format string
+	// the day the log starts on, if the test gives it one
+	date    time.Time
+	lines   []string
+	entries []string
+}{
+	{
+		format: FORMAT_IRSSI,
+		lines: []string{
+			"--- Log opened Sat Mar 01 11:58:00 2014",
+			"11:58 -!- alice [a@host] has joined #chan",
+			"11:59 <@alice> hello there",
+			"11:59 < bob> padded",
+			"12:00:30  * alice waves",
+			"12:01 -bob:#chan- a notice",
+			"12:02 -!- bob [b@host] has left #chan [later]",
+			"12:03 -!- alice changed the topic of #chan to: new topic",
+			"12:04 -!- alice is now known as alice2",
+			"12:05 -!- carol was kicked from #chan by alice2 [out]",
+			"12:06 -!- mode/#chan [+o alice2] by ChanServ",
+			"--- Day changed Sun Mar 02 2014",
+			"00:01 -!- alice2 [a@host] has quit [Ping timeout]",
+			"--- Log closed Sun Mar 02 00:02:00 2014",
+		},
+		entries: []string{
+			"2014-03-01T11:58:00/1m0s JOIN alice!a@host",
+			"2014-03-01T11:59:00/1m0s PRIVMSG alice :hello there",
+			"2014-03-01T11:59:00/1m0s PRIVMSG bob :padded",
+			"2014-03-01T12:00:30/1s ACTION alice :waves",
+			"2014-03-01T12:01:00/1m0s NOTICE bob :a notice",
+			"2014-03-01T12:02:00/1m0s PART bob!b@host :later",
+			"2014-03-01T12:03:00/1m0s TOPIC alice :new topic",
+			"2014-03-01T12:04:00/1m0s NICK alice :alice2",
+			"2014-03-01T12:05:00/1m0s KICK alice2 target=carol :out",
+			"2014-03-02T00:01:00/1m0s QUIT alice2!a@host :Ping timeout",
+		},
+	},
+	{
+		format: FORMAT_WEECHAT,
+		lines: []string{
+			"2014-03-01 11:58:00\t-->\talice (a@host) has joined #chan",
+			"2014-03-01 11:59:00\t@alice\thello there",
+			"2014-03-01 11:59:10\t*\talice waves",
+			"2014-03-01 12:00:00\t--\tNotice(bob) -> #chan: a notice",
+			"2014-03-01 12:01:00\t<--\tbob (b@host) has left #chan (later)",
+			"2014-03-01 12:01:30\t<--\tdave (d@host) has left #chan",
+			"2014-03-01 12:02:00\t<--\tcarol (c@host) has quit (Quit: bye)",
+			"2014-03-01 12:03:00\t<--\talice has kicked eve (out)",
+			"2014-03-01 12:04:00\t--\talice has changed topic for #chan from \"old\" to \"new topic\"",
+			"2014-03-01 12:04:30\t--\talice has unset topic for #chan",
+			"2014-03-01 12:05:00\t--\talice is now known as alice2",
+			"2014-03-01 12:06:00\t--\tMode #chan [+o alice2] by ChanServ",
+			"2014-03-01 12:07:00\t=!=\tsomething went wrong",
+		},
+		entries: []string{
+			"2014-03-01T11:58:00/1s JOIN alice!a@host",
+			"2014-03-01T11:59:00/1s PRIVMSG alice :hello there",
+			"2014-03-01T11:59:10/1s ACTION alice :waves",
+			"2014-03-01T12:00:00/1s NOTICE bob :a notice",
+			"2014-03-01T12:01:00/1s PART bob!b@host :later",
+			"2014-03-01T12:01:30/1s PART dave!d@host",
+			"2014-03-01T12:02:00/1s QUIT carol!c@host :Quit: bye",
+			"2014-03-01T12:03:00/1s KICK alice target=eve :out",
+			"2014-03-01T12:04:00/1s TOPIC alice :new topic",
+			"2014-03-01T12:04:30/1s TOPIC alice",
+			"2014-03-01T12:05:00/1s NICK alice :alice2",
+		},
+	},
+	{
+		format: FORMAT_ZNC,
+		date:   time.Date(2014, 3, 1, 0, 0, 0, 0, time.UTC),
+		lines: []string{
+			"[11:58:00] *** Joins: alice (a@host)",
+			"[11:59:00] <alice> hello there",
+			"[11:59:10] * alice waves",
+			"[12:00:00] -bob- a notice",
+			"[12:01:00] *** Parts: bob (b@host) (later)",
+			"[12:02:00] *** Quits: carol (c@host) (Quit: bye)",
+			"[12:03:00] *** eve was kicked by alice (out)",
+			"[12:04:00] *** alice changes topic to 'new topic'",
+			"[12:05:00] *** alice is now known as alice2",
+			"[12:06:00] *** ChanServ sets mode: +o alice2",
+		},
+		entries: []string{
+			"2014-03-01T11:58:00/1s JOIN alice!a@host",
+			"2014-03-01T11:59:00/1s PRIVMSG alice :hello there",
+			"2014-03-01T11:59:10/1s ACTION alice :waves",
+			"2014-03-01T12:00:00/1s NOTICE bob :a notice",
+			"2014-03-01T12:01:00/1s PART bob!b@host :later",
+			"2014-03-01T12:02:00/1s QUIT carol!c@host :Quit: bye",
+			"2014-03-01T12:03:00/1s KICK alice target=eve :out",
+			"2014-03-01T12:04:00/1s TOPIC alice :new topic",
+			"2014-03-01T12:05:00/1s NICK alice :alice2",
+		},
+	},
+	{
+		format: FORMAT_HEXCHAT,
+		lines: []string{
+			"**** BEGIN LOGGING AT Tue Dec 31 23:58:00 2013",
+			"Dec 31 23:58:00 -->\talice (a@host) has joined #chan",
+			"Dec 31 23:59:00 <@alice>\thello there",
+			"Jan 01 00:00:10 *\talice waves",
+			"Jan 01 00:01:00 -bob/#chan-\ta notice",
+			"Jan 01 00:02:00 <--\tbob (b@host) has left #chan (later)",
+			"Jan 01 00:03:00 <--\tcarol has quit (Quit: bye)",
+			"Jan 01 00:04:00 <--\talice has kicked eve from #chan (out)",
+			"Jan 01 00:05:00 ---\talice has changed the topic to: new topic",
+			"Jan 01 00:06:00 ---\talice is now known as alice2",
+			"Jan 01 00:07:00 ---\tChanServ gives channel operator status to alice2",
+		},
+		entries: []string{
+			"2013-12-31T23:58:00/1s JOIN alice!a@host",
+			"2013-12-31T23:59:00/1s PRIVMSG alice :hello there",
+			"2014-01-01T00:00:10/1s ACTION alice :waves",
+			"2014-01-01T00:01:00/1s NOTICE bob :a notice",
+			"2014-01-01T00:02:00/1s PART bob!b@host :later",
+			"2014-01-01T00:03:00/1s QUIT carol :Quit: bye",
+			"2014-01-01T00:04:00/1s KICK alice target=eve :out",
+			"2014-01-01T00:05:00/1s TOPIC alice :new topic",
+			"2014-01-01T00:06:00/1s NICK alice :alice2",
+		},
+	},
+	{
+		format: FORMAT_EGGDROP,
+		date:   time.Date(2014, 3, 1, 0, 0, 0, 0, time.UTC),
+		lines: []string{
+			"[11:58] alice (a@host) joined #chan.",
+			"[11:59] <alice> hello there",
+			"[11:59:10] Action: alice waves",
+			"[12:00] -bob (b@host)- a notice",
+			"[12:00:30] -bob (b@host):#chan- to the channel",
+			"[12:01] bob (b@host) left #chan (later).",
+			"[12:01:30] dave (d@host) left #chan.",
+			"[12:02] carol (c@host) left irc: Quit: bye",
+			"[12:03] eve kicked from #chan by alice: out",
+			"[12:04] Topic changed on #chan by alice!a@host: new topic",
+			"[12:05] Nick change: alice -> alice2",
+			"[12:06] #chan: mode change '+o alice2' by ChanServ!s@services",
+			"[00:00] --- Sun Mar  2 2014",
+			"[00:01] <alice2> tomorrow",
+		},
+		entries: []string{
+			"2014-03-01T11:58:00/1m0s JOIN alice!a@host",
+			"2014-03-01T11:59:00/1m0s PRIVMSG alice :hello there",
+			"2014-03-01T11:59:10/1s ACTION alice :waves",
+			"2014-03-01T12:00:00/1m0s NOTICE bob!b@host :a notice",
+			"2014-03-01T12:00:30/1s NOTICE bob!b@host :to the channel",
+			"2014-03-01T12:01:00/1m0s PART bob!b@host :later",
+			"2014-03-01T12:01:30/1s PART dave!d@host",
+			"2014-03-01T12:02:00/1m0s QUIT carol!c@host :Quit: bye",
+			"2014-03-01T12:03:00/1m0s KICK alice target=eve :out",
+			"2014-03-01T12:04:00/1m0s TOPIC alice!a@host :new topic",
+			"2014-03-01T12:05:00/1m0s NICK alice :alice2",
+			"2014-03-02T00:01:00/1m0s PRIVMSG alice2 :tomorrow",
+		},
+	},
+}
+
+func TestParsers(t *testing.T) {
+	for _, tt := range parserTests {
+		c := &clock{loc: time.UTC}
+		if !tt.date.IsZero() {
+			c.setDate(tt.date.Date())
+		}
+		p, err := newParser(tt.format, c)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		entries := make([]string, 0)
+		for _, line := range tt.lines {
+			e, ok, err := p.Line(line)
+			if err != nil {
+				t.Errorf("%s: %q: %s", tt.format, line, err)
+			} else if ok {
+				entries = append(entries, entryLine(e))
+			}
+		}
+		if !reflect.DeepEqual(entries, tt.entries) {
+			t.Errorf("%s: parsed\n%s\nwant\n%s", tt.format, strings.Join(entries, "\n"), strings.Join(tt.entries, "\n"))
+		}
+	}
+}
+
+// formats which only have times on their lines can't do anything until they know the day
+func TestParsersNeedADate(t *testing.T) {
+	lines := map[string]string{
+		FORMAT_IRSSI:   "11:59 <alice> hello",
+		FORMAT_ZNC:     "[11:59:00] <alice> hello",
+		FORMAT_HEXCHAT: "Mar 01 11:59:00 <alice>\thello",
+		FORMAT_EGGDROP: "[11:59] <alice> hello",
+	}
+	for format, line := range lines {
+		p, err := newParser(format, &clock{loc: time.UTC})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, _, err := p.Line(line); err != errNoDate {
+			t.Errorf("%s: %v, want %v", format, err, errNoDate)
+		}
+	}
+	if _, err := newParser("mirc", &clock{loc: time.UTC}); err == nil {
+		t.Error("mirc isn't a format we know")
+	}
+}
+
+func TestParserLocation(t *testing.T) {
+	loc := time.FixedZone("UTC+5", 5*60*60)
+	p, _ := newParser(FORMAT_WEECHAT, &clock{loc: loc})
+	e, ok, err := p.Line("2014-03-01 02:00:00\talice\tearly")
+	if err != nil || !ok {
+		t.Fatalf("%v %v", ok, err)
+	}
+	if want := time.Date(2014, 2, 28, 21, 0, 0, 0, time.UTC); !e.Message.Time.Equal(want) {
+		t.Errorf("%s, want %s", e.Message.Time.UTC(), want)
+	}
+}
@@ -0,0 +1,174 @@
+// Package importer reads logs other clients wrote - irssi, weechat, ZNC, HexChat and eggdrop -
+// into a channel's logs. Anything already there is left alone, so running an import twice, or
+// over days the logger was around for, doesn't double anything up.
+package importer
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"github.com/lukegb/irclogsme"
+	"github.com/lukegb/irclogsme/logger"
+	"io"
+	"labix.org/v2/mgo/bson"
+	"log"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+// how many unreadable lines we complain about before going quiet
+const MAX_REPORTED_LINES = 10
+
+var errCantDedupe = errors.New("this database can't list a day's logs, so imports into it can't be deduplicated")
+
+// dayReader is the part of logger.Expirer we need to see what's there already
+type dayReader interface {
+	DayMessages(networkId bson.ObjectId, channel string, splitDate string) ([]irclogsme.LogMessage, error)
+}
+
+type Options struct {
+	Format string
+	// Location is the zone the log's times are in, which needn't be the one the channel's
+	// days are split in
+	Location *time.Location
+	// Date is the day the log starts on, for logs which don't say. If it's zero, a date in
+	// FileName is used - ZNC and eggdrop both put one there.
+	Date     time.Time
+	FileName string
+	DryRun   bool
+}
+
+type Result struct {
+	Lines int
+	// Skipped is lines which weren't messages, or which we couldn't read
+	Skipped    int
+	Imported   int
+	Duplicates int
+}
+
+var fileDateRegexp = regexp.MustCompile(`(\d{4})-?(\d{2})-?(\d{2})`)
+
+// dateFromFileName finds the last date in name: #chan_20060102.log, 2006-01-02.log, #chan.log.20060102
+func dateFromFileName(name string, loc *time.Location) (time.Time, bool) {
+	all := fileDateRegexp.FindAllStringSubmatch(filepath.Base(name), -1)
+	if len(all) == 0 {
+		return time.Time{}, false
+	}
+	m := all[len(all)-1]
+	year, _ := strconv.Atoi(m[1])
+	month, _ := strconv.Atoi(m[2])
+	day, _ := strconv.Atoi(m[3])
+	if month < 1 || month > 12 || day < 1 || day > 31 {
+		return time.Time{}, false
+	}
+	return time.Date(year, time.Month(month), day, 0, 0, 0, 0, loc), true
+}
+
+// key is what makes two messages the same, to the nearest precision
+func key(msg irclogsme.LogMessage, precision time.Duration) string {
+	return fmt.Sprintf("%d %d %s %q %q", msg.Time.Truncate(precision).Unix(), msg.Type, msg.Nick, msg.Data.Text, msg.Data.Target)
+}
+
+// existing counts the messages already logged on one day. It's a count, not a set - a channel
+// can see "lol" from the same nick twice in a minute, and then the log will have both.
+type existing struct {
+	splitDate string
+	messages  []irclogsme.LogMessage
+	counts    map[string]int
+	precision time.Duration
+}
+
+// take uses up a logged copy of msg, returning false if there are none left
+func (e *existing) take(msg irclogsme.LogMessage, precision time.Duration) bool {
+	if e.counts == nil || e.precision != precision {
+		e.precision = precision
+		e.counts = make(map[string]int)
+		for _, logged := range e.messages {
+			logged.Upgrade()
+			e.counts[key(logged, precision)]++
+		}
+	}
+	k := key(msg, precision)
+	if e.counts[k] == 0 {
+		return false
+	}
+	e.counts[k]--
+	return true
+}
+
+// Import reads one log from r into channel on netConf, skipping anything already logged
+func Import(db logger.Database, netConf irclogsme.NetworkConfig, channel string, r io.Reader, opts Options) (Result, error) {
+	var res Result
+	days, ok := db.(dayReader)
+	if !ok {
+		return res, errCantDedupe
+	}
+
+	loc := opts.Location
+	if loc == nil {
+		loc = netConf.LocationFor(channel)
+	}
+	c := &clock{loc: loc}
+	if !opts.Date.IsZero() {
+		c.setDate(opts.Date.Date())
+	} else if date, ok := dateFromFileName(opts.FileName, loc); ok {
+		c.setDate(date.Date())
+	}
+	p, err := newParser(opts.Format, c)
+	if err != nil {
+		return res, err
+	}
+
+	splitLoc := netConf.LocationFor(channel)
+	// stored under the configured spelling, like the logger does
+	channel, _ = netConf.FindChannel(channel)
+
+	// logs run in order, so only the day we're on needs remembering
+	var day *existing
+	bad := 0
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		res.Lines++
+		entry, ok, err := p.Line(scanner.Text())
+		if err == errNoDate {
+			return res, fmt.Errorf("line %d: %s", res.Lines, err.Error())
+		} else if err != nil {
+			res.Skipped++
+			if bad++; bad <= MAX_REPORTED_LINES {
+				log.Printf("import: skipping line %d: %s", res.Lines, err.Error())
+			}
+			continue
+		} else if !ok {
+			res.Skipped++
+			continue
+		}
+
+		msg := entry.Message
+		msg.NetworkId = netConf.Id
+		msg.Channel = channel
+		msg.SplitDate = irclogsme.SplitDate(msg.Time, splitLoc)
+
+		if day == nil || day.splitDate != msg.SplitDate {
+			logged, err := days.DayMessages(netConf.Id, channel, msg.SplitDate)
+			if err != nil {
+				return res, err
+			}
+			day = &existing{splitDate: msg.SplitDate, messages: logged}
+		}
+		if day.take(msg, entry.Precision) {
+			res.Duplicates++
+			continue
+		}
+
+		if !opts.DryRun {
+			if err := db.LogMessage(msg); err != nil {
+				return res, fmt.Errorf("line %d: %s", res.Lines, err.Error())
+			}
+		}
+		res.Imported++
+	}
+	return res, scanner.Err()
+}
@@ -0,0 +1,151 @@
+package importer
+
+import (
+	"github.com/lukegb/irclogsme"
+	"github.com/lukegb/irclogsme/logger"
+	"labix.org/v2/mgo/bson"
+	"strings"
+	"testing"
+	"time"
+)
+
+var importNetwork = irclogsme.NetworkConfig{
+	Id:       bson.ObjectIdHex("53114a000000000000000002"),
+	Name:     "examplenet",
+	Timezone: "UTC",
+}
+
+var fileNameTests = []struct {
+	name string
+	date string
+}{
+	{"#chan_20140301.log", "2014-03-01"},
+	{"2014-03-01.log", "2014-03-01"},
+	{"/logs/2013/#chan.log.20140301", "2014-03-01"},
+	{"2013-12-31_to_2014-03-01.log", "2014-03-01"},
+	{"/logs/2014-03-01/#chan.log", ""},
+	{"#chan.log", ""},
+	{"#chan_20141301.log", ""},
+}
+
+func TestDateFromFileName(t *testing.T) {
+	for _, tt := range fileNameTests {
+		date, ok := dateFromFileName(tt.name, time.UTC)
+		got := ""
+		if ok {
+			got = date.Format("2006-01-02")
+		}
+		if got != tt.date {
+			t.Errorf("dateFromFileName(%q) = %q, want %q", tt.name, got, tt.date)
+		}
+	}
+}
+
+// logged is what the logger itself saw on 2014-03-01, to the second
+func logged(db *logger.MockDatabase, lines ...string) {
+	for _, line := range lines {
+		bits := strings.SplitN(line, " ", 3)
+		t, _ := time.Parse("15:04:05", bits[0])
+		db.LogMessage(irclogsme.LogMessage{
+			Type:      irclogsme.LMT_PRIVMSG,
+			NetworkId: importNetwork.Id,
+			Channel:   "#chan",
+			Time:      time.Date(2014, 3, 1, t.Hour(), t.Minute(), t.Second(), 0, time.UTC),
+			SplitDate: "2014-03-01",
+			Nick:      bits[1],
+			Data:      irclogsme.TextPayload(bits[2]),
+		})
+	}
+}
+
+var dedupeTests = []struct {
+	name   string
+	logged []string
+	format string
+	log    string
+	result Result
+}{
+	{
+		name:   "nothing logged yet",
+		format: FORMAT_ZNC,
+		log:    "[12:00:00] <alice> hi\n[12:00:01] *** ChanServ sets mode: +o alice\n[12:00:02] <bob> hello",
+		result: Result{Lines: 3, Skipped: 1, Imported: 2},
+	},
+	{
+		name:   "the same second",
+		logged: []string{"12:00:00 alice hi", "12:00:02 bob hello"},
+		format: FORMAT_ZNC,
+		log:    "[12:00:00] <alice> hi\n[12:00:01] <alice> new\n[12:00:02] <bob> hello",
+		result: Result{Lines: 3, Imported: 1, Duplicates: 2},
+	},
+	{
+		name:   "a different second isn't the same message",
+		logged: []string{"12:00:00 alice hi"},
+		format: FORMAT_ZNC,
+		log:    "[12:00:01] <alice> hi",
+		result: Result{Lines: 1, Imported: 1},
+	},
+	{
+		name:   "minutes match anything in that minute",
+		logged: []string{"12:00:42 alice hi", "12:01:05 alice hi"},
+		format: FORMAT_IRSSI,
+		log:    "--- Log opened Sat Mar 01 12:00:00 2014\n12:00 <alice> hi\n12:01 <alice> hi\n12:02 <alice> hi",
+		result: Result{Lines: 4, Skipped: 1, Imported: 1, Duplicates: 2},
+	},
+	{
+		name:   "repeats are counted, not collapsed",
+		logged: []string{"12:00:00 alice lol"},
+		format: FORMAT_ZNC,
+		log:    "[12:00:00] <alice> lol\n[12:00:00] <alice> lol",
+		result: Result{Lines: 2, Imported: 1, Duplicates: 1},
+	},
+	{
+		name:   "other days aren't looked at",
+		logged: []string{"12:00:00 alice hi"},
+		format: FORMAT_WEECHAT,
+		log:    "2014-03-02 12:00:00\talice\thi",
+		result: Result{Lines: 1, Imported: 1},
+	},
+}
+
+func TestImportDedupe(t *testing.T) {
+	for _, tt := range dedupeTests {
+		db := logger.NewMockDatabase()
+		logged(db, tt.logged...)
+		opts := Options{Format: tt.format, Location: time.UTC, FileName: "#chan_20140301.log"}
+		res, err := Import(db, importNetwork, "#chan", strings.NewReader(tt.log), opts)
+		if err != nil {
+			t.Errorf("%s: %s", tt.name, err)
+			continue
+		}
+		if res != tt.result {
+			t.Errorf("%s: %+v, want %+v", tt.name, res, tt.result)
+		}
+		if n := len(db.Messages()); n != len(tt.logged)+res.Imported {
+			t.Errorf("%s: %d messages in the database, want %d", tt.name, n, len(tt.logged)+res.Imported)
+		}
+
+		// and a second time round, everything's already there
+		again, err := Import(db, importNetwork, "#chan", strings.NewReader(tt.log), opts)
+		if err != nil {
+			t.Errorf("%s: again: %s", tt.name, err)
+		} else if again.Imported != 0 || again.Duplicates != tt.result.Imported+tt.result.Duplicates {
+			t.Errorf("%s: again: %+v", tt.name, again)
+		}
+	}
+}
+
+func TestImportDryRun(t *testing.T) {
+	db := logger.NewMockDatabase()
+	res, err := Import(db, importNetwork, "#CHAN", strings.NewReader("[12:00:00] <alice> hi"), Options{Format: FORMAT_ZNC, Date: time.Date(2014, 3, 1, 0, 0, 0, 0, time.UTC), DryRun: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Imported != 1 || len(db.Messages()) != 0 {
+		t.Errorf("%+v, with %d messages written", res, len(db.Messages()))
+	}
+
+	if _, err := Import(db, importNetwork, "#chan", strings.NewReader("[12:00:00] <alice> hi"), Options{Format: FORMAT_ZNC}); err == nil {
+		t.Error("no date from anywhere, but no error")
+	}
+}
@@ -0,0 +1,85 @@
+package indexes
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/lukegb/irclogsme"
+	"io"
+	"labix.org/v2/mgo"
+	"labix.org/v2/mgo/bson"
+	"sort"
+	"time"
+)
+
+type namedQuery struct {
+	Name  string
+	Query *mgo.Query
+}
+
+// standardQueries are the queries the API makes, as the server's mongo store makes them
+func standardQueries(db *mgo.Database, net irclogsme.NetworkConfig, channel, date string, lastLog irclogsme.LogMessage) []namedQuery {
+	logs := db.C("logs")
+	// search for something that's there
+	word := "the"
+	if words := irclogsme.SearchWords(lastLog.Data.Text); len(words) > 0 {
+		word = words[0]
+	}
+	return []namedQuery{
+		{"network by name", db.C("networks").Find(bson.M{"name": net.Name})},
+		{"channel dates", logs.Find(bson.M{"networkid": net.Id, "channel": channel}).Select(bson.M{"splitdate": 1})},
+		{"day logs", logs.Find(bson.M{"networkid": net.Id, "channel": channel, "splitdate": date}).Sort("time")},
+		{"logs between", logs.Find(bson.M{"networkid": net.Id, "channel": channel, "time": bson.M{"$gte": lastLog.Time.Add(-time.Hour), "$lt": lastLog.Time}}).Sort("time")},
+		{"live tail", logs.Find(bson.M{"networkid": net.Id, "channel": channel, "time": bson.M{"$gt": lastLog.Time}}).Sort("time")},
+		{"log by id", logs.Find(bson.M{"_id": lastLog.Id})},
+		{"page of logs", logs.Find(bson.M{"networkid": net.Id, "channel": channel, "$or": []bson.M{{"time": bson.M{"$lt": lastLog.Time}}, {"time": lastLog.Time, "_id": bson.M{"$lt": lastLog.Id}}}}).Sort("-time", "-_id").Limit(101)},
+		{"search", logs.Find(bson.M{"networkid": net.Id, "channel": channel, "$text": bson.M{"$search": `"` + word + `"`}}).Sort("-time", "-_id").Limit(5001)},
+	}
+}
+
+// Explain prints the query plan of each standard query against one channel. If networkName or
+// channel are empty the first ones we find are used; if date is, the latest day with logs is.
+func Explain(db *mgo.Database, w io.Writer, networkName, channel, date string) error {
+	var net irclogsme.NetworkConfig
+	q := db.C("networks").Find(bson.M{})
+	if networkName != "" {
+		q = db.C("networks").Find(bson.M{"name": networkName})
+	}
+	if err := q.One(&net); err != nil {
+		return err
+	}
+
+	if channel == "" {
+		channels := make([]string, 0, len(net.Channels))
+		for name := range net.Channels {
+			channels = append(channels, name)
+		}
+		if len(channels) == 0 {
+			return errors.New("network " + net.Name + " has no channels")
+		}
+		sort.Strings(channels)
+		channel = channels[0]
+	}
+
+	var lastLog irclogsme.LogMessage
+	if err := db.C("logs").Find(bson.M{"networkid": net.Id, "channel": channel}).Sort("-time").One(&lastLog); err != nil && err != mgo.ErrNotFound {
+		return err
+	}
+	if date == "" {
+		date = lastLog.SplitDate
+	}
+
+	fmt.Fprintf(w, "explaining queries for %s %s on %s\n", net.Name, channel, date)
+	for _, sq := range standardQueries(db, net, channel, date, lastLog) {
+		var plan bson.M
+		if err := sq.Query.Explain(&plan); err != nil {
+			return fmt.Errorf("explaining %s: %s", sq.Name, err.Error())
+		}
+		out, err := json.MarshalIndent(plan, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "\n== %s\n%s\n", sq.Name, out)
+	}
+	return nil
+}
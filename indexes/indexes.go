@@ -0,0 +1,169 @@
+// Package indexes knows which MongoDB indexes irclogsme's queries need, creates them, and
+// complains about ones nobody uses.
+package indexes
+
+import (
+	"fmt"
+	"labix.org/v2/mgo"
+	"strings"
+)
+
+// Wanted is every index irclogsme uses, by collection. If you add a query, add its index here.
+var Wanted = map[string][]mgo.Index{
+	"logs": {
+		// a day's logs, the list of days (distinct splitdate) and counting a channel
+		{Key: []string{"networkid", "channel", "splitdate", "time"}},
+		// live tail, time ranges and search
+		{Key: []string{"networkid", "channel", "time"}},
+		// reprocessing deletes what it's about to rebuild
+		{Key: []string{"networkid", "time", "rawid"}},
+		// search's text, payload until the typed payload migration has run
+		{Key: []string{"networkid", "channel", "$text:data.text", "$text:payload"}},
+	},
+	"raw_lines": {
+		{Key: []string{"networkid", "time"}},
+		{Key: []string{"networkid", "command", "time"}},
+	},
+	"command_queue": {
+		{Key: []string{"complete"}},
+	},
+	"networks": {
+		{Key: []string{"name"}, Unique: true},
+	},
+}
+
+// which collections each program reads or writes
+var (
+	LOGGER_COLLECTIONS = []string{"logs", "raw_lines", "command_queue", "networks"}
+	SERVER_COLLECTIONS = []string{"logs", "networks"}
+)
+
+const (
+	PROBLEM_MISSING   = "missing"
+	PROBLEM_REDUNDANT = "redundant"
+	PROBLEM_UNKNOWN   = "unknown"
+)
+
+type Report struct {
+	Collection string
+	Name       string
+	Key        []string
+	Problem    string
+	Detail     string
+}
+
+func (r Report) String() string {
+	s := fmt.Sprintf("%s: %s index {%s}", r.Collection, r.Problem, strings.Join(r.Key, ", "))
+	if r.Name != "" {
+		s += " (" + r.Name + ")"
+	}
+	if r.Detail != "" {
+		s += " - " + r.Detail
+	}
+	return s
+}
+
+func sameKey(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// storedKey is key the way mongo hands it back from Indexes: a text index's fields all go into
+// one _fts and _ftsx pair
+func storedKey(key []string) []string {
+	stored := make([]string, 0, len(key))
+	text := false
+	for _, field := range key {
+		if !strings.HasPrefix(field, "$text:") {
+			stored = append(stored, field)
+		} else if !text {
+			stored = append(stored, "$text:_fts", "_ftsx")
+			text = true
+		}
+	}
+	return stored
+}
+
+// isPrefix is true if a is a strict prefix of b, in which case anything a does b does too
+func isPrefix(a, b []string) bool {
+	return len(a) < len(b) && sameKey(a, b[:len(a)])
+}
+
+// Check compares what's in the database against Wanted for the given collections
+func Check(db *mgo.Database, collections []string) ([]Report, error) {
+	reports := make([]Report, 0)
+	for _, collection := range collections {
+		existing, err := db.C(collection).Indexes()
+		if err != nil {
+			return nil, err
+		}
+
+		for _, want := range Wanted[collection] {
+			found := false
+			for _, have := range existing {
+				if sameKey(storedKey(want.Key), have.Key) {
+					found = true
+					break
+				}
+			}
+			if !found {
+				reports = append(reports, Report{Collection: collection, Key: want.Key, Problem: PROBLEM_MISSING})
+			}
+		}
+
+	existingLoop:
+		for _, have := range existing {
+			if have.Name == "_id_" {
+				continue
+			}
+			for _, want := range Wanted[collection] {
+				if sameKey(storedKey(want.Key), have.Key) {
+					continue existingLoop
+				}
+			}
+			r := Report{Collection: collection, Name: have.Name, Key: have.Key, Problem: PROBLEM_UNKNOWN, Detail: "not used by irclogsme"}
+			for _, other := range existing {
+				if isPrefix(have.Key, other.Key) {
+					r.Problem = PROBLEM_REDUNDANT
+					r.Detail = "covered by " + other.Name
+					break
+				}
+			}
+			reports = append(reports, r)
+		}
+	}
+	return reports, nil
+}
+
+// Ensure creates any missing indexes for the given collections and reports anything odd
+// through logf. Indexes are built in the background so a big collection doesn't lock up.
+func Ensure(db *mgo.Database, collections []string, logf func(format string, args ...interface{})) error {
+	reports, err := Check(db, collections)
+	if err != nil {
+		return err
+	}
+	for _, r := range reports {
+		logf("indexes: %s", r)
+		if r.Problem != PROBLEM_MISSING {
+			continue
+		}
+		for _, want := range Wanted[r.Collection] {
+			if !sameKey(want.Key, r.Key) {
+				continue
+			}
+			want.Background = true
+			if err := db.C(r.Collection).EnsureIndex(want); err != nil {
+				return fmt.Errorf("indexes: creating %s {%s}: %s", r.Collection, strings.Join(r.Key, ", "), err.Error())
+			}
+			logf("indexes: created %s {%s}", r.Collection, strings.Join(r.Key, ", "))
+		}
+	}
+	return nil
+}
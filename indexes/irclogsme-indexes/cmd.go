@@ -0,0 +1,7 @@
+package main
+
+import "github.com/lukegb/irclogsme/indexes"
+
+func main() {
+	indexes.Start()
+}
@@ -0,0 +1,61 @@
+package indexes
+
+import (
+	"flag"
+	"github.com/lukegb/irclogsme/config"
+	"labix.org/v2/mgo"
+	"log"
+	"os"
+)
+
+// every collection we want indexes on
+var ALL_COLLECTIONS = []string{"logs", "raw_lines", "command_queue", "networks"}
+
+// Start runs the irclogsme-indexes command. Its flags live in here rather than at package level
+// because the logger and server import this package and have flags of their own.
+func Start() {
+	var (
+		ensure  = flag.Bool("ensure", false, "create any missing indexes")
+		explain = flag.Bool("explain", true, "print query plans for the standard API queries")
+		network = flag.String("network", "", "network to explain queries against - defaults to the first one")
+		channel = flag.String("channel", "", "channel to explain queries against - defaults to the network's first")
+		date    = flag.String("date", "", "day to explain queries against - defaults to the channel's latest")
+	)
+	loader := config.NewLoader(flag.CommandLine, config.DB)
+	loader.Schemes = []string{"mongodb"}
+	flag.Parse()
+	settings, err := loader.Load(config.Settings{DBConnString: "mongodb://localhost/irclogsme"})
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	dbc, err := mgo.Dial(settings.DBConnString)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	defer dbc.Close()
+	db := dbc.DB("")
+
+	if *ensure {
+		if err := Ensure(db, ALL_COLLECTIONS, log.Printf); err != nil {
+			log.Fatalln(err)
+		}
+	} else {
+		reports, err := Check(db, ALL_COLLECTIONS)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		for _, r := range reports {
+			log.Println(r)
+		}
+		if len(reports) == 0 {
+			log.Println("indexes look fine")
+		}
+	}
+
+	if *explain {
+		if err := Explain(db, os.Stdout, *network, *channel, *date); err != nil {
+			log.Fatalln(err)
+		}
+	}
+}
@@ -0,0 +1,197 @@
+package logger
+
+import (
+	"errors"
+	"fmt"
+	"github.com/lukegb/irclogsme"
+	"github.com/lukegb/irclogsme/indexes"
+	"github.com/lukegb/irclogsme/migrations"
+	"github.com/lukegb/irclogsme/sqldb"
+	"labix.org/v2/mgo/bson"
+	"sort"
+)
+
+// Admin is implemented by databases whose networks and command queue can be changed from
+// outside the logger, by irclogsme-admin
+type Admin interface {
+	// Networks is every network, by name - unlike GetConfig it's happy with none
+	Networks() ([]irclogsme.NetworkConfig, error)
+	// SaveNetwork adds a network if it's got no id, or replaces the one with its id
+	SaveNetwork(net irclogsme.NetworkConfig) (irclogsme.NetworkConfig, error)
+	EnqueueCommand(cmd irclogsme.CommandMessage) (irclogsme.CommandMessage, error)
+}
+
+// Maintainer is implemented by databases with upkeep irclogsme-admin can run
+type Maintainer interface {
+	// Migrate brings the database up to target, or the latest version if target is 0
+	Migrate(target int, dryRun bool) error
+	Reindex() error
+}
+
+type networksByName []irclogsme.NetworkConfig
+
+func (n networksByName) Len() int           { return len(n) }
+func (n networksByName) Less(i, j int) bool { return n[i].Name < n[j].Name }
+func (n networksByName) Swap(i, j int)      { n[i], n[j] = n[j], n[i] }
+
+func (m *MongoDatabase) Networks() ([]irclogsme.NetworkConfig, error) {
+	if err := m.validateSelf(); err != nil {
+		return nil, err
+	}
+
+	nets := make([]irclogsme.NetworkConfig, 0)
+	err := m.connection.DB("").C("networks").Find(bson.M{}).Sort("name").All(&nets)
+	return nets, err
+}
+
+func (m *MongoDatabase) SaveNetwork(net irclogsme.NetworkConfig) (irclogsme.NetworkConfig, error) {
+	if err := m.validateSelf(); err != nil {
+		return net, err
+	}
+
+	if net.Id == "" {
+		net.Id = bson.NewObjectId()
+	}
+	LogDebug("mongodb: saving network %s", net.Name)
+	if _, err := m.connection.DB("").C("networks").UpsertId(net.Id, net); err != nil {
+		return net, err
+	}
+
+	// GetConfig wants exactly one of these, and a fresh database won't have it
+	configs := m.connection.DB("").C("config")
+	if count, err := configs.Count(); err != nil {
+		return net, err
+	} else if count == 0 {
+		if err := configs.Insert(bson.M{}); err != nil {
+			return net, err
+		}
+	}
+	return net, nil
+}
+
+func (m *MongoDatabase) EnqueueCommand(cmd irclogsme.CommandMessage) (irclogsme.CommandMessage, error) {
+	if err := m.validateSelf(); err != nil {
+		return cmd, err
+	}
+
+	if cmd.Id == "" {
+		cmd.Id = bson.NewObjectId()
+	}
+	LogDebug("mongodb: enqueueing command for %s", cmd.NetworkId.Hex())
+	err := m.connection.DB("").C("command_queue").Insert(cmd)
+	return cmd, err
+}
+
+func (m *MongoDatabase) Migrate(target int, dryRun bool) error {
+	if err := m.validateSelf(); err != nil {
+		return err
+	}
+
+	migrator := migrations.NewMigrator(m.connection.DB(""))
+	migrator.DryRun = dryRun
+	if target == 0 {
+		target = migrations.Latest()
+	}
+	return migrator.Run(target)
+}
+
+func (m *MongoDatabase) Reindex() error {
+	if err := m.validateSelf(); err != nil {
+		return err
+	}
+
+	return indexes.Ensure(m.connection.DB(""), indexes.ALL_COLLECTIONS, LogInfo)
+}
+
+func (s *SqlDatabase) Networks() ([]irclogsme.NetworkConfig, error) {
+	if err := s.validateSelf(); err != nil {
+		return nil, err
+	}
+	return s.db.Networks()
+}
+
+func (s *SqlDatabase) SaveNetwork(net irclogsme.NetworkConfig) (irclogsme.NetworkConfig, error) {
+	if err := s.validateSelf(); err != nil {
+		return net, err
+	}
+	LogDebug("sql: saving network %s", net.Name)
+	return s.db.SaveNetwork(net)
+}
+
+func (s *SqlDatabase) EnqueueCommand(cmd irclogsme.CommandMessage) (irclogsme.CommandMessage, error) {
+	if err := s.validateSelf(); err != nil {
+		return cmd, err
+	}
+	LogDebug("sql: enqueueing command for %s", cmd.NetworkId.Hex())
+	return s.db.InsertCommand(cmd)
+}
+
+// Migrate can't do much - connecting already brought the schema up to date
+func (s *SqlDatabase) Migrate(target int, dryRun bool) error {
+	if err := s.validateSelf(); err != nil {
+		return err
+	}
+	if target != 0 && target != sqldb.LatestSchema() {
+		return fmt.Errorf("sql: schemas only go to the latest version, %d", sqldb.LatestSchema())
+	}
+	version, err := s.db.SchemaVersion()
+	if err != nil {
+		return err
+	}
+	LogInfo("sql: schema is at version %d, the latest - it's upgraded whenever the database is opened", version)
+	return nil
+}
+
+func (s *SqlDatabase) Reindex() error {
+	if err := s.validateSelf(); err != nil {
+		return err
+	}
+	return s.db.Reindex()
+}
+
+func (m *MockDatabase) Networks() ([]irclogsme.NetworkConfig, error) {
+	if err := m.simulate(MOCK_OP_CONFIG); err != nil {
+		return nil, err
+	}
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	nets := make([]irclogsme.NetworkConfig, len(m.config.Networks))
+	copy(nets, m.config.Networks)
+	sort.Sort(networksByName(nets))
+	return nets, nil
+}
+
+func (m *MockDatabase) SaveNetwork(net irclogsme.NetworkConfig) (irclogsme.NetworkConfig, error) {
+	if err := m.simulate(MOCK_OP_CONFIG); err != nil {
+		return net, err
+	}
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if net.Id == "" {
+		net.Id = bson.NewObjectId()
+	}
+	for n, existing := range m.config.Networks {
+		if existing.Id == net.Id {
+			m.config.Networks[n] = net
+			return net, nil
+		}
+	}
+	m.config.Networks = append(m.config.Networks, net)
+	return net, nil
+}
+
+func (m *MockDatabase) EnqueueCommand(cmd irclogsme.CommandMessage) (irclogsme.CommandMessage, error) {
+	return m.Enqueue(cmd), nil
+}
+
+var errCantAdmin = errors.New("this database can't be changed by irclogsme-admin - edit its config by hand")
+
+// AdminFor is db's Admin, if it has one
+func AdminFor(db Database) (Admin, error) {
+	if admin, ok := db.(Admin); ok {
+		return admin, nil
+	}
+	return nil, errCantAdmin
+}
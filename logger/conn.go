@@ -0,0 +1,257 @@
+package logger
+
+import (
+	"bufio"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	IRC_DEFAULT_PORT = "6667"
+	IRC_DIAL_TIMEOUT = 30 * time.Second
+	// we PING the server this often, so a quiet channel still gets us something to read
+	IRC_PING_INTERVAL = 2 * time.Minute
+	// and if nothing at all turns up for this long, the connection's dead
+	IRC_READ_TIMEOUT  = 5 * time.Minute
+	IRC_WRITE_TIMEOUT = 30 * time.Second
+)
+
+// ircConn is our end of a connection to a server. It does just enough of the protocol to get
+// us registered - CAP negotiation, NICK/USER, PONGs - and hands every line it reads to
+// whichever handlers want it. "connected" fires on 001 and "disconnected" when the socket
+// goes away; "*" gets every line.
+type ircConn struct {
+	nick, user, realname string
+
+	handlers map[string][]func(*Line)
+
+	pingInterval, readTimeout time.Duration
+
+	lock sync.Mutex
+	sock net.Conn
+	// writeLock keeps lines whole without holding lock while we wait on the socket
+	writeLock  sync.Mutex
+	connected  bool
+	registered bool
+	tryNick    string
+	lsCaps     []string
+}
+
+func newIrcConn(nick, user, realname string) *ircConn {
+	return &ircConn{
+		nick:     nick,
+		user:     user,
+		realname: realname,
+		handlers: make(map[string][]func(*Line)),
+
+		pingInterval: IRC_PING_INTERVAL,
+		readTimeout:  IRC_READ_TIMEOUT,
+	}
+}
+
+// AddHandler is only safe before Connect
+func (c *ircConn) AddHandler(cmd string, f func(*Line)) {
+	c.handlers[cmd] = append(c.handlers[cmd], f)
+}
+
+func (c *ircConn) Connected() bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.connected
+}
+
+// Connect dials host (port 6667 if it doesn't say) and starts registering. Everything after
+// that happens on the connection's own goroutine.
+func (c *ircConn) Connect(host string) error {
+	if _, _, err := net.SplitHostPort(host); err != nil {
+		host = net.JoinHostPort(host, IRC_DEFAULT_PORT)
+	}
+	sock, err := net.DialTimeout("tcp", host, IRC_DIAL_TIMEOUT)
+	if err != nil {
+		return err
+	}
+
+	c.lock.Lock()
+	c.sock = sock
+	c.connected = true
+	c.registered = false
+	c.tryNick = c.nick
+	c.lsCaps = nil
+	c.lock.Unlock()
+
+	done := make(chan bool)
+	go c.readLoop(sock, done)
+	go c.pingLoop(done)
+
+	// CAP LS first so the server holds off registering us until we say CAP END
+	c.Raw("CAP LS 302")
+	c.Raw("NICK " + c.nick)
+	c.Raw("USER " + c.user + " 0 * :" + c.realname)
+	return nil
+}
+
+// Raw sends a line straight out - flood control is the send queue's job
+func (c *ircConn) Raw(line string) {
+	c.lock.Lock()
+	sock := c.sock
+	c.lock.Unlock()
+	if sock == nil {
+		return
+	}
+	c.writeLock.Lock()
+	defer c.writeLock.Unlock()
+	sock.SetWriteDeadline(time.Now().Add(IRC_WRITE_TIMEOUT))
+	if _, err := sock.Write([]byte(line + "\r\n")); err != nil {
+		// the read loop will notice
+		sock.Close()
+	}
+}
+
+func (c *ircConn) Quit(message string) {
+	c.Raw("QUIT :" + message)
+}
+
+// pingLoop keeps something coming back from the server until done is closed
+func (c *ircConn) pingLoop(done chan bool) {
+	ticker := time.NewTicker(c.pingInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			c.Raw("PING :irclogsme")
+		}
+	}
+}
+
+func (c *ircConn) readLoop(sock net.Conn, done chan bool) {
+	defer close(done)
+	r := bufio.NewReaderSize(sock, 8192)
+	for {
+		sock.SetReadDeadline(time.Now().Add(c.readTimeout))
+		s, err := r.ReadString('\n')
+		if err != nil {
+			break
+		}
+		if strings.TrimSpace(s) == "" {
+			continue
+		}
+		line, err := parseLine(s, time.Time{})
+		if err != nil {
+			continue
+		}
+		c.handle(line)
+	}
+
+	sock.Close()
+	c.lock.Lock()
+	// we might have reconnected already, in which case this one going away isn't news
+	current := c.sock == sock
+	if current {
+		c.sock = nil
+		c.connected = false
+	}
+	c.lock.Unlock()
+	if current {
+		c.event("disconnected")
+	}
+}
+
+func (c *ircConn) handle(line *Line) {
+	switch line.Cmd {
+	case "PING":
+		if len(line.Args) > 0 {
+			c.Raw("PONG :" + line.Args[0])
+		} else {
+			c.Raw("PONG")
+		}
+	case "CAP":
+		c.negotiate(line)
+	case "433", "436":
+		// nick in use before we've even got in - have another go with a different one
+		c.lock.Lock()
+		retry := !c.registered
+		if retry {
+			c.tryNick += "_"
+		}
+		nick := c.tryNick
+		c.lock.Unlock()
+		if retry {
+			c.Raw("NICK " + nick)
+		}
+	case "001":
+		c.lock.Lock()
+		c.registered = true
+		c.lock.Unlock()
+	}
+
+	c.dispatch(line)
+	if line.Cmd == "001" {
+		c.event("connected")
+	}
+}
+
+// negotiate asks for whichever of WANTED_CAPS the server has, then lets registration finish
+func (c *ircConn) negotiate(line *Line) {
+	if len(line.Args) < 2 {
+		return
+	}
+	switch line.Args[1] {
+	case "LS":
+		c.lock.Lock()
+		c.lsCaps = append(c.lsCaps, capsFromLine(line)...)
+		// CAP * LS * :more to come
+		more := len(line.Args) > 3 && line.Args[2] == "*"
+		offered := c.lsCaps
+		registered := c.registered
+		c.lock.Unlock()
+		if more || registered {
+			return
+		}
+
+		wanted := make([]string, 0, len(WANTED_CAPS))
+		for _, capability := range offered {
+			// 302 servers say cap=value
+			if eq := strings.IndexByte(capability, '='); eq != -1 {
+				capability = capability[:eq]
+			}
+			for _, want := range WANTED_CAPS {
+				if capability == want {
+					wanted = append(wanted, want)
+				}
+			}
+		}
+		if len(wanted) == 0 {
+			c.Raw("CAP END")
+			return
+		}
+		c.Raw("CAP REQ :" + strings.Join(wanted, " "))
+	case "ACK", "NAK":
+		c.lock.Lock()
+		registered := c.registered
+		c.lock.Unlock()
+		if !registered {
+			c.Raw("CAP END")
+		}
+	}
+}
+
+// event fires one of our own events - these never go to "*", they didn't come from the server
+func (c *ircConn) event(name string) {
+	line := &Line{Cmd: name, Time: time.Now(), Tags: make(map[string]string)}
+	for _, f := range c.handlers[name] {
+		f(line)
+	}
+}
+
+func (c *ircConn) dispatch(line *Line) {
+	for _, f := range c.handlers[line.Cmd] {
+		f(line)
+	}
+	for _, f := range c.handlers["*"] {
+		f(line)
+	}
+}
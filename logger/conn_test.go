@@ -0,0 +1,164 @@
+package logger
+
+import (
+	"bufio"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeServer answers registration the way a CAP 302 server with a busy nick would, then sends
+// lines and hangs up. It returns everything the client sent.
+func fakeServer(t *testing.T, ln net.Listener, lines []string) chan []string {
+	sent := make(chan []string, 1)
+	go func() {
+		var got []string
+		defer func() { sent <- got }()
+		c, err := ln.Accept()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer c.Close()
+		r := bufio.NewReader(c)
+		w := func(s string) { c.Write([]byte(s + "\r\n")) }
+		for {
+			s, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			s = strings.TrimRight(s, "\r\n")
+			got = append(got, s)
+			switch {
+			case s == "CAP LS 302":
+				w(":srv CAP * LS * :multi-prefix account-tag sasl=PLAIN")
+				w(":srv CAP * LS :message-tags extended-join")
+			case strings.HasPrefix(s, "CAP REQ :"):
+				w(":srv CAP * ACK :" + s[len("CAP REQ :"):])
+			case s == "NICK bot":
+				w(":srv 433 * bot :Nickname is already in use")
+			case s == "CAP END":
+				w(":srv 001 bot_ :welcome")
+				w("PING :srv")
+			case s == "PONG :srv":
+				for _, line := range lines {
+					w(line)
+				}
+				return
+			}
+		}
+	}()
+	return sent
+}
+
+func TestIrcConnRegisters(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	sent := fakeServer(t, ln, []string{
+		`@account=alice;msgid=a\sb :alice!a@host PRIVMSG #chan :` + "\001ACTION waves\001",
+	})
+
+	conn := newIrcConn("bot", "user", "real name")
+	events := make(chan string, 10)
+	conn.AddHandler("connected", func(line *Line) { events <- "connected" })
+	conn.AddHandler("disconnected", func(line *Line) { events <- "disconnected" })
+	conn.AddHandler("ACTION", func(line *Line) {
+		events <- strings.Join([]string{line.Tags["account"], line.Tags["msgid"], line.Nick, line.Args[0], line.Args[1]}, "|")
+	})
+	if err := conn.Connect(ln.Addr().String()); err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	timeout := time.After(5 * time.Second)
+	for len(got) < 3 {
+		select {
+		case e := <-events:
+			got = append(got, e)
+		case <-timeout:
+			t.Fatalf("timed out, got %q", got)
+		}
+	}
+	want := []string{"connected", "alice|a b|alice|#chan|waves", "disconnected"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("events %q, want %q", got, want)
+	}
+	if conn.Connected() {
+		t.Error("still connected after the server hung up")
+	}
+
+	// CAP LS goes before NICK/USER, and CAP END only once we've asked for what's on offer
+	wantSent := []string{
+		"CAP LS 302",
+		"NICK bot",
+		"USER user 0 * :real name",
+		"CAP REQ :account-tag message-tags extended-join",
+		"NICK bot_",
+		"CAP END",
+		"PONG :srv",
+	}
+	if s := <-sent; !reflect.DeepEqual(s, wantSent) {
+		t.Errorf("client sent %q, want %q", s, wantSent)
+	}
+}
+
+func TestIrcConnTimesOut(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	// a server that lets us in, then never says anything again but doesn't hang up either
+	pinged := make(chan bool, 1)
+	go func() {
+		c, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer c.Close()
+		r := bufio.NewReader(c)
+		for {
+			s, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			switch s = strings.TrimRight(s, "\r\n"); {
+			case strings.HasPrefix(s, "USER "):
+				c.Write([]byte(":srv 001 bot :welcome\r\n"))
+			case strings.HasPrefix(s, "PING "):
+				select {
+				case pinged <- true:
+				default:
+				}
+			}
+		}
+	}()
+
+	conn := newIrcConn("bot", "user", "real name")
+	conn.pingInterval, conn.readTimeout = 50*time.Millisecond, 200*time.Millisecond
+	disconnected := make(chan bool, 1)
+	conn.AddHandler("disconnected", func(line *Line) { disconnected <- true })
+	if err := conn.Connect(ln.Addr().String()); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case <-pinged:
+	case <-time.After(5 * time.Second):
+		t.Fatal("never PINGed the server")
+	}
+	select {
+	case <-disconnected:
+	case <-time.After(5 * time.Second):
+		t.Fatal("still waiting on a server that's gone quiet")
+	}
+	if conn.Connected() {
+		t.Error("still connected after timing out")
+	}
+}
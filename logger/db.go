@@ -3,9 +3,12 @@ package logger
 import (
 	"errors"
 	"github.com/lukegb/irclogsme"
+	"github.com/lukegb/irclogsme/indexes"
 	"labix.org/v2/mgo"
 	"labix.org/v2/mgo/bson"
 	"regexp"
+	"sort"
+	"time"
 )
 
 type Database interface {
@@ -31,9 +34,13 @@ func DbConnect(dbConnString string) (Database, error) {
 	dbp := submatches[1]
 	var db Database
 	if dbp == "mock" {
-		db = new(MockDatabase)
+		db = NewMockDatabase()
 	} else if dbp == "mongodb" {
 		db = new(MongoDatabase)
+	} else if dbp == "sqlite" || dbp == "postgres" || dbp == "postgresql" {
+		db = new(SqlDatabase)
+	} else if dbp == "file" {
+		db = new(FileDatabase)
 	} else {
 		return nil, errors.New(`no such database provider ` + dbp)
 	}
@@ -58,6 +65,11 @@ func (m *MongoDatabase) Connect(connString string) error {
 		return err
 	}
 
+	// not fatal - everything works without them, just slowly
+	if err := indexes.Ensure(m.connection.DB(""), indexes.LOGGER_COLLECTIONS, LogInfo); err != nil {
+		LogError("mongodb: couldn't check indexes - %s", err.Error())
+	}
+
 	return nil
 }
 
@@ -114,8 +126,13 @@ func (m *MongoDatabase) LogMessage(message irclogsme.LogMessage) error {
 	if err := m.validateSelf(); err != nil {
 		return err
 	}
+	if err := message.Validate(); err != nil {
+		return err
+	}
 
-	message.SplitDate = message.Time.Format("2006-01-02")
+	if message.SplitDate == "" {
+		message.SplitDate = irclogsme.SplitDate(message.Time, time.Local)
+	}
 
 	LogDebug("mongodb: logging message - %s", message)
 	if err := m.connection.DB("").C("logs").Insert(message); err != nil {
@@ -154,27 +171,110 @@ func (m *MongoDatabase) CommandComplete(cmdMsg irclogsme.CommandMessage) error {
 	return nil
 }
 
-type MockDatabase struct {
+func (m *MongoDatabase) ArchiveRawLine(line irclogsme.RawLine) error {
+	if err := m.validateSelf(); err != nil {
+		return err
+	}
+
+	return m.connection.DB("").C("raw_lines").Insert(line)
 }
 
-func (m *MockDatabase) Connect(connString string) error {
-	LogDebug("mockdb: connecting")
-	return nil
+func (m *MongoDatabase) LastRawCommandBefore(networkId bson.ObjectId, command string, before time.Time) (time.Time, error) {
+	if err := m.validateSelf(); err != nil {
+		return time.Time{}, err
+	}
+
+	var line irclogsme.RawLine
+	err := m.connection.DB("").C("raw_lines").Find(bson.M{"networkid": networkId, "command": command, "time": bson.M{"$lt": before}}).Sort("-time").One(&line)
+	if err == mgo.ErrNotFound {
+		return time.Time{}, nil
+	} else if err != nil {
+		return time.Time{}, err
+	}
+	return line.Time, nil
+}
+
+func (m *MongoDatabase) EachRawLine(networkId bson.ObjectId, from, to time.Time, f func(irclogsme.RawLine) error) error {
+	if err := m.validateSelf(); err != nil {
+		return err
+	}
+
+	LogDebug("mongodb: fetching raw lines from %s to %s", from, to)
+	i := m.connection.DB("").C("raw_lines").Find(bson.M{"networkid": networkId, "time": bson.M{"$gte": from, "$lt": to}}).Sort("time", "_id").Iter()
+	var line irclogsme.RawLine
+	for i.Next(&line) {
+		if err := f(line); err != nil {
+			i.Close()
+			return err
+		}
+	}
+	return i.Close()
 }
 
-func (m *MockDatabase) GetConfig() (irclogsme.Config, error) {
-	LogDebug("mockdb: fetching config")
-	return irclogsme.Config{}, nil
+func (m *MongoDatabase) RawLogMessageIds(networkId bson.ObjectId, from, to time.Time) ([]bson.ObjectId, error) {
+	if err := m.validateSelf(); err != nil {
+		return nil, err
+	}
+
+	LogDebug("mongodb: listing reprocessable messages from %s to %s", from, to)
+	i := m.connection.DB("").C("logs").Find(bson.M{"networkid": networkId, "time": bson.M{"$gte": from, "$lt": to}, "rawid": bson.M{"$exists": true}}).Select(bson.M{"_id": 1}).Iter()
+	ids := make([]bson.ObjectId, 0)
+	var doc struct {
+		Id bson.ObjectId `bson:"_id"`
+	}
+	for i.Next(&doc) {
+		ids = append(ids, doc.Id)
+	}
+	return ids, i.Close()
 }
 
-func (m *MockDatabase) LogMessage(message irclogsme.LogMessage) error {
+func (m *MongoDatabase) DeleteLogMessages(ids []bson.ObjectId) error {
+	if err := m.validateSelf(); err != nil {
+		return err
+	}
+
+	LogDebug("mongodb: removing %d messages", len(ids))
+	for len(ids) > 0 {
+		batch := ids
+		if len(batch) > DELETE_BATCH_SIZE {
+			batch = batch[:DELETE_BATCH_SIZE]
+		}
+		if _, err := m.connection.DB("").C("logs").RemoveAll(bson.M{"_id": bson.M{"$in": batch}}); err != nil {
+			return err
+		}
+		ids = ids[len(batch):]
+	}
 	return nil
 }
 
-func (m *MockDatabase) FetchPendingCommands() ([]irclogsme.CommandMessage, error) {
-	return make([]irclogsme.CommandMessage, 0), nil
+func (m *MongoDatabase) ExpiredDays(networkId bson.ObjectId, channel string, cutoff string) ([]string, error) {
+	if err := m.validateSelf(); err != nil {
+		return nil, err
+	}
+
+	var dates []string
+	err := m.connection.DB("").C("logs").Find(bson.M{"networkid": networkId, "channel": channel, "splitdate": bson.M{"$lt": cutoff}}).Distinct("splitdate", &dates)
+	sort.Strings(dates)
+	return dates, err
 }
 
-func (m *MockDatabase) CommandComplete(cmdMsg irclogsme.CommandMessage) error {
-	return nil
+func (m *MongoDatabase) DayMessages(networkId bson.ObjectId, channel string, splitDate string) ([]irclogsme.LogMessage, error) {
+	if err := m.validateSelf(); err != nil {
+		return nil, err
+	}
+
+	var msgs []irclogsme.LogMessage
+	err := m.connection.DB("").C("logs").Find(bson.M{"networkid": networkId, "channel": channel, "splitdate": splitDate}).Sort("time").All(&msgs)
+	irclogsme.UpgradeAll(msgs)
+	return msgs, err
+}
+
+func (m *MongoDatabase) DeleteDay(networkId bson.ObjectId, channel string, splitDate string) error {
+	if err := m.validateSelf(); err != nil {
+		return err
+	}
+
+	LogDebug("mongodb: deleting %s on %s", channel, splitDate)
+	_, err := m.connection.DB("").C("logs").RemoveAll(bson.M{"networkid": networkId, "channel": channel, "splitdate": splitDate})
+	return err
 }
@@ -0,0 +1,249 @@
+package logger
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/lukegb/irclogsme"
+	"github.com/lukegb/irclogsme/archive"
+	"github.com/lukegb/irclogsme/textformat"
+	"io/ioutil"
+	"labix.org/v2/mgo/bson"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const (
+	FILE_FSYNC_ALWAYS   = "always"
+	FILE_FSYNC_INTERVAL = "interval"
+	FILE_FSYNC_NEVER    = "never"
+
+	FILE_FSYNC_PERIOD = 5 * time.Second
+	FILE_CONFIG_NAME  = "config.json"
+)
+
+// FileDatabase writes flat text logs, one file per network, channel and day:
+//
+//	file:///var/log/irclogs?format=irssi&fsync=interval&config=/etc/irclogsme.json
+//
+// ends up as /var/log/irclogs/<network>/<channel>/<date>.log. format is irssi (the default),
+// weechat or znc. fsync is always, interval (every FILE_FSYNC_PERIOD, the default) or never
+// (only when a file is rotated). There's nowhere to keep config, so it comes from config (default <dir>/config.json), which
+// holds an irclogsme.Config as JSON. There's no command queue either.
+type FileDatabase struct {
+	lock sync.Mutex
+
+	dir        string
+	configFile string
+	format     textformat.Format
+	fsync      string
+
+	networks map[bson.ObjectId]irclogsme.NetworkConfig
+	open     map[string]*logFile // keyed on network id + channel
+}
+
+// logFile is the file we're currently writing for one channel
+type logFile struct {
+	f         *os.File
+	splitDate string
+	dirty     bool
+}
+
+func (fdb *FileDatabase) Connect(connString string) error {
+	LogDebug("file: connecting")
+
+	u, err := url.Parse(connString)
+	if err != nil {
+		return err
+	}
+	q := u.Query()
+
+	fdb.dir = u.Host + u.Path
+	if fdb.dir == "" {
+		return errors.New(`file: no directory in connection string`)
+	}
+	if err := os.MkdirAll(fdb.dir, 0755); err != nil {
+		return err
+	}
+
+	formatName := q.Get("format")
+	if formatName == "" {
+		formatName = textformat.IRSSI
+	}
+	format, ok := textformat.FORMATS[formatName]
+	if !ok {
+		return errors.New(`file: no such format ` + formatName)
+	}
+	fdb.format = format
+
+	fdb.fsync = q.Get("fsync")
+	switch fdb.fsync {
+	case "":
+		fdb.fsync = FILE_FSYNC_INTERVAL
+	case FILE_FSYNC_ALWAYS, FILE_FSYNC_INTERVAL, FILE_FSYNC_NEVER:
+	default:
+		return errors.New(`file: fsync must be always, interval or never, not ` + fdb.fsync)
+	}
+
+	fdb.configFile = q.Get("config")
+	if fdb.configFile == "" {
+		fdb.configFile = filepath.Join(fdb.dir, FILE_CONFIG_NAME)
+	}
+
+	fdb.networks = make(map[bson.ObjectId]irclogsme.NetworkConfig)
+	fdb.open = make(map[string]*logFile)
+
+	if fdb.fsync == FILE_FSYNC_INTERVAL {
+		go func() {
+			for _ = range time.Tick(FILE_FSYNC_PERIOD) {
+				fdb.syncAll()
+			}
+		}()
+	}
+	return nil
+}
+
+func (fdb *FileDatabase) validateSelf() error {
+	if fdb.open == nil {
+		return errors.New(`file: not connected`)
+	}
+	return nil
+}
+
+func (fdb *FileDatabase) GetConfig() (irclogsme.Config, error) {
+	var c irclogsme.Config
+
+	if err := fdb.validateSelf(); err != nil {
+		return c, err
+	}
+
+	LogDebug("file: loading config from %s", fdb.configFile)
+	b, err := ioutil.ReadFile(fdb.configFile)
+	if err != nil {
+		return c, err
+	}
+	if err := json.Unmarshal(b, &c); err != nil {
+		return c, fmt.Errorf("file: bad config %s - %s", fdb.configFile, err.Error())
+	}
+	if len(c.Networks) == 0 {
+		return c, errors.New(`file: no networks in ` + fdb.configFile)
+	}
+
+	fdb.lock.Lock()
+	defer fdb.lock.Unlock()
+	for i := range c.Networks {
+		net := &c.Networks[i]
+		if net.Id == "" {
+			// nothing outside this process sees these, they just tie messages to networks
+			net.Id = bson.NewObjectId()
+		}
+		fdb.networks[net.Id] = *net
+		LogDebug(" - loaded network: %s - servers are %s (connecting as %s!%s)", net.Name, net.IrcServers, net.Nick, net.User)
+	}
+	return c, nil
+}
+
+// fileFor returns the file message belongs in, rotating if its SplitDate has moved on
+func (fdb *FileDatabase) fileFor(message irclogsme.LogMessage) (*logFile, error) {
+	key := string(message.NetworkId) + message.Channel
+	lf := fdb.open[key]
+	if lf != nil && lf.splitDate == message.SplitDate {
+		return lf, nil
+	}
+	if lf != nil {
+		LogDebug("file: rotating %s on %s", message.Channel, message.SplitDate)
+		lf.close()
+		delete(fdb.open, key)
+	}
+
+	network := fdb.networks[message.NetworkId]
+	dir := filepath.Join(fdb.dir, archive.PathSafe(network.Name), archive.PathSafe(message.Channel))
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(filepath.Join(dir, message.SplitDate+".log"), os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	lf = &logFile{f: f, splitDate: message.SplitDate}
+	if fdb.format.Opened != nil {
+		if _, err := f.WriteString(fdb.format.Opened(message.Time) + "\n"); err != nil {
+			f.Close()
+			return nil, err
+		}
+	}
+	fdb.open[key] = lf
+	return lf, nil
+}
+
+func (lf *logFile) close() {
+	if lf.dirty {
+		lf.f.Sync()
+	}
+	lf.f.Close()
+}
+
+func (fdb *FileDatabase) syncAll() {
+	fdb.lock.Lock()
+	defer fdb.lock.Unlock()
+	for _, lf := range fdb.open {
+		if !lf.dirty {
+			continue
+		}
+		if err := lf.f.Sync(); err != nil {
+			LogError("file: fsync %s failed - %s", lf.f.Name(), err.Error())
+			continue
+		}
+		lf.dirty = false
+	}
+}
+
+func (fdb *FileDatabase) LogMessage(message irclogsme.LogMessage) error {
+	if err := fdb.validateSelf(); err != nil {
+		return err
+	}
+	if err := message.Validate(); err != nil {
+		return err
+	}
+
+	fdb.lock.Lock()
+	defer fdb.lock.Unlock()
+
+	network, ok := fdb.networks[message.NetworkId]
+	if !ok {
+		return errors.New(`file: message for unknown network ` + message.NetworkId.Hex())
+	}
+	// the file's times are in the same zone as its day
+	loc := network.LocationFor(message.Channel)
+	message.Time = message.Time.In(loc)
+	if message.SplitDate == "" {
+		message.SplitDate = irclogsme.SplitDate(message.Time, loc)
+	}
+
+	lf, err := fdb.fileFor(message)
+	if err != nil {
+		return err
+	}
+	if _, err := lf.f.WriteString(fdb.format.Line(message) + "\n"); err != nil {
+		return err
+	}
+	lf.dirty = true
+	if fdb.fsync == FILE_FSYNC_ALWAYS {
+		if err := lf.f.Sync(); err != nil {
+			return err
+		}
+		lf.dirty = false
+	}
+	return nil
+}
+
+func (fdb *FileDatabase) FetchPendingCommands() ([]irclogsme.CommandMessage, error) {
+	return make([]irclogsme.CommandMessage, 0), nil
+}
+
+func (fdb *FileDatabase) CommandComplete(cmdMsg irclogsme.CommandMessage) error {
+	return nil
+}
@@ -0,0 +1,91 @@
+package logger
+
+import (
+	"strings"
+	"sync"
+)
+
+// the IRCv3 capabilities we'd like - we only ask for the ones the server's CAP LS offered, as
+// servers NAK the whole lot if any are missing
+var WANTED_CAPS = []string{
+	"account-tag",
+	"extended-join",
+	"account-notify",
+	"message-tags",
+}
+
+// tags which carry a reply reference, newest spelling first
+var replyTags = []string{"+reply", "+draft/reply"}
+
+// accountTracker remembers which services account each nick is logged in as,
+// fed by extended-join and account-notify
+type accountTracker struct {
+	sync.Mutex
+	accounts map[string]string
+}
+
+func newAccountTracker() *accountTracker {
+	return &accountTracker{accounts: make(map[string]string)}
+}
+
+func (a *accountTracker) Set(nick, account string) {
+	a.Lock()
+	defer a.Unlock()
+	if account == "" || account == "*" {
+		delete(a.accounts, nick)
+	} else {
+		a.accounts[nick] = account
+	}
+}
+
+func (a *accountTracker) Get(nick string) string {
+	a.Lock()
+	defer a.Unlock()
+	return a.accounts[nick]
+}
+
+func (a *accountTracker) Rename(oldNick, newNick string) {
+	a.Lock()
+	defer a.Unlock()
+	if account, ok := a.accounts[oldNick]; ok {
+		delete(a.accounts, oldNick)
+		a.accounts[newNick] = account
+	}
+}
+
+func (a *accountTracker) Forget(nick string) {
+	a.Lock()
+	defer a.Unlock()
+	delete(a.accounts, nick)
+}
+
+func (a *accountTracker) Wipe() {
+	a.Lock()
+	defer a.Unlock()
+	a.accounts = make(map[string]string)
+}
+
+// accountFor prefers the account-tag on the line itself, falling back to what we've tracked
+func (a *accountTracker) accountFor(line *Line) string {
+	if account, ok := line.Tags["account"]; ok && account != "*" {
+		return account
+	}
+	return a.Get(line.Nick)
+}
+
+func lineReplyTo(line *Line) string {
+	for _, tag := range replyTags {
+		if reply, ok := line.Tags[tag]; ok {
+			return reply
+		}
+	}
+	return ""
+}
+
+// capsFromLine picks the capability list out of a CAP reply
+func capsFromLine(line *Line) []string {
+	if len(line.Args) < 3 {
+		return nil
+	}
+	return strings.Fields(line.Args[len(line.Args)-1])
+}
@@ -0,0 +1,134 @@
+package logger
+
+import (
+	"github.com/lukegb/irclogsme"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ISupport holds what the network told us about itself in RPL_ISUPPORT (005)
+type ISupport struct {
+	sync.Mutex
+
+	chanTypes   string
+	caseMapping string
+	targMax     map[string]int
+	prefixes    string
+}
+
+// the nick prefixes we strip from NAMES if PREFIX doesn't say otherwise
+const DEFAULT_PREFIXES = "~&@%+"
+
+func NewISupport(netConf irclogsme.NetworkConfig) *ISupport {
+	i := new(ISupport)
+	i.Reset(netConf)
+	return i
+}
+
+// Reset goes back to the configured values, for when we reconnect
+func (i *ISupport) Reset(netConf irclogsme.NetworkConfig) {
+	i.Lock()
+	defer i.Unlock()
+	i.chanTypes = netConf.ChannelTypes()
+	i.caseMapping = netConf.ChannelCaseMapping()
+	i.targMax = make(map[string]int)
+	i.prefixes = DEFAULT_PREFIXES
+}
+
+// Parse eats the tokens of one 005 line: "nick TOKEN TOKEN=value ... :are supported by this server"
+func (i *ISupport) Parse(args []string) {
+	if len(args) < 2 {
+		return
+	}
+	i.Lock()
+	defer i.Unlock()
+	for _, token := range args[1 : len(args)-1] {
+		key, value := token, ""
+		if eq := strings.IndexByte(token, '='); eq != -1 {
+			key, value = token[:eq], token[eq+1:]
+		}
+		switch key {
+		case "CHANTYPES":
+			i.chanTypes = value
+		case "-CHANTYPES":
+			i.chanTypes = irclogsme.DEFAULT_CHANTYPES
+		case "CASEMAPPING":
+			if irclogsme.ValidCaseMapping(value) {
+				i.caseMapping = value
+			} else {
+				LogError("unknown CASEMAPPING %s - sticking with %s", value, i.caseMapping)
+			}
+		case "TARGMAX":
+			i.targMax = parseTargMax(value)
+		case "-TARGMAX":
+			i.targMax = make(map[string]int)
+		case "PREFIX":
+			// (ov)@+
+			if close := strings.IndexByte(value, ')'); close != -1 {
+				i.prefixes = value[close+1:]
+			} else {
+				i.prefixes = ""
+			}
+		case "-PREFIX":
+			i.prefixes = DEFAULT_PREFIXES
+		}
+	}
+}
+
+// parseTargMax turns "JOIN:,PRIVMSG:4" into a map; 0 means no limit
+func parseTargMax(value string) map[string]int {
+	targMax := make(map[string]int)
+	for _, item := range strings.Split(value, ",") {
+		colon := strings.IndexByte(item, ':')
+		if colon == -1 {
+			continue
+		}
+		limit := 0
+		if item[colon+1:] != "" {
+			var err error
+			if limit, err = strconv.Atoi(item[colon+1:]); err != nil {
+				continue
+			}
+		}
+		targMax[strings.ToUpper(item[:colon])] = limit
+	}
+	return targMax
+}
+
+func (i *ISupport) IsChannel(name string) bool {
+	i.Lock()
+	defer i.Unlock()
+	return irclogsme.IsChannelName(i.chanTypes, name)
+}
+
+func (i *ISupport) Fold(name string) string {
+	i.Lock()
+	defer i.Unlock()
+	return irclogsme.FoldName(i.caseMapping, name)
+}
+
+// StripPrefixes takes the @ and + (and friends) off a name from RPL_NAMREPLY
+func (i *ISupport) StripPrefixes(name string) string {
+	i.Lock()
+	defer i.Unlock()
+	for len(name) > 0 && strings.IndexByte(i.prefixes, name[0]) != -1 {
+		name = name[1:]
+	}
+	return name
+}
+
+func (i *ISupport) CaseMapping() string {
+	i.Lock()
+	defer i.Unlock()
+	return i.caseMapping
+}
+
+// TargetLimit is how many targets a command may take at once; 0 means unlimited.
+// ok is false if the server didn't mention the command at all.
+func (i *ISupport) TargetLimit(command string) (limit int, ok bool) {
+	i.Lock()
+	defer i.Unlock()
+	limit, ok = i.targMax[command]
+	return
+}
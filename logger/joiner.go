@@ -0,0 +1,300 @@
+package logger
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// RFC1459 gives us 512 bytes including the CRLF; leave a little slack for servers that count oddly
+	JOIN_MAX_LINE        = 500
+	JOIN_DEFAULT_TARGETS = 10
+
+	JOIN_TICK            = 250 * time.Millisecond
+	JOIN_DELAY_MIN       = 500 * time.Millisecond
+	JOIN_DELAY_MAX       = 30 * time.Second
+	JOIN_CONFIRM_TIMEOUT = 60 * time.Second
+
+	JOIN_BACKOFF_MIN = 30 * time.Second
+	JOIN_BACKOFF_MAX = 30 * time.Minute
+)
+
+type joinState struct {
+	channel string
+	key     string
+
+	joined   bool
+	attempts int
+	nextTry  time.Time
+
+	lastError string
+}
+
+type joinBatch struct {
+	line     string
+	channels []string
+}
+
+// JoinFailure is a channel we can't get into, for reporting
+type JoinFailure struct {
+	Channel   string    `json:"channel"`
+	Attempts  int       `json:"attempts"`
+	LastError string    `json:"last_error"`
+	NextTry   time.Time `json:"next_try"`
+}
+
+// channelJoiner keeps us in the channels we're meant to be logging, sending
+// batched JOINs and backing off from channels which won't have us
+type channelJoiner struct {
+	sync.Mutex
+
+	netName  string
+	isupport *ISupport
+	send     func(line string)
+
+	channels  map[string]*joinState // keyed by folded name
+	connected bool
+	delay     time.Duration
+	lastSend  time.Time
+}
+
+func newChannelJoiner(netName string, isupport *ISupport, send func(string)) *channelJoiner {
+	j := &channelJoiner{
+		netName:  netName,
+		isupport: isupport,
+		send:     send,
+		channels: make(map[string]*joinState),
+		delay:    JOIN_DELAY_MIN,
+	}
+	go j.run()
+	return j
+}
+
+// Want adds a channel to the set we should be in
+func (j *channelJoiner) Want(channel, key string) {
+	j.Lock()
+	defer j.Unlock()
+	folded := j.isupport.Fold(channel)
+	if st, ok := j.channels[folded]; ok {
+		st.key = key
+		return
+	}
+	j.channels[folded] = &joinState{channel: channel, key: key}
+}
+
+func (j *channelJoiner) Unwant(channel string) {
+	j.Lock()
+	defer j.Unlock()
+	delete(j.channels, j.isupport.Fold(channel))
+}
+
+// Channels is everything we're meant to be logging, folded
+func (j *channelJoiner) Channels() []string {
+	j.Lock()
+	defer j.Unlock()
+	res := make([]string, 0, len(j.channels))
+	for folded := range j.channels {
+		res = append(res, folded)
+	}
+	sort.Strings(res)
+	return res
+}
+
+func (j *channelJoiner) Connected() {
+	j.Lock()
+	defer j.Unlock()
+	j.connected = true
+	j.delay = JOIN_DELAY_MIN
+	for _, st := range j.channels {
+		st.joined = false
+		st.attempts = 0
+		st.nextTry = time.Time{}
+		st.lastError = ""
+	}
+}
+
+func (j *channelJoiner) Disconnected() {
+	j.Lock()
+	defer j.Unlock()
+	j.connected = false
+}
+
+// Joined is called when we see our own JOIN come back
+func (j *channelJoiner) Joined(channel string) {
+	j.Lock()
+	defer j.Unlock()
+	st, ok := j.channels[j.isupport.Fold(channel)]
+	if !ok {
+		return
+	}
+	if st.attempts > 1 {
+		LogInfo("(%s) finally joined %s after %d attempts", j.netName, channel, st.attempts)
+	}
+	st.joined = true
+	st.attempts = 0
+	st.lastError = ""
+	// things are going well, speed up again
+	j.delay -= j.delay / 10
+	if j.delay < JOIN_DELAY_MIN {
+		j.delay = JOIN_DELAY_MIN
+	}
+}
+
+// Parted is called when we leave a channel we still want, e.g. on KICK
+func (j *channelJoiner) Parted(channel string) {
+	j.Lock()
+	defer j.Unlock()
+	if st, ok := j.channels[j.isupport.Fold(channel)]; ok {
+		st.joined = false
+		st.nextTry = time.Now().Add(JOIN_BACKOFF_MIN)
+	}
+}
+
+// Failed is called for the "cannot join" numerics
+func (j *channelJoiner) Failed(channel, reason string) {
+	j.Lock()
+	defer j.Unlock()
+	st, ok := j.channels[j.isupport.Fold(channel)]
+	if !ok {
+		return
+	}
+	backoff := JOIN_BACKOFF_MIN
+	for i := 1; i < st.attempts && backoff < JOIN_BACKOFF_MAX; i++ {
+		backoff *= 2
+	}
+	if backoff > JOIN_BACKOFF_MAX {
+		backoff = JOIN_BACKOFF_MAX
+	}
+	st.joined = false
+	st.lastError = reason
+	st.nextTry = time.Now().Add(backoff)
+	LogError("(%s) failed to join %s (attempt %d): %s - retrying in %s", j.netName, channel, st.attempts, reason, backoff)
+}
+
+// Throttled is called when the server tells us to slow down
+func (j *channelJoiner) Throttled(channel string) {
+	j.Lock()
+	defer j.Unlock()
+	j.delay *= 2
+	if j.delay > JOIN_DELAY_MAX {
+		j.delay = JOIN_DELAY_MAX
+	}
+	if st, ok := j.channels[j.isupport.Fold(channel)]; ok {
+		st.nextTry = time.Now().Add(j.delay)
+	}
+	LogInfo("(%s) server is throttling our joins, slowing down to one line per %s", j.netName, j.delay)
+}
+
+func (j *channelJoiner) Failures() []JoinFailure {
+	j.Lock()
+	defer j.Unlock()
+	res := make([]JoinFailure, 0)
+	for _, st := range j.channels {
+		if st.lastError != "" {
+			res = append(res, JoinFailure{Channel: st.channel, Attempts: st.attempts, LastError: st.lastError, NextTry: st.nextTry})
+		}
+	}
+	return res
+}
+
+func (j *channelJoiner) run() {
+	ticker := time.Tick(JOIN_TICK)
+	for {
+		<-ticker
+		j.tick(time.Now())
+	}
+}
+
+func (j *channelJoiner) tick(now time.Time) {
+	j.Lock()
+	defer j.Unlock()
+	if !j.connected || now.Sub(j.lastSend) < j.delay {
+		return
+	}
+
+	due := make([]*joinState, 0)
+	for _, st := range j.channels {
+		if !st.joined && !now.Before(st.nextTry) {
+			due = append(due, st)
+		}
+	}
+	if len(due) == 0 {
+		return
+	}
+
+	maxTargets, ok := j.isupport.TargetLimit("JOIN")
+	if !ok {
+		maxTargets = JOIN_DEFAULT_TARGETS
+	}
+	batches := buildJoinBatches(due, maxTargets)
+
+	// one line per tick - the delay does the rest
+	batch := batches[0]
+	for _, channel := range batch.channels {
+		st := j.channels[j.isupport.Fold(channel)]
+		st.attempts++
+		st.nextTry = now.Add(JOIN_CONFIRM_TIMEOUT)
+	}
+	LogDebug("(%s) joining %d channels: %s", j.netName, len(batch.channels), batch.line)
+	j.lastSend = now
+	j.send(batch.line)
+}
+
+// buildJoinBatches packs channels into as few JOIN lines as TARGMAX and the line length allow.
+// Keyed channels go first, as keys are matched to channels by position.
+func buildJoinBatches(due []*joinState, maxTargets int) []joinBatch {
+	sorted := make([]*joinState, len(due))
+	copy(sorted, due)
+	sort.Sort(byKeyThenName(sorted))
+
+	batches := make([]joinBatch, 0)
+	var channels, keys []string
+	flush := func() {
+		if len(channels) == 0 {
+			return
+		}
+		batches = append(batches, joinBatch{line: joinLine(channels, keys), channels: channels})
+		channels, keys = nil, nil
+	}
+	for _, st := range sorted {
+		if maxTargets > 0 && len(channels) >= maxTargets {
+			flush()
+		}
+		newKeys := keys
+		if st.key != "" {
+			newKeys = append(append([]string(nil), keys...), st.key)
+		}
+		if len(channels) > 0 && len(joinLine(append(channels, st.channel), newKeys)) > JOIN_MAX_LINE {
+			flush()
+			newKeys = nil
+			if st.key != "" {
+				newKeys = []string{st.key}
+			}
+		}
+		channels = append(channels, st.channel)
+		keys = newKeys
+	}
+	flush()
+	return batches
+}
+
+func joinLine(channels, keys []string) string {
+	line := "JOIN " + strings.Join(channels, ",")
+	if len(keys) > 0 {
+		line += " " + strings.Join(keys, ",")
+	}
+	return line
+}
+
+type byKeyThenName []*joinState
+
+func (b byKeyThenName) Len() int      { return len(b) }
+func (b byKeyThenName) Swap(i, j int) { b[i], b[j] = b[j], b[i] }
+func (b byKeyThenName) Less(i, j int) bool {
+	if (b[i].key != "") != (b[j].key != "") {
+		return b[i].key != ""
+	}
+	return b[i].channel < b[j].channel
+}
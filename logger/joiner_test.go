@@ -0,0 +1,94 @@
+package logger
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// longChannel is a 100 character channel name, so five of them won't fit on one JOIN
+func longChannel(c string) string {
+	return "#" + strings.Repeat(c, 99)
+}
+
+var joinBatchTests = []struct {
+	name       string
+	due        []*joinState
+	maxTargets int
+	lines      []string
+	channels   [][]string
+}{
+	{
+		name:  "nothing to join",
+		lines: []string{},
+	},
+	{
+		name:       "one line",
+		due:        []*joinState{{channel: "#c"}, {channel: "#a"}, {channel: "#b"}},
+		maxTargets: 10,
+		lines:      []string{"JOIN #a,#b,#c"},
+		channels:   [][]string{{"#a", "#b", "#c"}},
+	},
+	{
+		name:       "keyed channels first",
+		due:        []*joinState{{channel: "#a"}, {channel: "#c", key: "x"}, {channel: "#b", key: "k"}},
+		maxTargets: 10,
+		lines:      []string{"JOIN #b,#c,#a k,x"},
+		channels:   [][]string{{"#b", "#c", "#a"}},
+	},
+	{
+		name:       "TARGMAX",
+		due:        []*joinState{{channel: "#a"}, {channel: "#b"}, {channel: "#c"}, {channel: "#d"}, {channel: "#e", key: "k"}},
+		maxTargets: 2,
+		lines:      []string{"JOIN #e,#a k", "JOIN #b,#c", "JOIN #d"},
+		channels:   [][]string{{"#e", "#a"}, {"#b", "#c"}, {"#d"}},
+	},
+	{
+		name:       "no limit",
+		due:        []*joinState{{channel: "#a"}, {channel: "#b"}, {channel: "#c"}},
+		maxTargets: 0,
+		lines:      []string{"JOIN #a,#b,#c"},
+		channels:   [][]string{{"#a", "#b", "#c"}},
+	},
+	{
+		name:       "line length",
+		due:        []*joinState{{channel: longChannel("a")}, {channel: longChannel("b")}, {channel: longChannel("c")}, {channel: longChannel("d")}, {channel: longChannel("e")}},
+		maxTargets: 0,
+		lines: []string{
+			"JOIN " + strings.Join([]string{longChannel("a"), longChannel("b"), longChannel("c"), longChannel("d")}, ","),
+			"JOIN " + longChannel("e"),
+		},
+		channels: [][]string{{longChannel("a"), longChannel("b"), longChannel("c"), longChannel("d")}, {longChannel("e")}},
+	},
+	{
+		name:       "keys start again on a new line",
+		due:        []*joinState{{channel: longChannel("a"), key: "1"}, {channel: longChannel("b"), key: "2"}, {channel: longChannel("c"), key: "3"}, {channel: longChannel("d"), key: "4"}, {channel: longChannel("e"), key: "5"}},
+		maxTargets: 0,
+		lines: []string{
+			"JOIN " + strings.Join([]string{longChannel("a"), longChannel("b"), longChannel("c"), longChannel("d")}, ",") + " 1,2,3,4",
+			"JOIN " + longChannel("e") + " 5",
+		},
+		channels: [][]string{{longChannel("a"), longChannel("b"), longChannel("c"), longChannel("d")}, {longChannel("e")}},
+	},
+}
+
+func TestBuildJoinBatches(t *testing.T) {
+	for _, tt := range joinBatchTests {
+		batches := buildJoinBatches(tt.due, tt.maxTargets)
+		lines := make([]string, 0)
+		var channels [][]string
+		for _, b := range batches {
+			if len(b.line) > JOIN_MAX_LINE {
+				t.Errorf("%s: %d byte line", tt.name, len(b.line))
+			}
+			lines = append(lines, b.line)
+			channels = append(channels, b.channels)
+		}
+		if !reflect.DeepEqual(lines, tt.lines) {
+			t.Errorf("%s: lines %q, want %q", tt.name, lines, tt.lines)
+		}
+		if !reflect.DeepEqual(channels, tt.channels) {
+			t.Errorf("%s: channels %q, want %q", tt.name, channels, tt.channels)
+		}
+	}
+}
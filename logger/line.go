@@ -0,0 +1,143 @@
+package logger
+
+import (
+	"errors"
+	"strings"
+	"time"
+)
+
+var errEmptyLine = errors.New(`empty line`)
+
+// Line is one line from a server, split up. Tags are the IRCv3 message tags, unescaped; Raw is
+// the whole line, tags and all, as it came off the wire.
+type Line struct {
+	Tags                   map[string]string
+	Nick, Ident, Host, Src string
+	Cmd, Raw               string
+	Args                   []string
+	Time                   time.Time
+}
+
+func unescapeTagValue(v string) string {
+	if strings.IndexByte(v, '\\') == -1 {
+		return v
+	}
+	res := make([]byte, 0, len(v))
+	for i := 0; i < len(v); i++ {
+		if v[i] != '\\' {
+			res = append(res, v[i])
+			continue
+		}
+		i++
+		if i == len(v) {
+			break
+		}
+		switch v[i] {
+		case ':':
+			res = append(res, ';')
+		case 's':
+			res = append(res, ' ')
+		case 'r':
+			res = append(res, '\r')
+		case 'n':
+			res = append(res, '\n')
+		default:
+			res = append(res, v[i])
+		}
+	}
+	return string(res)
+}
+
+// parseLine splits up one line of IRC. A server-time tag beats t; lines with neither get now.
+func parseLine(s string, t time.Time) (*Line, error) {
+	s = strings.TrimRight(s, "\r\n")
+	line := &Line{Time: t, Tags: make(map[string]string), Raw: s}
+
+	if strings.HasPrefix(s, "@") {
+		sp := strings.IndexByte(s, ' ')
+		if sp == -1 {
+			return nil, errEmptyLine
+		}
+		for _, tag := range strings.Split(s[1:sp], ";") {
+			if eq := strings.IndexByte(tag, '='); eq != -1 {
+				line.Tags[tag[:eq]] = unescapeTagValue(tag[eq+1:])
+			} else if tag != "" {
+				line.Tags[tag] = ""
+			}
+		}
+		s = strings.TrimLeft(s[sp+1:], " ")
+	}
+	if serverTime, ok := line.Tags["time"]; ok {
+		if t, err := time.Parse(time.RFC3339Nano, serverTime); err == nil {
+			line.Time = t
+		}
+	}
+
+	if strings.HasPrefix(s, ":") {
+		sp := strings.IndexByte(s, ' ')
+		if sp == -1 {
+			return nil, errEmptyLine
+		}
+		line.Src = s[1:sp]
+		line.Nick = line.Src
+		if bang := strings.IndexByte(line.Src, '!'); bang != -1 {
+			line.Nick = line.Src[:bang]
+			line.Ident = line.Src[bang+1:]
+			if at := strings.IndexByte(line.Ident, '@'); at != -1 {
+				line.Host = line.Ident[at+1:]
+				line.Ident = line.Ident[:at]
+			}
+		} else if at := strings.IndexByte(line.Src, '@'); at != -1 {
+			line.Nick = line.Src[:at]
+			line.Host = line.Src[at+1:]
+		}
+		s = strings.TrimLeft(s[sp+1:], " ")
+	}
+
+	args := make([]string, 0)
+	for s != "" {
+		if s[0] == ':' {
+			args = append(args, s[1:])
+			break
+		}
+		sp := strings.IndexByte(s, ' ')
+		if sp == -1 {
+			args = append(args, s)
+			break
+		}
+		args = append(args, s[:sp])
+		s = strings.TrimLeft(s[sp+1:], " ")
+	}
+	if len(args) == 0 {
+		return nil, errEmptyLine
+	}
+	line.Cmd = strings.ToUpper(args[0])
+	line.Args = args[1:]
+
+	// CTCPs get their own commands, so ACTION has a handler of its own
+	if (line.Cmd == "PRIVMSG" || line.Cmd == "NOTICE") && len(line.Args) == 2 {
+		msg := line.Args[1]
+		if len(msg) > 2 && msg[0] == '\001' && msg[len(msg)-1] == '\001' {
+			msg = msg[1 : len(msg)-1]
+			ctcp, rest := msg, ""
+			if sp := strings.IndexByte(msg, ' '); sp != -1 {
+				ctcp, rest = msg[:sp], msg[sp+1:]
+			}
+			if ctcp == "ACTION" && line.Cmd == "PRIVMSG" {
+				line.Cmd = "ACTION"
+				line.Args = []string{line.Args[0], rest}
+			} else if line.Cmd == "PRIVMSG" {
+				line.Cmd = "CTCP"
+				line.Args = []string{ctcp, line.Args[0], rest}
+			} else {
+				line.Cmd = "CTCPREPLY"
+				line.Args = []string{ctcp, line.Args[0], rest}
+			}
+		}
+	}
+
+	if line.Time.IsZero() {
+		line.Time = time.Now()
+	}
+	return line, nil
+}
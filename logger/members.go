@@ -0,0 +1,77 @@
+package logger
+
+import (
+	"sort"
+	"sync"
+)
+
+// memberTracker knows who is in the channels we're in, so QUITs land in the right logs.
+// Everything is keyed by folded name.
+type memberTracker struct {
+	sync.Mutex
+	isupport *ISupport
+	channels map[string]map[string]bool
+}
+
+func newMemberTracker(isupport *ISupport) *memberTracker {
+	return &memberTracker{isupport: isupport, channels: make(map[string]map[string]bool)}
+}
+
+func (m *memberTracker) Wipe() {
+	m.Lock()
+	defer m.Unlock()
+	m.channels = make(map[string]map[string]bool)
+}
+
+func (m *memberTracker) Add(channel, nick string) {
+	m.Lock()
+	defer m.Unlock()
+	channel = m.isupport.Fold(channel)
+	if m.channels[channel] == nil {
+		m.channels[channel] = make(map[string]bool)
+	}
+	m.channels[channel][m.isupport.Fold(nick)] = true
+}
+
+func (m *memberTracker) Remove(channel, nick string) {
+	m.Lock()
+	defer m.Unlock()
+	if members, ok := m.channels[m.isupport.Fold(channel)]; ok {
+		delete(members, m.isupport.Fold(nick))
+	}
+}
+
+// DelChannel is for when we leave a channel ourselves
+func (m *memberTracker) DelChannel(channel string) {
+	m.Lock()
+	defer m.Unlock()
+	delete(m.channels, m.isupport.Fold(channel))
+}
+
+func (m *memberTracker) Rename(oldNick, newNick string) {
+	m.Lock()
+	defer m.Unlock()
+	oldNick, newNick = m.isupport.Fold(oldNick), m.isupport.Fold(newNick)
+	for _, members := range m.channels {
+		if members[oldNick] {
+			delete(members, oldNick)
+			members[newNick] = true
+		}
+	}
+}
+
+// Quit removes nick from everywhere, returning the channels they were in
+func (m *memberTracker) Quit(nick string) []string {
+	m.Lock()
+	defer m.Unlock()
+	nick = m.isupport.Fold(nick)
+	res := make([]string, 0)
+	for channel, members := range m.channels {
+		if members[nick] {
+			delete(members, nick)
+			res = append(res, channel)
+		}
+	}
+	sort.Strings(res)
+	return res
+}
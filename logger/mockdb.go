@@ -0,0 +1,373 @@
+package logger
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/lukegb/irclogsme"
+	"io/ioutil"
+	"labix.org/v2/mgo/bson"
+	"math/rand"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// the operations MockDatabase can be told to fail
+const (
+	MOCK_OP_CONFIG   = "config"
+	MOCK_OP_LOG      = "log"
+	MOCK_OP_FETCH    = "fetch"
+	MOCK_OP_COMPLETE = "complete"
+	MOCK_OP_EXPIRE   = "expire"
+)
+
+var errMockFailure = errors.New(`mockdb: simulated failure`)
+
+// mockFixture is what a fixture file (or the config= parameter) holds. Commands can name
+// their network instead of knowing its id.
+type mockFixture struct {
+	Networks []irclogsme.NetworkConfig
+	Commands []struct {
+		irclogsme.CommandMessage
+		Network string
+	}
+}
+
+// MockDatabase keeps everything in memory. Connect with
+//
+//	mock://                               no networks
+//	mock://path/to/fixture.json           networks and commands from a file
+//	mock://?config={"Networks":[...]}     ...or inline
+//
+// and add any of these to make it misbehave:
+//
+//	latency=50ms       every call takes this long
+//	fail_rate=0.25     calls fail this often
+//	fail_first=3       the first 3 calls fail
+//	fail=log,complete  only these operations fail (default all of them) - config, log,
+//	                   fetch, complete or expire
+type MockDatabase struct {
+	lock sync.Mutex
+
+	config    irclogsme.Config
+	messages  []irclogsme.LogMessage
+	commands  []irclogsme.CommandMessage
+	completed []irclogsme.CommandMessage
+
+	latency   time.Duration
+	failRate  float64
+	failFirst int
+	failOps   map[string]bool
+	failures  int
+	calls     int // of the operations which can fail
+}
+
+func NewMockDatabase() *MockDatabase {
+	return &MockDatabase{
+		messages:  make([]irclogsme.LogMessage, 0),
+		commands:  make([]irclogsme.CommandMessage, 0),
+		completed: make([]irclogsme.CommandMessage, 0),
+	}
+}
+
+func (m *MockDatabase) Connect(connString string) error {
+	LogDebug("mockdb: connecting")
+
+	u, err := url.Parse(connString)
+	if err != nil {
+		return err
+	}
+	q := u.Query()
+
+	if q.Get("latency") != "" {
+		if m.latency, err = time.ParseDuration(q.Get("latency")); err != nil {
+			return fmt.Errorf("mockdb: bad latency %s", q.Get("latency"))
+		}
+	}
+	if q.Get("fail_rate") != "" {
+		if m.failRate, err = strconv.ParseFloat(q.Get("fail_rate"), 64); err != nil || m.failRate < 0 || m.failRate > 1 {
+			return fmt.Errorf("mockdb: bad fail_rate %s", q.Get("fail_rate"))
+		}
+	}
+	if q.Get("fail_first") != "" {
+		if m.failFirst, err = strconv.Atoi(q.Get("fail_first")); err != nil {
+			return fmt.Errorf("mockdb: bad fail_first %s", q.Get("fail_first"))
+		}
+	}
+	if q.Get("fail") != "" {
+		m.failOps = make(map[string]bool)
+		for _, op := range strings.Split(q.Get("fail"), ",") {
+			m.failOps[op] = true
+		}
+	}
+
+	var fixture []byte
+	if path := u.Host + u.Path; path != "" {
+		LogDebug("mockdb: loading fixture %s", path)
+		if fixture, err = ioutil.ReadFile(path); err != nil {
+			return err
+		}
+	} else if q.Get("config") != "" {
+		fixture = []byte(q.Get("config"))
+	}
+	if fixture != nil {
+		return m.LoadFixture(fixture)
+	}
+	return nil
+}
+
+// LoadFixture replaces the config and pending commands with those in a JSON fixture
+func (m *MockDatabase) LoadFixture(fixture []byte) error {
+	var f mockFixture
+	if err := json.Unmarshal(fixture, &f); err != nil {
+		return fmt.Errorf("mockdb: bad fixture - %s", err.Error())
+	}
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	byName := make(map[string]bson.ObjectId)
+	for i := range f.Networks {
+		if f.Networks[i].Id == "" {
+			f.Networks[i].Id = bson.NewObjectId()
+		}
+		byName[f.Networks[i].Name] = f.Networks[i].Id
+	}
+	m.config = irclogsme.Config{Networks: f.Networks}
+
+	m.commands = make([]irclogsme.CommandMessage, 0, len(f.Commands))
+	for _, c := range f.Commands {
+		cmd := c.CommandMessage
+		if cmd.NetworkId == "" {
+			id, ok := byName[c.Network]
+			if !ok {
+				return fmt.Errorf("mockdb: command for unknown network %s", c.Network)
+			}
+			cmd.NetworkId = id
+		}
+		if cmd.Id == "" {
+			cmd.Id = bson.NewObjectId()
+		}
+		m.commands = append(m.commands, cmd)
+	}
+	return nil
+}
+
+// simulate sleeps and maybe fails, as configured. Call it with the lock released.
+func (m *MockDatabase) simulate(op string) error {
+	m.lock.Lock()
+	latency := m.latency
+	fail := false
+	if m.failOps == nil || m.failOps[op] {
+		m.calls++
+		fail = m.calls <= m.failFirst || (m.failRate > 0 && rand.Float64() < m.failRate)
+		if fail {
+			m.failures++
+		}
+	}
+	m.lock.Unlock()
+
+	if latency > 0 {
+		time.Sleep(latency)
+	}
+	if fail {
+		LogDebug("mockdb: failing %s", op)
+		return errMockFailure
+	}
+	return nil
+}
+
+func (m *MockDatabase) GetConfig() (irclogsme.Config, error) {
+	LogDebug("mockdb: fetching config")
+	if err := m.simulate(MOCK_OP_CONFIG); err != nil {
+		return irclogsme.Config{}, err
+	}
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return m.config, nil
+}
+
+func (m *MockDatabase) LogMessage(message irclogsme.LogMessage) error {
+	if err := m.simulate(MOCK_OP_LOG); err != nil {
+		return err
+	}
+	if err := message.Validate(); err != nil {
+		return err
+	}
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if message.Id == "" {
+		message.Id = bson.NewObjectId()
+	}
+	if message.SplitDate == "" {
+		message.SplitDate = irclogsme.SplitDate(message.Time, time.UTC)
+	}
+	m.messages = append(m.messages, message)
+	return nil
+}
+
+func (m *MockDatabase) FetchPendingCommands() ([]irclogsme.CommandMessage, error) {
+	if err := m.simulate(MOCK_OP_FETCH); err != nil {
+		return nil, err
+	}
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	res := make([]irclogsme.CommandMessage, len(m.commands))
+	copy(res, m.commands)
+	return res, nil
+}
+
+func (m *MockDatabase) CommandComplete(cmdMsg irclogsme.CommandMessage) error {
+	if err := m.simulate(MOCK_OP_COMPLETE); err != nil {
+		return err
+	}
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	for i, cmd := range m.commands {
+		if cmd.Id == cmdMsg.Id {
+			m.commands = append(m.commands[:i], m.commands[i+1:]...)
+			cmd.Complete = true
+			m.completed = append(m.completed, cmd)
+			return nil
+		}
+	}
+	return errors.New("mockdb: no such pending command " + cmdMsg.Id.Hex())
+}
+
+func (m *MockDatabase) ExpiredDays(networkId bson.ObjectId, channel string, cutoff string) ([]string, error) {
+	if err := m.simulate(MOCK_OP_EXPIRE); err != nil {
+		return nil, err
+	}
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	seen := make(map[string]bool)
+	dates := make([]string, 0)
+	for _, msg := range m.messages {
+		if msg.NetworkId == networkId && msg.Channel == channel && msg.SplitDate < cutoff && !seen[msg.SplitDate] {
+			seen[msg.SplitDate] = true
+			dates = append(dates, msg.SplitDate)
+		}
+	}
+	sort.Strings(dates)
+	return dates, nil
+}
+
+func (m *MockDatabase) DayMessages(networkId bson.ObjectId, channel string, splitDate string) ([]irclogsme.LogMessage, error) {
+	if err := m.simulate(MOCK_OP_EXPIRE); err != nil {
+		return nil, err
+	}
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	res := make([]irclogsme.LogMessage, 0)
+	for _, msg := range m.messages {
+		if msg.NetworkId == networkId && msg.Channel == channel && msg.SplitDate == splitDate {
+			res = append(res, msg)
+		}
+	}
+	return res, nil
+}
+
+func (m *MockDatabase) DeleteDay(networkId bson.ObjectId, channel string, splitDate string) error {
+	if err := m.simulate(MOCK_OP_EXPIRE); err != nil {
+		return err
+	}
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	kept := make([]irclogsme.LogMessage, 0, len(m.messages))
+	for _, msg := range m.messages {
+		if !(msg.NetworkId == networkId && msg.Channel == channel && msg.SplitDate == splitDate) {
+			kept = append(kept, msg)
+		}
+	}
+	m.messages = kept
+	return nil
+}
+
+// inspection and setup helpers, for tests
+
+// Messages is every message logged so far, in the order they arrived
+func (m *MockDatabase) Messages() []irclogsme.LogMessage {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	res := make([]irclogsme.LogMessage, len(m.messages))
+	copy(res, m.messages)
+	return res
+}
+
+// ChannelMessages is the messages logged to one channel
+func (m *MockDatabase) ChannelMessages(networkId bson.ObjectId, channel string) []irclogsme.LogMessage {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	res := make([]irclogsme.LogMessage, 0)
+	for _, msg := range m.messages {
+		if msg.NetworkId == networkId && msg.Channel == channel {
+			res = append(res, msg)
+		}
+	}
+	return res
+}
+
+// Enqueue adds a pending command, as if someone had put it in the queue
+func (m *MockDatabase) Enqueue(cmd irclogsme.CommandMessage) irclogsme.CommandMessage {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if cmd.Id == "" {
+		cmd.Id = bson.NewObjectId()
+	}
+	m.commands = append(m.commands, cmd)
+	return cmd
+}
+
+func (m *MockDatabase) PendingCommands() []irclogsme.CommandMessage {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	res := make([]irclogsme.CommandMessage, len(m.commands))
+	copy(res, m.commands)
+	return res
+}
+
+func (m *MockDatabase) CompletedCommands() []irclogsme.CommandMessage {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	res := make([]irclogsme.CommandMessage, len(m.completed))
+	copy(res, m.completed)
+	return res
+}
+
+// Failures is how many calls have been failed on purpose
+func (m *MockDatabase) Failures() int {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return m.failures
+}
+
+// SetFailure changes the failure simulation; ops is the operations to fail, or nil for all of them
+func (m *MockDatabase) SetFailure(rate float64, first int, ops ...string) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.failRate, m.failFirst, m.calls = rate, first, 0
+	m.failOps = nil
+	if len(ops) > 0 {
+		m.failOps = make(map[string]bool)
+		for _, op := range ops {
+			m.failOps[op] = true
+		}
+	}
+}
+
+func (m *MockDatabase) SetLatency(latency time.Duration) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.latency = latency
+}
@@ -0,0 +1,342 @@
+package logger
+
+import (
+	"github.com/lukegb/irclogsme"
+	"labix.org/v2/mgo/bson"
+	"strings"
+	"sync"
+)
+
+// networkLogger turns IRC lines into LogMessages for one network. Both the live client
+// and capture replay feed lines through it, so they get exactly the same treatment.
+type networkLogger struct {
+	netConf irclogsme.NetworkConfig
+	emit    func(irclogsme.LogMessage)
+	archive func(irclogsme.RawLine)
+
+	accounts *accountTracker
+	isupport *ISupport
+	members  *memberTracker
+
+	meLock sync.Mutex
+	me     string
+
+	// how the channels we log are spelt in the config, which is how their logs are stored
+	// whatever the server calls them - v1 looks them up exactly
+	namesLock sync.Mutex
+	names     []string
+
+	handlers map[string]func(*loggedLine)
+}
+
+// loggedLine is a line plus the id of its archived copy, if any
+type loggedLine struct {
+	*Line
+	RawId bson.ObjectId
+}
+
+func newNetworkLogger(netConf irclogsme.NetworkConfig, emit func(irclogsme.LogMessage)) *networkLogger {
+	n := &networkLogger{
+		netConf:  netConf,
+		emit:     emit,
+		accounts: newAccountTracker(),
+		isupport: NewISupport(netConf),
+		me:       netConf.Nick,
+	}
+	for channelName := range netConf.Channels {
+		n.names = append(n.names, channelName)
+	}
+	n.members = newMemberTracker(n.isupport)
+	n.handlers = map[string]func(*loggedLine){
+		"001":     n.h_001,
+		"005":     n.h_005,
+		"353":     n.h_353,
+		"PRIVMSG": n.h_PRIVMSG,
+		"NOTICE":  n.h_NOTICE,
+		"TOPIC":   n.h_TOPIC,
+		"JOIN":    n.h_JOIN,
+		"PART":    n.h_PART,
+		"KICK":    n.h_KICK,
+		"QUIT":    n.h_QUIT,
+		"ACTION":  n.h_ACTION,
+		"CAP":     n.h_CAP,
+		"ACCOUNT": n.h_ACCOUNT,
+		"NICK":    n.h_NICK,
+	}
+	return n
+}
+
+// ArchiveTo turns on raw line archiving; every line we see gets passed to archive first
+func (n *networkLogger) ArchiveTo(archive func(irclogsme.RawLine)) {
+	n.archive = archive
+}
+
+// Handle archives the line, if we're archiving, then runs whichever handler wants it. Every
+// line gets archived, handled or not, so a later parser can make something of it.
+func (n *networkLogger) Handle(line *Line) {
+	ll := &loggedLine{Line: line}
+	if n.archive != nil {
+		ll.RawId = bson.NewObjectId()
+		n.archive(irclogsme.RawLine{
+			Id:        ll.RawId,
+			NetworkId: n.netConf.Id,
+			Time:      line.Time,
+			Command:   line.Cmd,
+			Line:      line.Raw,
+		})
+	}
+	if h, ok := n.handlers[line.Cmd]; ok {
+		h(ll)
+	}
+}
+
+// HandleArchived is Handle for a line which came out of the archive
+func (n *networkLogger) HandleArchived(line *Line, rawId bson.ObjectId) {
+	if h, ok := n.handlers[line.Cmd]; ok {
+		h(&loggedLine{Line: line, RawId: rawId})
+	}
+}
+
+// AddHandlers hooks us up to a live connection - we want every line, for the archive
+func (n *networkLogger) AddHandlers(ircCli *ircConn) {
+	ircCli.AddHandler("*", n.Handle)
+}
+
+func (n *networkLogger) Me() string {
+	n.meLock.Lock()
+	defer n.meLock.Unlock()
+	return n.me
+}
+
+func (n *networkLogger) IsMe(nick string) bool {
+	return n.isupport.Fold(nick) == n.isupport.Fold(n.Me())
+}
+
+// AddChannel is for a channel we've been told to log since starting, which goes under the name
+// the command gave it unless we already know it by another spelling
+func (n *networkLogger) AddChannel(channel string) {
+	n.channelName(channel)
+}
+
+// channelName is the name a channel's logs go under: the configured spelling if there is one,
+// otherwise however we first saw it spelt
+func (n *networkLogger) channelName(channel string) string {
+	folded := n.isupport.Fold(channel)
+	n.namesLock.Lock()
+	defer n.namesLock.Unlock()
+	for _, name := range n.names {
+		if n.isupport.Fold(name) == folded {
+			return name
+		}
+	}
+	n.names = append(n.names, channel)
+	return channel
+}
+
+func (n *networkLogger) logLine(t irclogsme.LogMessageType, channel string, line *loggedLine) irclogsme.LogMessage {
+	return irclogsme.LogMessage{
+		Type:      t,
+		NetworkId: n.netConf.Id,
+		Channel:   n.channelName(channel),
+		Time:      line.Time,
+		SplitDate: irclogsme.SplitDate(line.Time, n.netConf.LocationFor(channel)),
+		Nick:      line.Nick,
+		Ident:     line.Ident,
+		Host:      line.Host,
+		Account:   n.accounts.accountFor(line.Line),
+		MsgId:     line.Tags["msgid"],
+		ReplyTo:   lineReplyTo(line.Line),
+		RawId:     line.RawId,
+		Data:      irclogsme.EmptyPayload(),
+	}
+}
+
+func (n *networkLogger) h_001(line *loggedLine) {
+	// welcome to a fresh connection - forget everything we knew
+	n.accounts.Wipe()
+	n.isupport.Reset(n.netConf)
+	n.members.Wipe()
+	if len(line.Args) > 0 {
+		n.meLock.Lock()
+		n.me = line.Args[0]
+		n.meLock.Unlock()
+	}
+}
+
+func (n *networkLogger) h_005(line *loggedLine) {
+	n.isupport.Parse(line.Args)
+	if n.netConf.CaseMapping != "" && n.isupport.CaseMapping() != n.netConf.CaseMapping {
+		LogError("(%s) network uses CASEMAPPING %s but we're configured with %s - the API will disagree about channel names", n.netConf.Name, n.isupport.CaseMapping(), n.netConf.CaseMapping)
+	}
+}
+
+// RPL_NAMREPLY: nick = #channel :@op +voice plain
+func (n *networkLogger) h_353(line *loggedLine) {
+	if len(line.Args) < 4 {
+		return
+	}
+	for _, name := range strings.Fields(line.Args[3]) {
+		name = n.isupport.StripPrefixes(name)
+		// userhost-in-names
+		if bang := strings.IndexByte(name, '!'); bang != -1 {
+			name = name[:bang]
+		}
+		n.members.Add(line.Args[2], name)
+	}
+}
+
+func (n *networkLogger) h_PRIVMSG(line *loggedLine) {
+	if len(line.Args) < 2 {
+		return
+	}
+	LogDebug("(%s) [%s] <%s> {%s} %s", n.netConf.Name, line.Time.String(), line.Src, line.Args[0], line.Args[1])
+	// make a log message!
+	message := n.logLine(irclogsme.LMT_PRIVMSG, line.Args[0], line)
+	message.Data = irclogsme.TextPayload(line.Args[1])
+	n.emit(message)
+}
+
+func (n *networkLogger) h_NOTICE(line *loggedLine) {
+	if len(line.Args) < 2 {
+		return
+	}
+	LogDebug("(%s) [%s] <%s> {%s} %s", n.netConf.Name, line.Time.String(), line.Src, line.Args[0], line.Args[1])
+
+	if !n.isupport.IsChannel(line.Args[0]) {
+		return
+	}
+
+	// make a log message!
+	message := n.logLine(irclogsme.LMT_NOTICE, line.Args[0], line)
+	message.Data = irclogsme.TextPayload(line.Args[1])
+	n.emit(message)
+}
+
+func (n *networkLogger) h_TOPIC(line *loggedLine) {
+	if len(line.Args) < 2 {
+		return
+	}
+	LogDebug("(%s) [%s] <%s> {%s} %s", n.netConf.Name, line.Time.String(), line.Src, line.Args[0], line.Args[1])
+	// make a log message!
+	message := n.logLine(irclogsme.LMT_TOPIC, line.Args[0], line)
+	message.Data = irclogsme.TextPayload(line.Args[1])
+	n.emit(message)
+}
+
+func (n *networkLogger) h_JOIN(line *loggedLine) {
+	if len(line.Args) < 1 {
+		return
+	}
+	LogDebug("(%s) [%s] <%s> joined %s", n.netConf.Name, line.Time.String(), line.Src, line.Args[0])
+	n.members.Add(line.Args[0], line.Nick)
+	if len(line.Args) > 1 {
+		// extended-join: JOIN #channel account :realname
+		n.accounts.Set(line.Nick, line.Args[1])
+	}
+	// make a log message!
+	n.emit(n.logLine(irclogsme.LMT_JOIN, line.Args[0], line))
+}
+
+func (n *networkLogger) h_PART(line *loggedLine) {
+	if len(line.Args) < 1 {
+		return
+	}
+	var message string
+	if len(line.Args) > 1 {
+		message = line.Args[1]
+	}
+	LogDebug("(%s) [%s] <%s> parted %s: %s", n.netConf.Name, line.Time.String(), line.Src, line.Args[0], message)
+	n.leave(line.Args[0], line.Nick)
+	// make a log message!
+	logMessage := n.logLine(irclogsme.LMT_PART, line.Args[0], line)
+	logMessage.Data = irclogsme.TextPayload(message)
+	n.emit(logMessage)
+}
+
+func (n *networkLogger) h_KICK(line *loggedLine) {
+	if len(line.Args) < 2 {
+		return
+	}
+	var message string
+	if len(line.Args) > 2 {
+		message = line.Args[2]
+	}
+	channel := line.Args[0]
+	who := line.Args[1]
+	LogDebug("(%s) [%s] <%s> kicked %s from %s: %s", n.netConf.Name, line.Time.String(), line.Src, who, channel, message)
+	n.leave(channel, who)
+	// make a log message!
+	logMessage := n.logLine(irclogsme.LMT_KICK, channel, line)
+	logMessage.Data = irclogsme.KickPayload(who, message)
+	n.emit(logMessage)
+}
+
+func (n *networkLogger) leave(channel, nick string) {
+	if n.IsMe(nick) {
+		n.members.DelChannel(channel)
+	} else {
+		n.members.Remove(channel, nick)
+	}
+}
+
+func (n *networkLogger) h_QUIT(line *loggedLine) {
+	var message string
+	if len(line.Args) > 0 {
+		message = line.Args[0]
+	}
+	LogDebug("(%s) [%s] <%s> quit: %s", n.netConf.Name, line.Time.String(), line.Src, message)
+	// make a log message!
+	for _, outChannel := range n.members.Quit(line.Nick) {
+		logMessage := n.logLine(irclogsme.LMT_QUIT, outChannel, line)
+		logMessage.Data = irclogsme.TextPayload(message)
+		n.emit(logMessage)
+	}
+	n.accounts.Forget(line.Nick)
+}
+
+func (n *networkLogger) h_ACTION(line *loggedLine) {
+	if len(line.Args) < 1 {
+		return
+	}
+	var message string
+	if len(line.Args) > 1 {
+		message = line.Args[1]
+	}
+	LogDebug("(%s) [%s] * %s %s", n.netConf.Name, line.Time.String(), line.Src, message)
+	logMessage := n.logLine(irclogsme.LMT_ACTION, line.Args[0], line)
+	logMessage.Data = irclogsme.TextPayload(message)
+	n.emit(logMessage)
+}
+
+func (n *networkLogger) h_CAP(line *loggedLine) {
+	if len(line.Args) < 2 {
+		return
+	}
+	switch line.Args[1] {
+	case "ACK":
+		LogInfo("(%s) server enabled capabilities: %s", n.netConf.Name, capsFromLine(line.Line))
+	case "NAK":
+		LogInfo("(%s) server refused capabilities: %s", n.netConf.Name, capsFromLine(line.Line))
+	}
+}
+
+func (n *networkLogger) h_ACCOUNT(line *loggedLine) {
+	if len(line.Args) < 1 {
+		return
+	}
+	LogDebug("(%s) <%s> is now logged in as %s", n.netConf.Name, line.Src, line.Args[0])
+	n.accounts.Set(line.Nick, line.Args[0])
+}
+
+func (n *networkLogger) h_NICK(line *loggedLine) {
+	if len(line.Args) < 1 {
+		return
+	}
+	if n.IsMe(line.Nick) {
+		n.meLock.Lock()
+		n.me = line.Args[0]
+		n.meLock.Unlock()
+	}
+	n.accounts.Rename(line.Nick, line.Args[0])
+	n.members.Rename(line.Nick, line.Args[0])
+}
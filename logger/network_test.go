@@ -0,0 +1,196 @@
+package logger
+
+import (
+	"fmt"
+	"github.com/lukegb/irclogsme"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// handlerLine is the bits of a logged message the handler tests care about
+func handlerLine(msg irclogsme.LogMessage) string {
+	s := fmt.Sprintf("%s %s %s", msg.Channel, msg.Type, msg.Nick)
+	if msg.Account != "" {
+		s += " account=" + msg.Account
+	}
+	if msg.Data.Target != "" {
+		s += " target=" + msg.Data.Target
+	}
+	if msg.Data.Text != "" {
+		s += " :" + msg.Data.Text
+	}
+	return s
+}
+
+var handlerTests = []struct {
+	name   string
+	lines  []string
+	logged []string
+}{
+	{
+		name:   "channel notices only",
+		lines:  []string{":alice!a@h NOTICE #chan :to the channel", ":alice!a@h NOTICE logbot :to us", ":srv NOTICE * :to nobody"},
+		logged: []string{"#chan NOTICE alice :to the channel"},
+	},
+	{
+		name:   "channels are logged as they're configured",
+		lines:  []string{":alice!a@h PRIVMSG #CHAN :hi", ":alice!a@h TOPIC #Chan :topic", ":alice!a@h NOTICE &LOCAL :shouting"},
+		logged: []string{"#chan PRIVMSG alice :hi", "#chan TOPIC alice :topic", "&local NOTICE alice :shouting"},
+	},
+	{
+		name: "rfc1459 folding once the server says so, spelt the first way we saw",
+		lines: []string{
+			":srv 005 logbot CASEMAPPING=rfc1459 :are supported",
+			":alice!a@h PRIVMSG #Chan[1] :hi",
+			":alice!a@h PRIVMSG #chan{1} :again",
+		},
+		logged: []string{"#Chan[1] PRIVMSG alice :hi", "#Chan[1] PRIVMSG alice :again"},
+	},
+	{
+		name: "CHANTYPES",
+		lines: []string{
+			":srv 005 logbot CHANTYPES=#& :are supported",
+			":alice!a@h NOTICE &local :local notice",
+			":alice!a@h NOTICE +modeless :not a channel here",
+		},
+		logged: []string{"&local NOTICE alice :local notice"},
+	},
+	{
+		name: "quits go to every channel the nick was in",
+		lines: []string{
+			":srv 353 logbot = #a :logbot @alice",
+			":alice!a@h JOIN #b",
+			":bob!b@h JOIN #c",
+			":alice!a@h QUIT :bye",
+		},
+		logged: []string{"#b JOIN alice", "#c JOIN bob", "#a QUIT alice :bye", "#b QUIT alice :bye"},
+	},
+	{
+		name: "nick changes follow the nick",
+		lines: []string{
+			":alice!a@h JOIN #a",
+			":alice!a@h NICK alice2",
+			":alice2!a@h QUIT :bye",
+			":alice!a@h QUIT :not here any more",
+		},
+		logged: []string{"#a JOIN alice", "#a QUIT alice2 :bye"},
+	},
+	{
+		name: "kicks and parts",
+		lines: []string{
+			":alice!a@h JOIN #a",
+			":bob!b@h JOIN #a",
+			":bob!b@h KICK #a alice :out",
+			":bob!b@h KICK #a alice",
+			":bob!b@h PART #a :later",
+			":alice!a@h QUIT :gone",
+			":bob!b@h QUIT :gone",
+		},
+		logged: []string{"#a JOIN alice", "#a JOIN bob", "#a KICK bob target=alice :out", "#a KICK bob target=alice", "#a PART bob :later"},
+	},
+	{
+		name: "being kicked forgets the channel",
+		lines: []string{
+			":srv 353 logbot = #a :logbot alice",
+			":op!o@h KICK #a logbot :bye bot",
+			":alice!a@h QUIT :gone",
+		},
+		logged: []string{"#a KICK op target=logbot :bye bot"},
+	},
+	{
+		name: "accounts from tags, extended-join and account-notify",
+		lines: []string{
+			"@account=tagged :alice!a@h PRIVMSG #a :tagged",
+			":alice!a@h PRIVMSG #a :not tracked",
+			":bob!b@h JOIN #a bobacct :Bob",
+			":bob!b@h PRIVMSG #a :from the join",
+			":bob!b@h ACCOUNT newacct",
+			":bob!b@h PRIVMSG #a :changed",
+			":bob!b@h ACCOUNT *",
+			":bob!b@h PRIVMSG #a :logged out",
+			":carol!c@h JOIN #a * :Carol",
+		},
+		logged: []string{
+			"#a PRIVMSG alice account=tagged :tagged",
+			"#a PRIVMSG alice :not tracked",
+			"#a JOIN bob account=bobacct",
+			"#a PRIVMSG bob account=bobacct :from the join",
+			"#a PRIVMSG bob account=newacct :changed",
+			"#a PRIVMSG bob :logged out",
+			"#a JOIN carol",
+		},
+	},
+	{
+		name: "001 starts again",
+		lines: []string{
+			":bob!b@h JOIN #a bobacct :Bob",
+			":srv 001 logbot_ :welcome",
+			":bob!b@h PRIVMSG #a :account forgotten",
+			":bob!b@h QUIT :membership forgotten too",
+		},
+		logged: []string{"#a JOIN bob account=bobacct", "#a PRIVMSG bob :account forgotten"},
+	},
+	{
+		name:   "actions and short lines",
+		lines:  []string{":alice!a@h PRIVMSG #a :\001ACTION waves\001", ":alice!a@h PRIVMSG #a", ":alice!a@h KICK #a", ":alice!a@h JOIN"},
+		logged: []string{"#a ACTION alice :waves"},
+	},
+}
+
+func TestHandlers(t *testing.T) {
+	start := time.Date(2014, 3, 1, 12, 0, 0, 0, time.UTC)
+	for _, tt := range handlerTests {
+		db := NewMockDatabase()
+		n := newNetworkLogger(replayNetwork, func(message irclogsme.LogMessage) {
+			if err := db.LogMessage(message); err != nil {
+				t.Errorf("%s: %s", tt.name, err)
+			}
+		})
+		for i, s := range tt.lines {
+			line, err := parseLine(s, start.Add(time.Duration(i)*time.Second))
+			if err != nil {
+				t.Fatalf("%s: %q: %s", tt.name, s, err)
+			}
+			n.Handle(line)
+		}
+
+		logged := make([]string, 0)
+		for _, msg := range db.Messages() {
+			logged = append(logged, handlerLine(msg))
+		}
+		if !reflect.DeepEqual(logged, tt.logged) {
+			t.Errorf("%s: logged\n%s\nwant\n%s", tt.name, strings.Join(logged, "\n"), strings.Join(tt.logged, "\n"))
+		}
+	}
+}
+
+func TestHandleArchivesEverything(t *testing.T) {
+	db := NewMockDatabase()
+	n := newNetworkLogger(replayNetwork, func(message irclogsme.LogMessage) { db.LogMessage(message) })
+	archived := make([]irclogsme.RawLine, 0)
+	n.ArchiveTo(func(line irclogsme.RawLine) { archived = append(archived, line) })
+
+	lines := []string{":srv 366 logbot #a :End of /NAMES list.", "@msgid=x :alice!a@h PRIVMSG #a :hi", ":srv PONG srv :srv"}
+	for _, s := range lines {
+		line, err := parseLine(s, time.Now())
+		if err != nil {
+			t.Fatal(err)
+		}
+		n.Handle(line)
+	}
+
+	if len(archived) != len(lines) {
+		t.Fatalf("%d lines archived, want %d", len(archived), len(lines))
+	}
+	for i, line := range archived {
+		if line.Line != lines[i] {
+			t.Errorf("archived %q, want %q", line.Line, lines[i])
+		}
+	}
+	msgs := db.Messages()
+	if len(msgs) != 1 || msgs[0].RawId != archived[1].Id || msgs[0].MsgId != "x" {
+		t.Errorf("logged %+v, want the PRIVMSG pointing at its raw line", msgs)
+	}
+}
@@ -0,0 +1,128 @@
+package logger
+
+import (
+	"errors"
+	"github.com/lukegb/irclogsme"
+	"labix.org/v2/mgo/bson"
+	"time"
+)
+
+// how many messages DeleteLogMessages takes out per statement
+const DELETE_BATCH_SIZE = 500
+
+// RawArchive is implemented by databases which can keep raw lines for reprocessing
+type RawArchive interface {
+	ArchiveRawLine(line irclogsme.RawLine) error
+
+	// LastRawCommandBefore finds when we last archived command before t, so reprocessing
+	// can start from a point where our state is known (usually the last 001)
+	LastRawCommandBefore(networkId bson.ObjectId, command string, before time.Time) (time.Time, error)
+
+	// EachRawLine calls f for each archived line in [from, to), oldest first
+	EachRawLine(networkId bson.ObjectId, from, to time.Time, f func(irclogsme.RawLine) error) error
+
+	// RawLogMessageIds lists the messages in [from, to) which came from archived lines
+	RawLogMessageIds(networkId bson.ObjectId, from, to time.Time) ([]bson.ObjectId, error)
+
+	DeleteLogMessages(ids []bson.ObjectId) error
+}
+
+var errNoRawArchive = errors.New(`database provider doesn't support raw line archiving`)
+
+// Reprocess rebuilds the log messages for a network between from and to from the raw archive,
+// using the current parser. Messages which predate the archive are left alone. The new messages
+// go in before the old ones come out, so the logs are never missing anything - if the rebuild
+// fails, whatever it managed is taken back out and the old messages stay.
+func Reprocess(db Database, netConf irclogsme.NetworkConfig, from, to time.Time) (int, error) {
+	archive, ok := db.(RawArchive)
+	if !ok {
+		return 0, errNoRawArchive
+	}
+
+	// warm up from the last connection so we know who's where
+	warmFrom, err := archive.LastRawCommandBefore(netConf.Id, "001", from)
+	if err != nil {
+		return 0, err
+	}
+	if warmFrom.IsZero() {
+		LogInfo("(%s) reprocess: no connection before %s in the archive, starting cold", netConf.Name, from)
+		warmFrom = from
+	}
+
+	old, err := archive.RawLogMessageIds(netConf.Id, from, to)
+	if err != nil {
+		return 0, err
+	}
+
+	rebuilt := make([]bson.ObjectId, 0, len(old))
+	var dbErr error
+	netLogger := newNetworkLogger(netConf, func(message irclogsme.LogMessage) {
+		if dbErr != nil || message.Time.Before(from) {
+			return
+		}
+		message.Id = bson.NewObjectId()
+		if dbErr = db.LogMessage(message); dbErr == nil {
+			rebuilt = append(rebuilt, message.Id)
+		}
+	})
+
+	err = archive.EachRawLine(netConf.Id, warmFrom, to, func(raw irclogsme.RawLine) error {
+		line, err := ParseCaptureLine(raw.Line, raw.Time)
+		if err != nil {
+			LogError("(%s) reprocess: skipping raw line %s: %s", netConf.Name, raw.Id.Hex(), err.Error())
+			return nil
+		}
+		// whatever the line says, it happened when we archived it
+		line.Time = raw.Time
+		netLogger.HandleArchived(line, raw.Id)
+		return dbErr
+	})
+	if err != nil {
+		LogError("(%s) reprocess: failed, taking out the %d messages rebuilt so far", netConf.Name, len(rebuilt))
+		if derr := archive.DeleteLogMessages(rebuilt); derr != nil {
+			LogError("(%s) reprocess: couldn't take them out, there are duplicates between %s and %s - %s", netConf.Name, from, to, derr.Error())
+		}
+		return 0, err
+	}
+
+	LogInfo("(%s) reprocess: removing the %d messages it replaces", netConf.Name, len(old))
+	return len(rebuilt), archive.DeleteLogMessages(old)
+}
+
+func reprocessNetwork(db Database, config irclogsme.Config, networkName string, fromStr, toStr string) {
+	var netConf irclogsme.NetworkConfig
+	found := false
+	for _, net := range config.Networks {
+		if net.Name == networkName {
+			netConf, found = net, true
+		}
+	}
+	if !found {
+		LogFatal("reprocess: no such network %s", networkName)
+	}
+
+	from, err := parseTimeFlag(fromStr)
+	if err != nil {
+		LogFatal("reprocess: bad start time %s - %s", fromStr, err.Error())
+	}
+	to := time.Now()
+	if toStr != "" {
+		if to, err = parseTimeFlag(toStr); err != nil {
+			LogFatal("reprocess: bad end time %s - %s", toStr, err.Error())
+		}
+	}
+
+	logged, err := Reprocess(db, netConf, from, to)
+	if err != nil {
+		LogFatal("(%s) reprocess failed after logging %d messages - %s", netConf.Name, logged, err.Error())
+	}
+	LogInfo("(%s) reprocessed %s to %s, logged %d messages", netConf.Name, from, to, logged)
+}
+
+// parseTimeFlag takes RFC3339 or a plain date
+func parseTimeFlag(s string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	return time.ParseInLocation("2006-01-02", s, time.Local)
+}
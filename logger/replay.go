@@ -0,0 +1,110 @@
+package logger
+
+import (
+	"bufio"
+	"github.com/lukegb/irclogsme"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// unix timestamps before this are far more likely to be a numeric
+const MIN_CAPTURE_UNIX_TIME = 1e9
+
+// parseCaptureTime understands RFC3339 and unix seconds (with optional fraction)
+func parseCaptureTime(s string) (time.Time, bool) {
+	if t, err := time.Parse(time.RFC3339Nano, s); err == nil {
+		return t, true
+	}
+	if f, err := strconv.ParseFloat(s, 64); err == nil && f >= MIN_CAPTURE_UNIX_TIME {
+		sec := int64(f)
+		return time.Unix(sec, int64((f-float64(sec))*1e9)), true
+	}
+	return time.Time{}, false
+}
+
+// ParseCaptureLine turns one line of a capture into a Line, the way the live client would see it.
+// The line may start with a timestamp - RFC3339 or unix seconds, optionally in [brackets] - and may
+// carry IRCv3 tags; a server-time tag beats the capture timestamp. Lines with neither get lastTime.
+func ParseCaptureLine(s string, lastTime time.Time) (*Line, error) {
+	s = strings.TrimRight(s, "\r\n")
+	t := lastTime
+
+	if strings.HasPrefix(s, "[") {
+		if end := strings.IndexByte(s, ']'); end != -1 {
+			if ct, ok := parseCaptureTime(s[1:end]); ok {
+				t = ct
+				s = strings.TrimLeft(s[end+1:], " ")
+			}
+		}
+	} else if sp := strings.IndexByte(s, ' '); sp != -1 {
+		if ct, ok := parseCaptureTime(s[:sp]); ok {
+			t = ct
+			s = strings.TrimLeft(s[sp+1:], " ")
+		}
+	}
+	return parseLine(s, t)
+}
+
+// ReplayCapture feeds a capture of raw IRC lines through the same handlers the live client
+// uses, writing whatever they log to db. It stops at the first database error.
+func ReplayCapture(db Database, netConf irclogsme.NetworkConfig, r io.Reader) (lines int, logged int, err error) {
+	var dbErr error
+	netLogger := newNetworkLogger(netConf, func(message irclogsme.LogMessage) {
+		if dbErr != nil {
+			return
+		}
+		if dbErr = db.LogMessage(message); dbErr == nil {
+			logged++
+		}
+	})
+
+	var lastTime time.Time
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		lines++
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+		line, perr := ParseCaptureLine(scanner.Text(), lastTime)
+		if perr != nil {
+			LogError("(%s) replay: skipping line %d: %s", netConf.Name, lines, perr.Error())
+			continue
+		}
+		lastTime = line.Time
+		netLogger.Handle(line)
+		if dbErr != nil {
+			return lines, logged, dbErr
+		}
+	}
+	return lines, logged, scanner.Err()
+}
+
+func replayFile(db Database, config irclogsme.Config, networkName string, filename string) {
+	var netConf irclogsme.NetworkConfig
+	found := false
+	for _, net := range config.Networks {
+		if net.Name == networkName {
+			netConf, found = net, true
+		}
+	}
+	if !found {
+		LogFatal("replay: no such network %s", networkName)
+	}
+
+	f, err := os.Open(filename)
+	if err != nil {
+		LogFatal("replay: unable to open %s - %s", filename, err.Error())
+	}
+	defer f.Close()
+
+	LogInfo("(%s) replaying %s", netConf.Name, filename)
+	lines, logged, err := ReplayCapture(db, netConf, f)
+	if err != nil {
+		LogFatal("(%s) replay failed after %d lines (%d messages logged) - %s", netConf.Name, lines, logged, err.Error())
+	}
+	LogInfo("(%s) replayed %d lines, logged %d messages", netConf.Name, lines, logged)
+}
@@ -0,0 +1,189 @@
+package logger
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/lukegb/irclogsme"
+	"labix.org/v2/mgo/bson"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+var replayNetwork = irclogsme.NetworkConfig{
+	Id:       bson.ObjectIdHex("53114a000000000000000001"),
+	Name:     "examplenet",
+	Nick:     "logbot",
+	Channels: map[string]irclogsme.ChannelConfig{"#chan": {}, "&local": {}},
+	Timezone: "UTC",
+}
+
+// fixtureLine is how a logged message is spelt in a testdata .log file
+func fixtureLine(msg irclogsme.LogMessage) string {
+	s := fmt.Sprintf("%s %s %s %s %s!%s@%s", msg.Time.UTC().Format(time.RFC3339), msg.SplitDate, msg.Channel, msg.Type, msg.Nick, msg.Ident, msg.Host)
+	if msg.Account != "" {
+		s += " account=" + msg.Account
+	}
+	if msg.MsgId != "" {
+		s += " msgid=" + msg.MsgId
+	}
+	if msg.ReplyTo != "" {
+		s += " reply_to=" + msg.ReplyTo
+	}
+	if msg.Data.Target != "" {
+		s += " target=" + msg.Data.Target
+	}
+	if msg.Data.Text != "" {
+		s += " :" + msg.Data.Text
+	}
+	return s
+}
+
+func readFixture(t *testing.T, filename string) []string {
+	f, err := os.Open(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	lines := make([]string, 0)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return lines
+}
+
+// Each testdata/*.irc is a capture; replaying it has to log exactly what's in the .log next to it.
+func TestReplayFixtures(t *testing.T) {
+	captures, err := filepath.Glob("testdata/*.irc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(captures) == 0 {
+		t.Fatal("no captures in testdata")
+	}
+
+	for _, capture := range captures {
+		f, err := os.Open(capture)
+		if err != nil {
+			t.Fatal(err)
+		}
+		db := NewMockDatabase()
+		_, logged, err := ReplayCapture(db, replayNetwork, f)
+		f.Close()
+		if err != nil {
+			t.Errorf("%s: %s", capture, err)
+			continue
+		}
+
+		got := make([]string, 0, logged)
+		for _, msg := range db.Messages() {
+			got = append(got, fixtureLine(msg))
+		}
+		want := readFixture(t, strings.TrimSuffix(capture, ".irc")+".log")
+		for i := 0; i < len(got) || i < len(want); i++ {
+			switch {
+			case i >= len(got):
+				t.Errorf("%s: missing message %d: %s", capture, i, want[i])
+			case i >= len(want):
+				t.Errorf("%s: unexpected message %d: %s", capture, i, got[i])
+			case got[i] != want[i]:
+				t.Errorf("%s: message %d:\n got %s\nwant %s", capture, i, got[i], want[i])
+			}
+		}
+	}
+}
+
+var (
+	captureNoon = time.Date(2014, 3, 1, 12, 0, 0, 0, time.UTC)
+	captureLast = time.Date(2014, 3, 1, 11, 0, 0, 0, time.UTC)
+)
+
+var captureLineTests = []struct {
+	in    string
+	line  *Line
+	error bool
+}{
+	{
+		in:   ":alice!a@host PRIVMSG #chan :hello there",
+		line: &Line{Nick: "alice", Ident: "a", Host: "host", Src: "alice!a@host", Cmd: "PRIVMSG", Args: []string{"#chan", "hello there"}, Raw: ":alice!a@host PRIVMSG #chan :hello there", Time: captureLast},
+	},
+	{
+		in:   "2014-03-01T12:00:00Z :alice!a@host JOIN #chan\r\n",
+		line: &Line{Nick: "alice", Ident: "a", Host: "host", Src: "alice!a@host", Cmd: "JOIN", Args: []string{"#chan"}, Raw: ":alice!a@host JOIN #chan", Time: captureNoon},
+	},
+	{
+		in:   "[1393675200]  :alice!a@host JOIN #chan",
+		line: &Line{Nick: "alice", Ident: "a", Host: "host", Src: "alice!a@host", Cmd: "JOIN", Args: []string{"#chan"}, Raw: ":alice!a@host JOIN #chan", Time: captureNoon},
+	},
+	{
+		in:   "1393675200.5 :irc.example.net 001 logbot :welcome",
+		line: &Line{Nick: "irc.example.net", Src: "irc.example.net", Cmd: "001", Args: []string{"logbot", "welcome"}, Raw: ":irc.example.net 001 logbot :welcome", Time: captureNoon.Add(500 * time.Millisecond)},
+	},
+	{
+		// a numeric, not a timestamp
+		in:   "005 logbot CHANTYPES=# :are supported",
+		line: &Line{Cmd: "005", Args: []string{"logbot", "CHANTYPES=#", "are supported"}, Raw: "005 logbot CHANTYPES=# :are supported", Time: captureLast},
+	},
+	{
+		// server-time beats the capture's own timestamp; a trailing \ in a tag is dropped
+		in: `2013-01-01T00:00:00Z @time=2014-03-01T12:00:00.000Z;msgid=a\sb\:c\;flag :nick@host privmsg #chan :hi`,
+		line: &Line{
+			Tags: map[string]string{"time": "2014-03-01T12:00:00.000Z", "msgid": "a b;c", "flag": ""},
+			Nick: "nick", Host: "host", Src: "nick@host", Cmd: "PRIVMSG", Args: []string{"#chan", "hi"},
+			Raw: `@time=2014-03-01T12:00:00.000Z;msgid=a\sb\:c\;flag :nick@host privmsg #chan :hi`, Time: captureNoon,
+		},
+	},
+	{
+		in:   ":alice!a@host PRIVMSG #chan :\001ACTION waves\001",
+		line: &Line{Nick: "alice", Ident: "a", Host: "host", Src: "alice!a@host", Cmd: "ACTION", Args: []string{"#chan", "waves"}, Raw: ":alice!a@host PRIVMSG #chan :\001ACTION waves\001", Time: captureLast},
+	},
+	{
+		in:   ":alice!a@host PRIVMSG bot :\001VERSION\001",
+		line: &Line{Nick: "alice", Ident: "a", Host: "host", Src: "alice!a@host", Cmd: "CTCP", Args: []string{"VERSION", "bot", ""}, Raw: ":alice!a@host PRIVMSG bot :\001VERSION\001", Time: captureLast},
+	},
+	{
+		in:   ":bot!b@host NOTICE alice :\001VERSION irclogsme\001",
+		line: &Line{Nick: "bot", Ident: "b", Host: "host", Src: "bot!b@host", Cmd: "CTCPREPLY", Args: []string{"VERSION", "alice", "irclogsme"}, Raw: ":bot!b@host NOTICE alice :\001VERSION irclogsme\001", Time: captureLast},
+	},
+	{in: "", error: true},
+	{in: "[1393675200] ", error: true},
+	{in: "2014-03-01T12:00:00Z :alice!a@host", error: true},
+	{in: "@time=2014-03-01T12:00:00.000Z", error: true},
+}
+
+func TestParseCaptureLine(t *testing.T) {
+	for _, tt := range captureLineTests {
+		line, err := ParseCaptureLine(tt.in, captureLast)
+		if tt.error {
+			if err == nil {
+				t.Errorf("ParseCaptureLine(%q) = %+v, want an error", tt.in, line)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseCaptureLine(%q): %s", tt.in, err)
+			continue
+		}
+
+		want := *tt.line
+		if want.Tags == nil {
+			want.Tags = map[string]string{}
+		}
+		if !line.Time.Equal(want.Time) {
+			t.Errorf("ParseCaptureLine(%q): time %s, want %s", tt.in, line.Time, want.Time)
+		}
+		line.Time, want.Time = time.Time{}, time.Time{}
+		if !reflect.DeepEqual(*line, want) {
+			t.Errorf("ParseCaptureLine(%q) =\n%+v, want\n%+v", tt.in, *line, want)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package logger
+
+import (
+	"github.com/lukegb/irclogsme"
+	"github.com/lukegb/irclogsme/archive"
+	"labix.org/v2/mgo/bson"
+	"time"
+)
+
+// Expirer is implemented by databases which can drop whole days of logs
+type Expirer interface {
+	// ExpiredDays is every SplitDate before cutoff with logs in it, oldest first
+	ExpiredDays(networkId bson.ObjectId, channel string, cutoff string) ([]string, error)
+	DayMessages(networkId bson.ObjectId, channel string, splitDate string) ([]irclogsme.LogMessage, error)
+	DeleteDay(networkId bson.ObjectId, channel string, splitDate string) error
+}
+
+// ExpireChannel applies a channel's retention policy as of now, archiving expired days to
+// archiveDir first if the policy says to. It returns how many days went.
+func ExpireChannel(expirer Expirer, netConf irclogsme.NetworkConfig, channel string, archiveDir string, now time.Time) (int, error) {
+	policy := netConf.RetentionFor(channel)
+	if !policy.Expires() {
+		return 0, nil
+	}
+	if policy.Archive && archiveDir == "" {
+		LogError("(%s) %s wants expired logs archived, but there's no archive_dir - keeping them", netConf.Name, channel)
+		return 0, nil
+	}
+
+	channel = irclogsme.FoldName(netConf.ChannelCaseMapping(), channel)
+	days, err := expirer.ExpiredDays(netConf.Id, channel, policy.Cutoff(now, netConf.LocationFor(channel)))
+	if err != nil {
+		return 0, err
+	}
+
+	for n, day := range days {
+		if policy.Archive {
+			msgs, err := expirer.DayMessages(netConf.Id, channel, day)
+			if err != nil {
+				return n, err
+			}
+			if err := archive.WriteDay(archiveDir, netConf.Id, channel, day, msgs); err != nil {
+				return n, err
+			}
+			LogDebug("(%s) archived %d messages from %s on %s", netConf.Name, len(msgs), channel, day)
+		}
+		if err := expirer.DeleteDay(netConf.Id, channel, day); err != nil {
+			return n, err
+		}
+	}
+	return len(days), nil
+}
+
+// expireAll runs every channel's retention policy once
+func expireAll(expirer Expirer, config irclogsme.Config, archiveDir string) {
+	now := time.Now()
+	for _, net := range config.Networks {
+		for channel := range net.Channels {
+			n, err := ExpireChannel(expirer, net, channel, archiveDir, now)
+			if err != nil {
+				LogError("(%s) retention for %s failed after %d days - %s", net.Name, channel, n, err.Error())
+			} else if n > 0 {
+				LogInfo("(%s) retention: expired %d days of %s", net.Name, n, channel)
+			}
+		}
+	}
+}
+
+func retentionRoutine(db Database, config irclogsme.Config, archiveDir string, interval time.Duration) {
+	expirer, ok := db.(Expirer)
+	if !ok {
+		for _, net := range config.Networks {
+			for channel := range net.Channels {
+				if net.RetentionFor(channel).Expires() {
+					LogError("(%s) has a retention policy, but the database can't expire logs", net.Name)
+					return
+				}
+			}
+		}
+		return
+	}
+
+	for {
+		expireAll(expirer, config, archiveDir)
+		time.Sleep(interval)
+	}
+}
@@ -0,0 +1,204 @@
+package logger
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	LANE_PROTOCOL = iota // auth commands, JOIN, PART, CAP - always goes first
+	LANE_USER            // anything someone asked us to say
+	laneCount
+)
+
+const (
+	// classic ircd flood control lets a handful of lines through then one every couple of seconds
+	SENDQ_BURST = 5
+	SENDQ_RATE  = 2 * time.Second
+
+	SENDQ_TARGET_INTERVAL = 2 * time.Second
+	SENDQ_TARGET_MAX      = 20
+	SENDQ_USER_MAX        = 200
+)
+
+type queuedLine struct {
+	line   string
+	target string
+	queued time.Time
+}
+
+// SendQueueStatus is what the status page shows for a network's queue
+type SendQueueStatus struct {
+	Protocol int `json:"protocol"`
+	User     int `json:"user"`
+	Dropped  int `json:"dropped"`
+	Sent     int `json:"sent"`
+}
+
+// sendQueue stands between us and the socket so we don't get killed for flooding
+type sendQueue struct {
+	sync.Mutex
+
+	netName string
+	send    func(string)
+
+	lanes      [laneCount][]queuedLine
+	perTarget  map[string]int
+	targetLast map[string]time.Time
+
+	connected  bool
+	tokens     float64
+	lastRefill time.Time
+
+	dropped int
+	sent    int
+
+	wake chan bool
+}
+
+func newSendQueue(netName string, send func(string)) *sendQueue {
+	q := &sendQueue{
+		netName:    netName,
+		send:       send,
+		perTarget:  make(map[string]int),
+		targetLast: make(map[string]time.Time),
+		tokens:     SENDQ_BURST,
+		lastRefill: time.Now(),
+		wake:       make(chan bool, 1),
+	}
+	go q.run()
+	return q
+}
+
+// Protocol queues a line that should jump ahead of anything users asked for
+func (q *sendQueue) Protocol(line string) {
+	q.push(LANE_PROTOCOL, queuedLine{line: line})
+}
+
+// User queues a line aimed at target, subject to per-target limits
+func (q *sendQueue) User(target, line string) bool {
+	return q.push(LANE_USER, queuedLine{line: line, target: target})
+}
+
+func (q *sendQueue) push(lane int, ql queuedLine) bool {
+	q.Lock()
+	ql.queued = time.Now()
+	if lane == LANE_USER {
+		if len(q.lanes[lane]) >= SENDQ_USER_MAX || q.perTarget[ql.target] >= SENDQ_TARGET_MAX {
+			q.dropped++
+			q.Unlock()
+			LogError("(%s) send queue full, dropping line to %s", q.netName, ql.target)
+			return false
+		}
+		q.perTarget[ql.target]++
+	}
+	q.lanes[lane] = append(q.lanes[lane], ql)
+	q.Unlock()
+	q.poke()
+	return true
+}
+
+func (q *sendQueue) poke() {
+	select {
+	case q.wake <- true:
+	default:
+	}
+}
+
+func (q *sendQueue) Connected() {
+	q.Lock()
+	q.connected = true
+	q.tokens = SENDQ_BURST
+	q.lastRefill = time.Now()
+	q.Unlock()
+	q.poke()
+}
+
+// Disconnected throws away protocol lines - they'll be regenerated when we reconnect -
+// but keeps what users asked us to say
+func (q *sendQueue) Disconnected() {
+	q.Lock()
+	defer q.Unlock()
+	q.connected = false
+	q.lanes[LANE_PROTOCOL] = nil
+}
+
+func (q *sendQueue) Status() SendQueueStatus {
+	q.Lock()
+	defer q.Unlock()
+	return SendQueueStatus{
+		Protocol: len(q.lanes[LANE_PROTOCOL]),
+		User:     len(q.lanes[LANE_USER]),
+		Dropped:  q.dropped,
+		Sent:     q.sent,
+	}
+}
+
+func (q *sendQueue) refill(now time.Time) {
+	q.tokens += float64(now.Sub(q.lastRefill)) / float64(SENDQ_RATE)
+	if q.tokens > SENDQ_BURST {
+		q.tokens = SENDQ_BURST
+	}
+	q.lastRefill = now
+}
+
+// next picks the line to send, or how long to wait until one can go
+func (q *sendQueue) next(now time.Time) (string, bool, time.Duration) {
+	q.refill(now)
+	if q.tokens < 1 {
+		return "", false, time.Duration((1 - q.tokens) * float64(SENDQ_RATE))
+	}
+
+	if len(q.lanes[LANE_PROTOCOL]) > 0 {
+		ql := q.lanes[LANE_PROTOCOL][0]
+		q.lanes[LANE_PROTOCOL] = q.lanes[LANE_PROTOCOL][1:]
+		return ql.line, true, 0
+	}
+
+	wait := time.Duration(-1)
+	for i, ql := range q.lanes[LANE_USER] {
+		ready := q.targetLast[ql.target].Add(SENDQ_TARGET_INTERVAL)
+		if now.Before(ready) {
+			if wait == -1 || ready.Sub(now) < wait {
+				wait = ready.Sub(now)
+			}
+			continue
+		}
+		q.lanes[LANE_USER] = append(q.lanes[LANE_USER][:i], q.lanes[LANE_USER][i+1:]...)
+		q.targetLast[ql.target] = now
+		if q.perTarget[ql.target]--; q.perTarget[ql.target] <= 0 {
+			delete(q.perTarget, ql.target)
+		}
+		return ql.line, true, 0
+	}
+	return "", false, wait
+}
+
+func (q *sendQueue) run() {
+	for {
+		q.Lock()
+		line, ok, wait := "", false, time.Duration(-1)
+		if q.connected {
+			line, ok, wait = q.next(time.Now())
+			if ok {
+				q.tokens--
+				q.sent++
+			}
+		}
+		q.Unlock()
+
+		if ok {
+			q.send(line)
+			continue
+		}
+
+		if wait < 0 {
+			<-q.wake
+		} else {
+			select {
+			case <-q.wake:
+			case <-time.After(wait):
+			}
+		}
+	}
+}
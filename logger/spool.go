@@ -0,0 +1,102 @@
+package logger
+
+import (
+	"container/list"
+	"github.com/lukegb/irclogsme"
+	"time"
+)
+
+const (
+	// how many messages we'll hold on to while the database is unhappy
+	SPOOL_MAX = 10000
+
+	SPOOL_RETRY_MIN = 1 * time.Second
+	SPOOL_RETRY_MAX = 60 * time.Second
+)
+
+// messageSpool writes messages to the database in order. If a write fails the message stays at
+// the head of the spool and is retried with backoff, while new messages queue up behind it. If
+// the spool fills up the oldest messages are dropped - losing some logs beats blocking the IRC
+// clients until they ping out.
+type messageSpool struct {
+	db      Database
+	pending *list.List
+	dropped int
+
+	retryMin, retryMax time.Duration
+}
+
+func newMessageSpool(db Database) *messageSpool {
+	return &messageSpool{
+		db:       db,
+		pending:  list.New(),
+		retryMin: SPOOL_RETRY_MIN,
+		retryMax: SPOOL_RETRY_MAX,
+	}
+}
+
+func (s *messageSpool) add(message irclogsme.LogMessage) {
+	s.pending.PushBack(message)
+	if s.pending.Len() > SPOOL_MAX {
+		s.pending.Remove(s.pending.Front())
+		s.dropped++
+		if s.dropped == 1 || s.dropped%1000 == 0 {
+			LogError("spool: full, %d messages dropped so far", s.dropped)
+		}
+	}
+}
+
+// flush writes as much of the spool as it can, stopping at the first failure
+func (s *messageSpool) flush() error {
+	for s.pending.Len() > 0 {
+		front := s.pending.Front()
+		message := front.Value.(irclogsme.LogMessage)
+		if err := s.db.LogMessage(message); err != nil {
+			if _, ok := err.(*irclogsme.InvalidMessageError); !ok {
+				return err
+			}
+			// no amount of retrying will fix it
+			LogError("spool: dropping message for %s: %s", message.Channel, err.Error())
+		}
+		s.pending.Remove(front)
+	}
+	return nil
+}
+
+// run writes everything from mChan until it's closed and the spool is empty
+func (s *messageSpool) run(mChan chan irclogsme.LogMessage) {
+	backoff := s.retryMin
+	var retry <-chan time.Time
+	for mChan != nil || s.pending.Len() > 0 {
+		select {
+		case message, ok := <-mChan:
+			if !ok {
+				mChan = nil
+				if retry == nil {
+					retry = time.After(0)
+				}
+				continue
+			}
+			s.add(message)
+			if retry != nil {
+				// still backing off, don't hammer the database
+				continue
+			}
+		case <-retry:
+			retry = nil
+		}
+
+		if err := s.flush(); err != nil {
+			LogError("spool: error saving message to DB, %d waiting, retrying in %s - %s", s.pending.Len(), backoff, err.Error())
+			retry = time.After(backoff)
+			if backoff *= 2; backoff > s.retryMax {
+				backoff = s.retryMax
+			}
+			continue
+		}
+		if backoff != s.retryMin {
+			LogInfo("spool: database is back, caught up")
+		}
+		backoff = s.retryMin
+	}
+}
@@ -0,0 +1,116 @@
+package logger
+
+import (
+	"fmt"
+	"github.com/lukegb/irclogsme"
+	"testing"
+	"time"
+)
+
+func spoolMessage(n int) irclogsme.LogMessage {
+	return irclogsme.LogMessage{
+		Type:      irclogsme.LMT_PRIVMSG,
+		NetworkId: replayNetwork.Id,
+		Channel:   "#chan",
+		Time:      time.Date(2014, 3, 1, 12, 0, n, 0, time.UTC),
+		Nick:      "alice",
+		Data:      irclogsme.TextPayload(fmt.Sprint(n)),
+	}
+}
+
+// checkLogged makes sure db has messages 0 to n-1, in order
+func checkLogged(t *testing.T, db *MockDatabase, n int) {
+	msgs := db.Messages()
+	if len(msgs) != n {
+		t.Fatalf("%d messages logged, want %d", len(msgs), n)
+	}
+	for i, msg := range msgs {
+		if msg.Data.Text != fmt.Sprint(i) {
+			t.Fatalf("message %d is %q, want %q", i, msg.Data.Text, fmt.Sprint(i))
+		}
+	}
+}
+
+func TestSpoolFlushStopsAtFailure(t *testing.T) {
+	db := NewMockDatabase()
+	db.SetFailure(0, 2, MOCK_OP_LOG)
+	s := newMessageSpool(db)
+	for i := 0; i < 3; i++ {
+		s.add(spoolMessage(i))
+	}
+
+	for try := 0; try < 2; try++ {
+		if err := s.flush(); err != errMockFailure {
+			t.Fatalf("flush %d: %v, want %v", try, err, errMockFailure)
+		}
+		if s.pending.Len() != 3 {
+			t.Fatalf("flush %d: %d pending, want 3", try, s.pending.Len())
+		}
+	}
+	if err := s.flush(); err != nil {
+		t.Fatal(err)
+	}
+	if s.pending.Len() != 0 {
+		t.Errorf("%d still pending", s.pending.Len())
+	}
+	checkLogged(t, db, 3)
+}
+
+func TestSpoolDropsInvalidMessages(t *testing.T) {
+	db := NewMockDatabase()
+	s := newMessageSpool(db)
+	s.add(spoolMessage(0))
+	bad := spoolMessage(1)
+	bad.Channel = ""
+	s.add(bad)
+	s.add(spoolMessage(1))
+
+	if err := s.flush(); err != nil {
+		t.Fatal(err)
+	}
+	checkLogged(t, db, 2)
+}
+
+func TestSpoolDropsOldestWhenFull(t *testing.T) {
+	s := newMessageSpool(NewMockDatabase())
+	for i := 0; i < SPOOL_MAX+5; i++ {
+		s.add(spoolMessage(i))
+	}
+	if s.pending.Len() != SPOOL_MAX {
+		t.Errorf("%d pending, want %d", s.pending.Len(), SPOOL_MAX)
+	}
+	if s.dropped != 5 {
+		t.Errorf("%d dropped, want 5", s.dropped)
+	}
+	if front := s.pending.Front().Value.(irclogsme.LogMessage); front.Data.Text != "5" {
+		t.Errorf("oldest kept is %q, want \"5\"", front.Data.Text)
+	}
+}
+
+func TestSpoolRunRetries(t *testing.T) {
+	db := NewMockDatabase()
+	db.SetFailure(0, 4, MOCK_OP_LOG)
+	s := newMessageSpool(db)
+	s.retryMin, s.retryMax = time.Millisecond, 4*time.Millisecond
+
+	mChan := make(chan irclogsme.LogMessage)
+	done := make(chan bool)
+	go func() {
+		s.run(mChan)
+		done <- true
+	}()
+	for i := 0; i < 10; i++ {
+		mChan <- spoolMessage(i)
+	}
+	close(mChan)
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("spool never caught up")
+	}
+	if db.Failures() != 4 {
+		t.Errorf("%d failures, want 4", db.Failures())
+	}
+	checkLogged(t, db, 10)
+}
@@ -0,0 +1,165 @@
+package logger
+
+import (
+	"errors"
+	"github.com/lukegb/irclogsme"
+	"github.com/lukegb/irclogsme/sqldb"
+	"labix.org/v2/mgo/bson"
+	"time"
+)
+
+// SqlDatabase keeps everything in SQLite (sqlite://path) or PostgreSQL (postgres://...)
+type SqlDatabase struct {
+	db *sqldb.DB
+}
+
+func (s *SqlDatabase) Connect(connString string) error {
+	var err error
+
+	LogDebug("sql: connecting")
+	s.db, err = sqldb.Open(connString)
+	return err
+}
+
+func (s *SqlDatabase) validateSelf() error {
+	if s.db == nil {
+		return errors.New(`sql: connection not connected`)
+	}
+	return nil
+}
+
+func (s *SqlDatabase) GetConfig() (irclogsme.Config, error) {
+	var c irclogsme.Config
+
+	if err := s.validateSelf(); err != nil {
+		return c, err
+	}
+
+	LogDebug("sql: fetching networks")
+	networks, err := s.db.Networks()
+	if err != nil {
+		return c, err
+	}
+	if len(networks) == 0 {
+		return c, errors.New(`sql: no networks in database`)
+	}
+	c.Networks = networks
+
+	for _, net := range c.Networks {
+		LogDebug(" - loaded network: %s - servers are %s (connecting as %s!%s)", net.Name, net.IrcServers, net.Nick, net.User)
+	}
+
+	return c, nil
+}
+
+func (s *SqlDatabase) LogMessage(message irclogsme.LogMessage) error {
+	if err := s.validateSelf(); err != nil {
+		return err
+	}
+	if err := message.Validate(); err != nil {
+		return err
+	}
+
+	if message.SplitDate == "" {
+		message.SplitDate = irclogsme.SplitDate(message.Time, time.Local)
+	}
+
+	LogDebug("sql: logging message - %s", message)
+	return s.db.InsertLog(message)
+}
+
+func (s *SqlDatabase) FetchPendingCommands() ([]irclogsme.CommandMessage, error) {
+	if err := s.validateSelf(); err != nil {
+		return nil, err
+	}
+
+	LogDebug("sql: fetching pending commands")
+	return s.db.PendingCommands()
+}
+
+func (s *SqlDatabase) CommandComplete(cmdMsg irclogsme.CommandMessage) error {
+	if err := s.validateSelf(); err != nil {
+		return err
+	}
+
+	LogDebug("sql: marking command as complete: %x", cmdMsg)
+	return s.db.CommandComplete(cmdMsg.Id)
+}
+
+func (s *SqlDatabase) ArchiveRawLine(line irclogsme.RawLine) error {
+	if err := s.validateSelf(); err != nil {
+		return err
+	}
+
+	return s.db.InsertRawLine(line)
+}
+
+func (s *SqlDatabase) LastRawCommandBefore(networkId bson.ObjectId, command string, before time.Time) (time.Time, error) {
+	if err := s.validateSelf(); err != nil {
+		return time.Time{}, err
+	}
+
+	return s.db.LastRawCommandBefore(networkId, command, before)
+}
+
+func (s *SqlDatabase) EachRawLine(networkId bson.ObjectId, from, to time.Time, f func(irclogsme.RawLine) error) error {
+	if err := s.validateSelf(); err != nil {
+		return err
+	}
+
+	LogDebug("sql: fetching raw lines from %s to %s", from, to)
+	return s.db.EachRawLine(networkId, from, to, f)
+}
+
+func (s *SqlDatabase) RawLogMessageIds(networkId bson.ObjectId, from, to time.Time) ([]bson.ObjectId, error) {
+	if err := s.validateSelf(); err != nil {
+		return nil, err
+	}
+
+	LogDebug("sql: listing reprocessable messages from %s to %s", from, to)
+	return s.db.RawLogIds(networkId, from, to)
+}
+
+func (s *SqlDatabase) DeleteLogMessages(ids []bson.ObjectId) error {
+	if err := s.validateSelf(); err != nil {
+		return err
+	}
+
+	LogDebug("sql: removing %d messages", len(ids))
+	for len(ids) > 0 {
+		batch := ids
+		if len(batch) > DELETE_BATCH_SIZE {
+			batch = batch[:DELETE_BATCH_SIZE]
+		}
+		if err := s.db.DeleteLogs(batch); err != nil {
+			return err
+		}
+		ids = ids[len(batch):]
+	}
+	return nil
+}
+
+func (s *SqlDatabase) ExpiredDays(networkId bson.ObjectId, channel string, cutoff string) ([]string, error) {
+	if err := s.validateSelf(); err != nil {
+		return nil, err
+	}
+
+	return s.db.ExpiredDays(networkId, channel, cutoff)
+}
+
+func (s *SqlDatabase) DayMessages(networkId bson.ObjectId, channel string, splitDate string) ([]irclogsme.LogMessage, error) {
+	if err := s.validateSelf(); err != nil {
+		return nil, err
+	}
+
+	return s.db.DayLogs(networkId, channel, splitDate)
+}
+
+func (s *SqlDatabase) DeleteDay(networkId bson.ObjectId, channel string, splitDate string) error {
+	if err := s.validateSelf(); err != nil {
+		return err
+	}
+
+	LogDebug("sql: deleting %s on %s", channel, splitDate)
+	return s.db.DeleteDay(networkId, channel, splitDate)
+}
@@ -2,10 +2,13 @@ package logger
 
 import (
 	"flag"
-	irc "github.com/fluffle/goirc/client"
 	"github.com/lukegb/irclogsme"
+	"github.com/lukegb/irclogsme/config"
 	"io/ioutil"
 	"labix.org/v2/mgo/bson"
+	"os"
+	"strings"
+	"sync"
 	"time"
 )
 
@@ -17,10 +20,18 @@ const (
 	MULTIPLEXER_TIMEOUT  = 60 * time.Second
 )
 
-var (
-	DB_CONN_STRING = flag.String("db_string", "", "defines a full mgo DB connection string")
-	DB_CONN_FILE   = flag.String("db_file", "db.config", "defines which file the mgo DB connection string should be read from - ignored if db_string set")
-)
+// what DbConnect understands
+var DB_SCHEMES = []string{"mock", "mongodb", "sqlite", "postgres", "postgresql", "file"}
+
+func flagSet(fs *flag.FlagSet, name string) bool {
+	set := false
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
+}
 
 func readStringFromFile(filename string) (string, error) {
 	f, err := ioutil.ReadFile(filename)
@@ -30,198 +41,118 @@ func readStringFromFile(filename string) (string, error) {
 	return string(f), nil
 }
 
-func ircClientRoutine(netConf irclogsme.NetworkConfig, messageChan chan irclogsme.LogMessage, cmdChan chan irclogsme.CommandMessage) {
+func ircClientRoutine(netConf irclogsme.NetworkConfig, messageChan chan irclogsme.LogMessage, rawChan chan irclogsme.RawLine, cmdChan chan irclogsme.CommandMessage) {
 	// this is a go routine
-	ircCli := irc.SimpleClient(netConf.Nick, netConf.User, "http://irclogs.me")
-	ircCli.EnableStateTracking()
-	quit := make(chan bool)
-	ircCli.AddHandler("disconnected", func(conn *irc.Conn, line *irc.Line) {
+	ircCli := newIrcConn(netConf.Nick, netConf.User, "http://irclogs.me")
+	netLogger := newNetworkLogger(netConf, func(message irclogsme.LogMessage) { messageChan <- message })
+	if netConf.ArchiveRawLines && rawChan != nil {
+		netLogger.ArchiveTo(func(line irclogsme.RawLine) { rawChan <- line })
+	}
+	netLogger.AddHandlers(ircCli)
+	isupport := netLogger.isupport
+	sendq := newSendQueue(netConf.Name, func(line string) { ircCli.Raw(line) })
+	joiner := newChannelJoiner(netConf.Name, isupport, sendq.Protocol)
+	for channelName, channelConf := range netConf.Channels {
+		if channelConf.Disabled {
+			LogInfo("(%s) %s is disabled, not joining", netConf.Name, channelName)
+			continue
+		}
+		joiner.Want(channelName, channelConf.Key)
+	}
+
+	// nothing might be reading quit when we disconnect (we could be waiting for CMT_CONNECT),
+	// so it holds one and we empty it before connecting again
+	quit := make(chan bool, 1)
+	ircCli.AddHandler("disconnected", func(line *Line) {
 		LogInfo("(%s) Disconnected?!?", netConf.Name)
-		quit <- true
+		joiner.Disconnected()
+		sendq.Disconnected()
+		select {
+		case quit <- true:
+		default:
+		}
 	})
 
-	var actualChannels []string
-
-	ircCli.AddHandler("connected", func(conn *irc.Conn, line *irc.Line) {
-		LogInfo("(%s) Connected!")
-		LogInfo("(%s) Executing connection commands.")
+	ircCli.AddHandler("connected", func(line *Line) {
+		LogInfo("(%s) Connected!", netConf.Name)
+		sendq.Connected()
+		LogInfo("(%s) Executing connection commands.", netConf.Name)
 		for _, cmd := range netConf.AuthCommands {
 			LogDebug("(%s) - executing: %s", netConf.Name, cmd)
-			conn.Raw(cmd)
+			sendq.Protocol(cmd)
 		}
 		LogInfo("(%s) Joining channels.", netConf.Name)
-		actualChannels := make([]string, 0)
-		for channelName, _ := range netConf.Channels {
-			LogDebug("(%s) - joining %s", netConf.Name, channelName)
-			conn.Join(channelName)
-			actualChannels = append(actualChannels, channelName)
-			time.Sleep(1 * time.Second)
-		}
-	})
-
-	ircCli.AddHandler("PRIVMSG", func(conn *irc.Conn, line *irc.Line) {
-		LogDebug("(%s) [%s] <%s> {%s} %s", netConf.Name, line.Time.String(), line.Src, line.Args[0], line.Args[1])
-		// make a log message!
-		messageChan <- irclogsme.LogMessage{
-			Type:      irclogsme.LMT_PRIVMSG,
-			NetworkId: netConf.Id,
-			Channel:   line.Args[0],
-			Payload:   line.Args[1],
-			Time:      line.Time,
-			Nick:      line.Nick,
-			Ident:     line.Ident,
-			Host:      line.Host,
-		}
-	})
-
-	ircCli.AddHandler("NOTICE", func(conn *irc.Conn, line *irc.Line) {
-		LogDebug("(%s) [%s] <%s> {%s} %s", netConf.Name, line.Time.String(), line.Src, line.Args[0], line.Args[1])
-
-		if line.Args[0][0] != '#' {
-			return
-		}
-
-		// make a log message!
-		messageChan <- irclogsme.LogMessage{
-			Type:      irclogsme.LMT_NOTICE,
-			NetworkId: netConf.Id,
-			Channel:   line.Args[0],
-			Payload:   line.Args[1],
-			Time:      line.Time,
-			Nick:      line.Nick,
-			Ident:     line.Ident,
-			Host:      line.Host,
-		}
-	})
-
-	ircCli.AddHandler("TOPIC", func(conn *irc.Conn, line *irc.Line) {
-		LogDebug("(%s) [%s] <%s> {%s} %s", netConf.Name, line.Time.String(), line.Src, line.Args[0], line.Args[1])
-		// make a log message!
-		messageChan <- irclogsme.LogMessage{
-			Type:      irclogsme.LMT_TOPIC,
-			NetworkId: netConf.Id,
-			Channel:   line.Args[0],
-			Payload:   line.Args[1],
-			Time:      line.Time,
-			Nick:      line.Nick,
-			Ident:     line.Ident,
-			Host:      line.Host,
-		}
+		joiner.Connected()
 	})
 
-	ircCli.AddHandler("JOIN", func(conn *irc.Conn, line *irc.Line) {
-		LogDebug("(%s) [%s] <%s> joined %s", netConf.Name, line.Time.String(), line.Src, line.Args[0])
-		// make a log message!
-		messageChan <- irclogsme.LogMessage{
-			Type:      irclogsme.LMT_JOIN,
-			NetworkId: netConf.Id,
-			Channel:   line.Args[0],
-			Time:      line.Time,
-			Nick:      line.Nick,
-			Ident:     line.Ident,
-			Host:      line.Host,
+	// the joiner needs to know how its JOINs went
+	ircCli.AddHandler("JOIN", func(line *Line) {
+		if len(line.Args) > 0 && netLogger.IsMe(line.Nick) {
+			joiner.Joined(line.Args[0])
 		}
 	})
 
-	ircCli.AddHandler("PART", func(conn *irc.Conn, line *irc.Line) {
-		var message string
-		if len(line.Args) > 1 {
-			message = line.Args[1]
-		}
-		LogDebug("(%s) [%s] <%s> parted %s: %s", netConf.Name, line.Time.String(), line.Src, line.Args[0], message)
-		// make a log message!
-		messageChan <- irclogsme.LogMessage{
-			Type:      irclogsme.LMT_PART,
-			NetworkId: netConf.Id,
-			Channel:   line.Args[0],
-			Payload:   message,
-			Time:      line.Time,
-			Nick:      line.Nick,
-			Ident:     line.Ident,
-			Host:      line.Host,
+	ircCli.AddHandler("KICK", func(line *Line) {
+		if len(line.Args) > 1 && netLogger.IsMe(line.Args[1]) {
+			joiner.Parted(line.Args[0])
 		}
 	})
 
-	ircCli.AddHandler("KICK", func(conn *irc.Conn, line *irc.Line) {
-		var message string
-		if len(line.Args) > 2 {
-			message = line.Args[2]
-		}
-		channel := line.Args[0]
-		who := line.Args[1]
-		LogDebug("(%s) [%s] <%s> kicked %s from %s: %s", netConf.Name, line.Time.String(), line.Src, who, channel, message)
-		// make a log message!
-		messageChan <- irclogsme.LogMessage{
-			Type:      irclogsme.LMT_PART,
-			NetworkId: netConf.Id,
-			Channel:   channel,
-			Payload:   message,
-			Target:    who,
-			Time:      line.Time,
-			Nick:      line.Nick,
-			Ident:     line.Ident,
-			Host:      line.Host,
-		}
-	})
-
-	ircCli.AddHandler("QUIT", func(conn *irc.Conn, line *irc.Line) {
-		var message string
-		if len(line.Args) > 0 {
-			message = line.Args[0]
-		}
-		LogDebug("(%s) [%s] <%s> quit: %s", netConf.Name, line.Time.String(), line.Src, message)
-		theirNick := conn.ST.GetNick(line.Nick)
-		outChannels := make([]string, 0)
-		for _, channel := range actualChannels {
-			if _, ok := theirNick.IsOnStr(channel); ok {
-				outChannels = append(outChannels, channel)
+	// can't join: full, invite only, banned, bad key, no such channel, too many channels, need to register
+	for _, numeric := range []string{"471", "473", "474", "475", "403", "405", "477"} {
+		numeric := numeric
+		ircCli.AddHandler(numeric, func(line *Line) {
+			if len(line.Args) < 3 {
+				return
 			}
-		}
-		// make a log message!
-		for _, outChannel := range outChannels {
-			messageChan <- irclogsme.LogMessage{
-				Type:      irclogsme.LMT_QUIT,
-				NetworkId: netConf.Id,
-				Payload:   message,
-				Channel:   outChannel,
-				Time:      line.Time,
-				Nick:      line.Nick,
-				Ident:     line.Ident,
-				Host:      line.Host,
+			joiner.Failed(line.Args[1], numeric+" "+line.Args[2])
+		})
+	}
+
+	// resource temporarily unavailable, try again later
+	for _, numeric := range []string{"437", "263"} {
+		ircCli.AddHandler(numeric, func(line *Line) {
+			if len(line.Args) < 2 {
+				return
 			}
-		}
-	})
+			joiner.Throttled(line.Args[1])
+		})
+	}
 
-	ircCli.AddHandler("ACTION", func(conn *irc.Conn, line *irc.Line) {
-		var message string
-		if len(line.Args) > 1 {
-			message = line.Args[1]
-		}
-		LogDebug("(%s) [%s] * %s %s", netConf.Name, line.Time.String(), line.Src, message)
-		messageChan <- irclogsme.LogMessage{
-			Type:      irclogsme.LMT_ACTION,
-			NetworkId: netConf.Id,
-			Channel:   line.Args[0],
-			Payload:   message,
-			Time:      line.Time,
-			Nick:      line.Nick,
-			Ident:     line.Ident,
-			Host:      line.Host,
+	// the status page reads which server we're on from its own goroutine
+	var serverLock sync.Mutex
+	currentServer := 0
+
+	registerStatus(netConf.Name, func() NetworkStatus {
+		serverLock.Lock()
+		defer serverLock.Unlock()
+		return NetworkStatus{
+			Name:         netConf.Name,
+			Connected:    ircCli.Connected(),
+			Server:       netConf.IrcServers[currentServer],
+			Channels:     joiner.Channels(),
+			JoinFailures: joiner.Failures(),
+			SendQueue:    sendq.Status(),
 		}
 	})
 
-	currentServer := 0
-
 	LogInfo("(%s) starting loop", netConf.Name)
 	for {
 		LogInfo("(%s) CONNECTING", netConf.Name)
-		ircCli.Connect(netConf.IrcServers[currentServer])
-
+		select {
+		case <-quit:
+		default:
+		}
 		superloop := true
+		if err := ircCli.Connect(netConf.IrcServers[currentServer]); err != nil {
+			LogError("(%s) couldn't connect to %s - %s", netConf.Name, netConf.IrcServers[currentServer], err.Error())
+			superloop = false
+		}
+
 		for superloop {
 			select {
 			case <-quit:
-				break
+				superloop = false
 			case cmdmsg := <-cmdChan:
 				LogDebug("(%s) Got Command: %x", netConf.Name, cmdmsg)
 				switch cmdmsg.Type {
@@ -244,29 +175,28 @@ func ircClientRoutine(netConf irclogsme.NetworkConfig, messageChan chan irclogsm
 					}
 				case irclogsme.CMT_START_LOGGING:
 					LogDebug("(%s) joining channel %s", netConf.Name, cmdmsg.Channel)
-					ircCli.Join(cmdmsg.Channel)
-					actualChannels = append(actualChannels, cmdmsg.Channel)
+					netLogger.AddChannel(cmdmsg.Channel)
+					joiner.Want(cmdmsg.Channel, cmdmsg.Key)
 				case irclogsme.CMT_STOP_LOGGING:
 					LogDebug("(%s) parting channel %s", netConf.Name, cmdmsg.Channel)
-					ircCli.Part(cmdmsg.Channel, "told to part")
-					nuker := -1
-					for k, v := range actualChannels {
-						if v == cmdmsg.Channel {
-							nuker = k
-						}
-					}
-					if nuker != -1 {
-						actualChannels = append(actualChannels[:nuker], actualChannels[nuker+1:]...)
-					}
+					joiner.Unwant(cmdmsg.Channel)
+					sendq.Protocol("PART " + cmdmsg.Channel + " :told to part")
 				case irclogsme.CMT_TELL:
 					LogDebug("(%s) telling <%s> %s", netConf.Name, cmdmsg.Target, cmdmsg.Message)
-					ircCli.Privmsg(cmdmsg.Target, cmdmsg.Message)
+					for _, message := range strings.Split(cmdmsg.Message, "\n") {
+						message = strings.TrimRight(message, "\r")
+						if message != "" {
+							sendq.User(cmdmsg.Target, "PRIVMSG "+cmdmsg.Target+" :"+message)
+						}
+					}
 				}
 			}
 		}
 
 		time.Sleep(1 * time.Second)
+		serverLock.Lock()
 		currentServer = (currentServer + 1) % len(netConf.IrcServers)
+		serverLock.Unlock()
 	}
 }
 
@@ -275,81 +205,147 @@ func commandMultiplexer(db Database, netMap map[bson.ObjectId]chan irclogsme.Com
 	multiplexerTicker := time.Tick(MULTIPLEXER_INTERVAL)
 	for {
 		LogDebug("CMDMX - running tick")
+		dispatchCommands(db, netMap, MULTIPLEXER_TIMEOUT)
+		<-multiplexerTicker
+	}
+}
 
-		LogDebug("CMDMX - fetching commands from database")
-		c, err := db.FetchPendingCommands()
-		if err != nil {
-			LogDebug("CMDMX - got error %x", err)
-		} else {
-			for _, cmd := range c {
-				LogDebug("CMDMX - command: %x", cmd)
-				timeOut := time.After(MULTIPLEXER_TIMEOUT)
-				select {
-				case netMap[cmd.NetworkId] <- cmd:
-					LogDebug("CMDMX - command sent!")
-					LogDebug("CMDMX - setting command as complete:")
-					if err := db.CommandComplete(cmd); err != nil {
-						LogDebug("CMDMX - command error! %x", err)
-						continue
-					}
-					LogDebug("CMDMX - command marked complete.")
-				case <-timeOut:
-					LogDebug("CMDMX - command timeout!")
-				}
+// dispatchCommands hands each pending command to its network's routine. Nothing's running for
+// a disabled network (or one enabled since we started), so its commands are dropped - marked
+// complete so they don't sit at the front of the queue for ever.
+func dispatchCommands(db Database, netMap map[bson.ObjectId]chan irclogsme.CommandMessage, timeout time.Duration) {
+	LogDebug("CMDMX - fetching commands from database")
+	c, err := db.FetchPendingCommands()
+	if err != nil {
+		LogDebug("CMDMX - got error %x", err)
+		return
+	}
+	for _, cmd := range c {
+		LogDebug("CMDMX - command: %x", cmd)
+		cmdChan, ok := netMap[cmd.NetworkId]
+		if ok {
+			timeOut := time.After(timeout)
+			select {
+			case cmdChan <- cmd:
+				LogDebug("CMDMX - command sent!")
+			case <-timeOut:
+				LogDebug("CMDMX - command timeout!")
+				continue
 			}
+		} else {
+			LogInfo("CMDMX - dropping command %s for network %s, which isn't running", cmd.Id.Hex(), cmd.NetworkId.Hex())
 		}
-
-		<-multiplexerTicker
+		LogDebug("CMDMX - setting command as complete:")
+		if err := db.CommandComplete(cmd); err != nil {
+			LogDebug("CMDMX - command error! %x", err)
+			continue
+		}
+		LogDebug("CMDMX - command marked complete.")
 	}
 }
 
 func Start() {
 	LogInfo("Starting up irclogs.me logger v%s (version identifier: %d)", VERSION_STRING, VERSION_ID)
-	flag.Parse()
-
-	var db Database
-	var err error
-	var dbConnString string
-	if *DB_CONN_STRING == "" {
-		if dbConnString, err = readStringFromFile(*DB_CONN_FILE); err != nil {
-			LogFatal("unable to load db connection string from file %s - %s", *DB_CONN_FILE, err.Error())
-		}
-	} else {
-		dbConnString = *DB_CONN_STRING
+	// our own flags, so a program that imports us for DbConnect doesn't get them too
+	fs := flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+	dbConnFile := fs.String("db_file", "db.config", "file to read the DB connection string from, if nothing else sets db_string")
+	statusAddr := fs.String("status_addr", "", "if set, serve logger status as JSON on this address at /status")
+	replayCapture := fs.String("replay_file", "", "if set, replay this capture of raw IRC lines into the database instead of connecting")
+	replayNetwork := fs.String("replay_network", "", "the name of the network the capture in replay_file came from")
+	reprocessName := fs.String("reprocess_network", "", "if set, rebuild this network's logs from the raw line archive instead of connecting")
+	reprocessFrom := fs.String("reprocess_from", "", "where to start reprocessing - RFC3339 or YYYY-MM-DD")
+	reprocessTo := fs.String("reprocess_to", "", "where to stop reprocessing - RFC3339 or YYYY-MM-DD, defaults to now")
+	retentionInterval := fs.Duration("retention_interval", 1*time.Hour, "how often to apply retention policies - 0 turns them off")
+	loader := config.NewLoader(fs, config.DB|config.ARCHIVE)
+	loader.Schemes = DB_SCHEMES
+	fs.Parse(os.Args[1:])
+
+	// db_file is how the connection string used to be set, so it's still the fallback
+	var defaults config.Settings
+	if connString, err := readStringFromFile(*dbConnFile); err == nil {
+		defaults.DBConnString = strings.TrimSpace(connString)
+	} else if flagSet(fs, "db_file") {
+		LogFatal("unable to load db connection string from file %s - %s", *dbConnFile, err.Error())
+	}
+	settings, err := loader.Load(defaults)
+	if err != nil {
+		LogFatal("%s", err.Error())
 	}
-	if db, err = DbConnect(dbConnString); err != nil {
+
+	db, err := DbConnect(settings.DBConnString)
+	if err != nil {
 		LogFatal("failed to connect to database - %s", err.Error())
 	}
 
-	config, err := db.GetConfig()
+	dbConfig, err := db.GetConfig()
 	if err != nil {
 		LogFatal("failed to get config from database - %s", err.Error())
 	}
+	for _, net := range dbConfig.Networks {
+		if err := net.CheckTimezones(); err != nil {
+			LogError("(%s) bad timezone, those days will be split in UTC - %s", net.Name, err.Error())
+		}
+	}
+
+	if *replayCapture != "" {
+		replayFile(db, dbConfig, *replayNetwork, *replayCapture)
+		return
+	}
+
+	if *reprocessName != "" {
+		reprocessNetwork(db, dbConfig, *reprocessName, *reprocessFrom, *reprocessTo)
+		return
+	}
 
 	messageChan := make(chan irclogsme.LogMessage, 20)
 
 	netMap := make(map[bson.ObjectId]chan irclogsme.CommandMessage)
 
+	// raw line archiving is only possible if the database can take them
+	var rawChan chan irclogsme.RawLine
+	if archive, ok := db.(RawArchive); ok {
+		rawChan = make(chan irclogsme.RawLine, 100)
+		go func() {
+			for line := range rawChan {
+				if err := archive.ArchiveRawLine(line); err != nil {
+					LogError("error archiving raw line! %s", err.Error())
+				}
+			}
+		}()
+	}
+
 	// well, here goes!
-	for _, net := range config.Networks {
+	enabled := 0
+	for _, net := range dbConfig.Networks {
+		if !net.Enabled {
+			LogInfo("(%s) disabled, not connecting - irclogsme-admin network enable %s turns it on", net.Name, net.Name)
+			continue
+		}
+		if net.ArchiveRawLines && rawChan == nil {
+			LogError("(%s) wants raw lines archived, but the database can't do that", net.Name)
+		}
 		cmdChan := make(chan irclogsme.CommandMessage)
-		go ircClientRoutine(net, messageChan, cmdChan)
+		go ircClientRoutine(net, messageChan, rawChan, cmdChan)
 		netMap[net.Id] = cmdChan
+		enabled++
+	}
+	if enabled == 0 && len(dbConfig.Networks) > 0 {
+		// most likely a database from before we looked at enabled
+		LogError("every network is disabled, so there's nothing to log - if this is a MongoDB database from before networks could be disabled, migration 4 turns them back on")
 	}
 
-	go func(mChan chan irclogsme.LogMessage, db Database) {
-		for {
-			message := <-mChan
-			err := db.LogMessage(message)
-
-			if err != nil {
-				LogError("error saving message to DB!", err)
-			}
-		}
-	}(messageChan, db)
+	go newMessageSpool(db).run(messageChan)
 
 	go commandMultiplexer(db, netMap)
 
+	if *retentionInterval > 0 {
+		go retentionRoutine(db, dbConfig, settings.ArchiveDir, *retentionInterval)
+	}
+
+	if *statusAddr != "" {
+		go serveStatus(*statusAddr)
+	}
+
 	// spin
 	<-make(chan int)
 
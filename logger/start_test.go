@@ -0,0 +1,47 @@
+package logger
+
+import (
+	"github.com/lukegb/irclogsme"
+	"labix.org/v2/mgo/bson"
+	"testing"
+	"time"
+)
+
+func TestDispatchCommands(t *testing.T) {
+	db := NewMockDatabase()
+	running, disabled := bson.NewObjectId(), bson.NewObjectId()
+	db.Enqueue(irclogsme.CommandMessage{NetworkId: disabled, Type: irclogsme.CMT_TELL, Target: "alice", Message: "hi"})
+	db.Enqueue(irclogsme.CommandMessage{NetworkId: running, Type: irclogsme.CMT_START_LOGGING, Channel: "#chan"})
+
+	cmdChan := make(chan irclogsme.CommandMessage, 1)
+	netMap := map[bson.ObjectId]chan irclogsme.CommandMessage{running: cmdChan}
+
+	// the disabled network's command is in front, and mustn't hold up the other one
+	start := time.Now()
+	dispatchCommands(db, netMap, time.Minute)
+	if took := time.Since(start); took > 5*time.Second {
+		t.Errorf("took %s", took)
+	}
+	select {
+	case cmd := <-cmdChan:
+		if cmd.Channel != "#chan" {
+			t.Errorf("running network got %+v", cmd)
+		}
+	default:
+		t.Error("running network got nothing")
+	}
+	if pending := db.PendingCommands(); len(pending) != 0 {
+		t.Errorf("still pending: %+v", pending)
+	}
+	if completed := db.CompletedCommands(); len(completed) != 2 {
+		t.Errorf("completed %+v, want both", completed)
+	}
+
+	// nobody's listening this time, so it stays queued
+	db.Enqueue(irclogsme.CommandMessage{NetworkId: running, Type: irclogsme.CMT_STOP_LOGGING, Channel: "#chan"})
+	cmdChan <- irclogsme.CommandMessage{}
+	dispatchCommands(db, netMap, 10*time.Millisecond)
+	if pending := db.PendingCommands(); len(pending) != 1 {
+		t.Errorf("pending %+v, want the one that timed out", pending)
+	}
+}
@@ -0,0 +1,71 @@
+package logger
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync"
+)
+
+type NetworkStatus struct {
+	Name      string `json:"name"`
+	Connected bool   `json:"connected"`
+	Server    string `json:"server"`
+
+	Channels     []string        `json:"channels"`
+	JoinFailures []JoinFailure   `json:"join_failures"`
+	SendQueue    SendQueueStatus `json:"send_queue"`
+}
+
+type Status struct {
+	Version  string          `json:"version"`
+	Networks []NetworkStatus `json:"networks"`
+}
+
+// each network routine registers a function which reports on itself
+var statusReporters = struct {
+	sync.Mutex
+	m map[string]func() NetworkStatus
+}{m: make(map[string]func() NetworkStatus)}
+
+func registerStatus(netName string, f func() NetworkStatus) {
+	statusReporters.Lock()
+	defer statusReporters.Unlock()
+	statusReporters.m[netName] = f
+}
+
+func CurrentStatus() Status {
+	statusReporters.Lock()
+	defer statusReporters.Unlock()
+	status := Status{Version: VERSION_STRING, Networks: make([]NetworkStatus, 0, len(statusReporters.m))}
+	for _, f := range statusReporters.m {
+		status.Networks = append(status.Networks, f())
+	}
+	sort.Sort(networkStatusByName(status.Networks))
+	return status
+}
+
+type networkStatusByName []NetworkStatus
+
+func (n networkStatusByName) Len() int           { return len(n) }
+func (n networkStatusByName) Swap(i, j int)      { n[i], n[j] = n[j], n[i] }
+func (n networkStatusByName) Less(i, j int) bool { return n[i].Name < n[j].Name }
+
+func statusHandler(w http.ResponseWriter, r *http.Request) {
+	resp, err := json.Marshal(CurrentStatus())
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(resp)
+}
+
+func serveStatus(addr string) {
+	LogInfo("Serving status on %s", addr)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/status", statusHandler)
+	if err := http.ListenAndServe(addr, mux); err != nil {
+		LogError("status server died - %s", err.Error())
+	}
+}
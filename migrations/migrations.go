@@ -0,0 +1,176 @@
+// Package migrations brings a MongoDB irclogsme database up to date. Each migration has a
+// number; the database remembers the last one it finished, and where a running migration
+// got to, so an interrupted run picks up where it left off.
+package migrations
+
+import (
+	"errors"
+	"fmt"
+	"github.com/lukegb/irclogsme"
+	"labix.org/v2/mgo"
+	"labix.org/v2/mgo/bson"
+	"log"
+)
+
+const (
+	SCHEMA_COLLECTION  = "schema"
+	DEFAULT_BATCH_SIZE = 1000
+)
+
+// Migration is one numbered change to the database. Batch looks at up to size documents
+// with ids after after, in id order, and returns the last id it looked at - or "" once
+// there's nothing left. Batches must be safe to run twice.
+type Migration struct {
+	Version     int
+	Description string
+	Batch       func(m *Migrator, after bson.ObjectId, size int) (bson.ObjectId, error)
+}
+
+// Migrations is every migration, in order. Never renumber one, add a new one on the end.
+var Migrations = []Migration{
+	{1, "set splitdate from time on every log message", fixSplitDates},
+	{2, "recompute splitdate in each network and channel's timezone", resplitDates},
+	{3, "move target and payload into a typed, versioned data field", typePayloads},
+	{4, "enable every network, since the logger never used to check", enableNetworks},
+}
+
+// schemaState is the single document in SCHEMA_COLLECTION
+type schemaState struct {
+	Id      string `bson:"_id"`
+	Version int
+
+	// where the migration after Version has got to
+	Checkpoint bson.ObjectId `bson:",omitempty"`
+}
+
+type Migrator struct {
+	DB        *mgo.Database
+	DryRun    bool
+	BatchSize int
+
+	// bumped by batches, for reporting
+	Seen, Changed int
+}
+
+func NewMigrator(db *mgo.Database) *Migrator {
+	return &Migrator{DB: db, BatchSize: DEFAULT_BATCH_SIZE}
+}
+
+func (m *Migrator) state() (schemaState, error) {
+	var s schemaState
+	err := m.DB.C(SCHEMA_COLLECTION).FindId("version").One(&s)
+	if err == mgo.ErrNotFound {
+		return schemaState{Id: "version"}, nil
+	}
+	return s, err
+}
+
+func (m *Migrator) saveState(s schemaState) error {
+	if m.DryRun {
+		return nil
+	}
+	_, err := m.DB.C(SCHEMA_COLLECTION).UpsertId(s.Id, s)
+	return err
+}
+
+// Version is the last migration which finished
+func (m *Migrator) Version() (int, error) {
+	s, err := m.state()
+	return s.Version, err
+}
+
+func Latest() int {
+	return Migrations[len(Migrations)-1].Version
+}
+
+// Run applies every migration after the current version up to and including target
+func (m *Migrator) Run(target int) error {
+	if target > Latest() {
+		return fmt.Errorf("no migration %d, latest is %d", target, Latest())
+	}
+	s, err := m.state()
+	if err != nil {
+		return err
+	}
+	if s.Version >= target {
+		log.Printf("already at version %d, nothing to do", s.Version)
+		return nil
+	}
+
+	for _, mig := range Migrations {
+		if mig.Version <= s.Version || mig.Version > target {
+			continue
+		}
+		log.Printf("migration %d: %s", mig.Version, mig.Description)
+		if s.Checkpoint != "" {
+			log.Printf("migration %d: resuming after %s", mig.Version, s.Checkpoint.Hex())
+		}
+		m.Seen, m.Changed = 0, 0
+
+		after := s.Checkpoint
+		for {
+			last, err := mig.Batch(m, after, m.BatchSize)
+			if err != nil {
+				return fmt.Errorf("migration %d failed after %s: %s", mig.Version, after.Hex(), err.Error())
+			}
+			if last == "" {
+				break
+			}
+			after = last
+			s.Checkpoint = last
+			if err := m.saveState(s); err != nil {
+				return err
+			}
+			log.Printf("migration %d: %d looked at, %d changed, checkpoint %s", mig.Version, m.Seen, m.Changed, last.Hex())
+		}
+
+		s.Version, s.Checkpoint = mig.Version, ""
+		if err := m.saveState(s); err != nil {
+			return err
+		}
+		if m.DryRun {
+			log.Printf("migration %d: dry run, would have changed %d of %d", mig.Version, m.Changed, m.Seen)
+		} else {
+			log.Printf("migration %d: done, changed %d of %d", mig.Version, m.Changed, m.Seen)
+		}
+	}
+	return nil
+}
+
+var errBadBatch = errors.New("batch size must be positive")
+
+// eachLog is the usual shape of a batch: fix returns the update to make to a message, or nil if
+// it's fine as it is
+func (m *Migrator) eachLog(after bson.ObjectId, size int, fix func(irclogsme.LogMessage) bson.M) (bson.ObjectId, error) {
+	if size <= 0 {
+		return "", errBadBatch
+	}
+	query := bson.M{}
+	if after != "" {
+		query["_id"] = bson.M{"$gt": after}
+	}
+
+	var batch []irclogsme.LogMessage
+	if err := m.DB.C("logs").Find(query).Sort("_id").Limit(size).All(&batch); err != nil {
+		return "", err
+	}
+	if len(batch) == 0 {
+		return "", nil
+	}
+
+	for _, msg := range batch {
+		m.Seen++
+		update := fix(msg)
+		if update == nil {
+			continue
+		}
+		m.Changed++
+		if m.DryRun {
+			continue
+		}
+		if err := m.DB.C("logs").UpdateId(msg.Id, update); err != nil {
+			return "", err
+		}
+	}
+	return batch[len(batch)-1].Id, nil
+}
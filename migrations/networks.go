@@ -0,0 +1,32 @@
+package migrations
+
+import (
+	"labix.org/v2/mgo/bson"
+)
+
+// enableNetworks turns on every network there is. The logger used to connect to all of them
+// whatever enabled said, so nothing should stop logging just because it now looks. There are
+// never many networks, so this is all one batch.
+func enableNetworks(m *Migrator, after bson.ObjectId, size int) (bson.ObjectId, error) {
+	if size <= 0 {
+		return "", errBadBatch
+	}
+	query := bson.M{"enabled": bson.M{"$ne": true}}
+	total, err := m.DB.C("networks").Count()
+	if err != nil {
+		return "", err
+	}
+	changed, err := m.DB.C("networks").Find(query).Count()
+	if err != nil {
+		return "", err
+	}
+	m.Seen += total
+	m.Changed += changed
+	if changed == 0 || m.DryRun {
+		return "", nil
+	}
+	if _, err := m.DB.C("networks").UpdateAll(query, bson.M{"$set": bson.M{"enabled": true}}); err != nil {
+		return "", err
+	}
+	return "", nil
+}
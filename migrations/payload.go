@@ -0,0 +1,24 @@
+package migrations
+
+import (
+	"github.com/lukegb/irclogsme"
+	"labix.org/v2/mgo/bson"
+)
+
+// typePayloads rewrites messages from before payloads were typed. Whatever was in target and
+// payload becomes a string; nothing's dropped, but a non-string turns into its fmt form. Kicks
+// were logged as parts with a target back then, so those become kicks - reading doesn't do that,
+// so until this has run v1 shows them as parts, like it always did.
+func typePayloads(m *Migrator, after bson.ObjectId, size int) (bson.ObjectId, error) {
+	return m.eachLog(after, size, func(msg irclogsme.LogMessage) bson.M {
+		upgraded := msg.Upgrade()
+		retyped := msg.RetypeLegacyKick()
+		if !upgraded && !retyped {
+			return nil
+		}
+		return bson.M{
+			"$set":   bson.M{"data": msg.Data, "type": msg.Type},
+			"$unset": bson.M{"target": 1, "payload": 1},
+		}
+	})
+}
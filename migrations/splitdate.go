@@ -0,0 +1,47 @@
+package migrations
+
+import (
+	"fmt"
+	"github.com/lukegb/irclogsme"
+	"labix.org/v2/mgo/bson"
+	"time"
+)
+
+// fixSplitDates is what datefixer used to do: splitdate is the local date of time
+func fixSplitDates(m *Migrator, after bson.ObjectId, size int) (bson.ObjectId, error) {
+	return m.eachLog(after, size, func(msg irclogsme.LogMessage) bson.M {
+		splitDate := msg.Time.Format("2006-01-02")
+		if msg.SplitDate == splitDate {
+			return nil
+		}
+		return bson.M{"$set": bson.M{"splitdate": splitDate}}
+	})
+}
+
+// resplitDates recomputes splitdate in each network's (or channel's) timezone, now that days
+// don't depend on where the logger happened to be running
+func resplitDates(m *Migrator, after bson.ObjectId, size int) (bson.ObjectId, error) {
+	var networks []irclogsme.NetworkConfig
+	if err := m.DB.C("networks").Find(bson.M{}).All(&networks); err != nil {
+		return "", err
+	}
+	byId := make(map[bson.ObjectId]irclogsme.NetworkConfig)
+	for _, net := range networks {
+		if err := net.CheckTimezones(); err != nil {
+			return "", fmt.Errorf("network %s: %s", net.Name, err.Error())
+		}
+		byId[net.Id] = net
+	}
+
+	return m.eachLog(after, size, func(msg irclogsme.LogMessage) bson.M {
+		loc := time.Local
+		if net, ok := byId[msg.NetworkId]; ok {
+			loc = net.LocationFor(msg.Channel)
+		}
+		splitDate := irclogsme.SplitDate(msg.Time, loc)
+		if msg.SplitDate == splitDate {
+			return nil
+		}
+		return bson.M{"$set": bson.M{"splitdate": splitDate}}
+	})
+}
@@ -0,0 +1,60 @@
+package migrations
+
+import (
+	"flag"
+	"github.com/lukegb/irclogsme/config"
+	"labix.org/v2/mgo"
+	"log"
+)
+
+// Start runs the migrate command. Its flags live in here so importing the package doesn't
+// clash with anyone else's.
+func Start() {
+	var (
+		dryRun    = flag.Bool("dry_run", false, "report what would change without changing anything")
+		batchSize = flag.Int("batch_size", DEFAULT_BATCH_SIZE, "how many documents to look at between checkpoints")
+		target    = flag.Int("to", 0, "stop after this migration - defaults to the latest")
+		list      = flag.Bool("list", false, "list the migrations and the current version, then exit")
+	)
+	loader := config.NewLoader(flag.CommandLine, config.DB)
+	loader.Schemes = []string{"mongodb"}
+	flag.Parse()
+	settings, err := loader.Load(config.Settings{DBConnString: "mongodb://localhost/irclogsme"})
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	dbc, err := mgo.Dial(settings.DBConnString)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	defer dbc.Close()
+
+	m := NewMigrator(dbc.DB(""))
+	m.DryRun = *dryRun
+	m.BatchSize = *batchSize
+
+	version, err := m.Version()
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	if *list {
+		for _, mig := range Migrations {
+			done := " "
+			if mig.Version <= version {
+				done = "*"
+			}
+			log.Printf("%s %3d %s", done, mig.Version, mig.Description)
+		}
+		log.Printf("database is at version %d", version)
+		return
+	}
+
+	if *target == 0 {
+		*target = Latest()
+	}
+	if err := m.Run(*target); err != nil {
+		log.Fatalln(err)
+	}
+}
@@ -0,0 +1,139 @@
+package irclogsme
+
+import (
+	"fmt"
+)
+
+// PAYLOAD_VERSION is the version of Payload written by this code. Bump it and add a migration
+// if Payload's meaning changes.
+const PAYLOAD_VERSION = 1
+
+// Payload is what a LogMessage says, beyond who said it and where:
+//
+//	PRIVMSG, NOTICE, ACTION: Text is the message
+//	PART, QUIT:              Text is the reason, if any
+//	TOPIC:                   Text is the new topic, empty if it was cleared
+//	KICK:                    Target is who was kicked, Text the reason
+//	NICK:                    Text is the new nick
+//	JOIN:                    nothing
+type Payload struct {
+	Version int    `bson:"v"`
+	Text    string `bson:"text,omitempty"`
+	Target  string `bson:"target,omitempty"`
+}
+
+func TextPayload(text string) Payload {
+	return Payload{Version: PAYLOAD_VERSION, Text: text}
+}
+
+func KickPayload(target, reason string) Payload {
+	return Payload{Version: PAYLOAD_VERSION, Text: reason, Target: target}
+}
+
+func EmptyPayload() Payload {
+	return Payload{Version: PAYLOAD_VERSION}
+}
+
+// InvalidMessageError means a message can't be stored as it is. Trying again won't help.
+type InvalidMessageError struct {
+	Reason string
+}
+
+func (e *InvalidMessageError) Error() string {
+	return "invalid log message: " + e.Reason
+}
+
+func invalid(format string, args ...interface{}) error {
+	return &InvalidMessageError{fmt.Sprintf(format, args...)}
+}
+
+// Validate checks a message is fit to be written
+func (m LogMessage) Validate() error {
+	if m.NetworkId == "" {
+		return invalid("no network")
+	}
+	if m.Channel == "" {
+		return invalid("no channel")
+	}
+	if m.Time.IsZero() {
+		return invalid("no time")
+	}
+	if m.Data.Version != PAYLOAD_VERSION {
+		return invalid("payload version %d, want %d", m.Data.Version, PAYLOAD_VERSION)
+	}
+	if m.LegacyTarget != nil || m.LegacyPayload != nil {
+		return invalid("old style target or payload set")
+	}
+
+	switch m.Type {
+	case LMT_PRIVMSG, LMT_NOTICE, LMT_ACTION, LMT_PART, LMT_QUIT, LMT_TOPIC:
+		if m.Data.Target != "" {
+			return invalid("%s has a target", m.Type)
+		}
+	case LMT_JOIN:
+		if m.Data.Text != "" || m.Data.Target != "" {
+			return invalid("JOIN has a payload")
+		}
+	case LMT_KICK:
+		if m.Data.Target == "" {
+			return invalid("KICK has no target")
+		}
+	case LMT_NICK:
+		if m.Data.Text == "" || m.Data.Target != "" {
+			return invalid("NICK needs just the new nick")
+		}
+	default:
+		return invalid("unknown type %d", uint(m.Type))
+	}
+	return nil
+}
+
+// legacyString turns an old interface{} target or payload into a string without trusting
+// what's in it
+func legacyString(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	}
+	return fmt.Sprint(v)
+}
+
+// Upgrade moves the target and payload of a message written before payloads were typed into
+// Data. It reports whether anything changed; messages which are already current are left alone.
+// The kicks the logger used to write as parts with a target stay parts, because that's what v1
+// has always shown - RetypeLegacyKick is for the migration.
+func (m *LogMessage) Upgrade() bool {
+	if m.Data.Version == PAYLOAD_VERSION && m.LegacyTarget == nil && m.LegacyPayload == nil {
+		return false
+	}
+	if m.Data.Version == 0 {
+		m.Data = Payload{
+			Version: PAYLOAD_VERSION,
+			Text:    legacyString(m.LegacyPayload),
+			Target:  legacyString(m.LegacyTarget),
+		}
+	}
+	m.LegacyTarget, m.LegacyPayload = nil, nil
+	return true
+}
+
+// RetypeLegacyKick turns an upgraded part with a target, which was really a kick, into a kick,
+// reporting whether it was one
+func (m *LogMessage) RetypeLegacyKick() bool {
+	if m.Type != LMT_PART || m.Data.Target == "" {
+		return false
+	}
+	m.Type = LMT_KICK
+	return true
+}
+
+// UpgradeAll upgrades messages in place, for whatever's just read a batch of them
+func UpgradeAll(msgs []LogMessage) {
+	for n := range msgs {
+		msgs[n].Upgrade()
+	}
+}
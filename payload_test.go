@@ -0,0 +1,78 @@
+package irclogsme
+
+import (
+	"labix.org/v2/mgo/bson"
+	"reflect"
+	"testing"
+	"time"
+)
+
+var upgradeTests = []struct {
+	name    string
+	in, out LogMessage
+	changed bool
+}{
+	{
+		name:    "current",
+		in:      LogMessage{Type: LMT_PRIVMSG, Data: TextPayload("hi")},
+		out:     LogMessage{Type: LMT_PRIVMSG, Data: TextPayload("hi")},
+		changed: false,
+	},
+	{
+		name:    "legacy message",
+		in:      LogMessage{Type: LMT_PRIVMSG, LegacyPayload: "hi"},
+		out:     LogMessage{Type: LMT_PRIVMSG, Data: TextPayload("hi")},
+		changed: true,
+	},
+	{
+		name:    "legacy part",
+		in:      LogMessage{Type: LMT_PART, LegacyPayload: "bye"},
+		out:     LogMessage{Type: LMT_PART, Data: TextPayload("bye")},
+		changed: true,
+	},
+	{
+		name:    "legacy kick, logged as a part with a target",
+		in:      LogMessage{Type: LMT_PART, LegacyTarget: "alice", LegacyPayload: "out"},
+		out:     LogMessage{Type: LMT_PART, Data: KickPayload("alice", "out")},
+		changed: true,
+	},
+	{
+		name:    "legacy kick with no reason",
+		in:      LogMessage{Type: LMT_PART, LegacyTarget: "alice"},
+		out:     LogMessage{Type: LMT_PART, Data: KickPayload("alice", "")},
+		changed: true,
+	},
+	{
+		name:    "legacy non-strings",
+		in:      LogMessage{Type: LMT_PRIVMSG, LegacyPayload: []byte("bytes")},
+		out:     LogMessage{Type: LMT_PRIVMSG, Data: TextPayload("bytes")},
+		changed: true,
+	},
+	{
+		name:    "half migrated",
+		in:      LogMessage{Type: LMT_PRIVMSG, Data: TextPayload("new"), LegacyPayload: "old"},
+		out:     LogMessage{Type: LMT_PRIVMSG, Data: TextPayload("new")},
+		changed: true,
+	},
+}
+
+func TestUpgrade(t *testing.T) {
+	for _, tt := range upgradeTests {
+		msg := tt.in
+		changed := msg.Upgrade()
+		if changed != tt.changed {
+			t.Errorf("%s: changed %v, want %v", tt.name, changed, tt.changed)
+		}
+		if !reflect.DeepEqual(msg, tt.out) {
+			t.Errorf("%s: got %+v, want %+v", tt.name, msg, tt.out)
+		}
+		// and once the migration's retyped the kicks, it has to be fit to write
+		if kick := msg.RetypeLegacyKick(); kick != (tt.out.Data.Target != "") {
+			t.Errorf("%s: retyped %v", tt.name, kick)
+		}
+		msg.NetworkId, msg.Channel, msg.Time = bson.NewObjectId(), "#chan", time.Now()
+		if err := msg.Validate(); err != nil {
+			t.Errorf("%s: %s", tt.name, err)
+		}
+	}
+}
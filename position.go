@@ -0,0 +1,35 @@
+package irclogsme
+
+import (
+	"labix.org/v2/mgo/bson"
+	"time"
+)
+
+// Position is a place in a channel's logs, between two messages. Messages are in order of time
+// and then id, so no two are in the same place and paging by Position never skips or repeats one.
+// A Position without an Id is just a moment: messages at exactly Time come after it.
+//
+// The zero Position is the start of a channel going forwards and the end going backwards.
+type Position struct {
+	Time time.Time
+	Id   bson.ObjectId
+}
+
+// PositionOf is the place msg is at - messages after it are after the Position
+func PositionOf(msg LogMessage) Position {
+	return Position{Time: msg.Time, Id: msg.Id}
+}
+
+func (p Position) IsZero() bool {
+	return p.Time.IsZero() && p.Id == ""
+}
+
+// Precedes is whether msg comes after p
+func (p Position) Precedes(msg LogMessage) bool {
+	return msg.Time.After(p.Time) || (msg.Time.Equal(p.Time) && msg.Id > p.Id)
+}
+
+// Follows is whether msg comes before p
+func (p Position) Follows(msg LogMessage) bool {
+	return msg.Time.Before(p.Time) || (msg.Time.Equal(p.Time) && msg.Id < p.Id)
+}
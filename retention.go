@@ -0,0 +1,28 @@
+package irclogsme
+
+import (
+	"time"
+)
+
+// RetentionFor is the policy for one of the network's channels
+func (n NetworkConfig) RetentionFor(channel string) RetentionPolicy {
+	casemapping := n.ChannelCaseMapping()
+	folded := FoldName(casemapping, channel)
+	for name, conf := range n.Channels {
+		if FoldName(casemapping, name) == folded && conf.Retention != nil {
+			return *conf.Retention
+		}
+	}
+	return n.Retention
+}
+
+// Expires is true if the policy ever removes anything
+func (r RetentionPolicy) Expires() bool {
+	return r.Days > 0
+}
+
+// Cutoff is the first SplitDate which is kept as of now, for days split in loc; anything before
+// it has expired
+func (r RetentionPolicy) Cutoff(now time.Time, loc *time.Location) string {
+	return SplitDate(now.In(loc).AddDate(0, 0, -r.Days), loc)
+}
@@ -0,0 +1,116 @@
+package irclogsme
+
+import (
+	"labix.org/v2/mgo/bson"
+	"regexp"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// SearchFilter picks messages out of a channel. Every field that's set has to match.
+type SearchFilter struct {
+	NetworkId bson.ObjectId
+	Channel   string
+
+	// in the message text as whole words, ignoring case - stores look for these through their
+	// full text indexes
+	Text string
+	// matches the message text somewhere
+	Regex *regexp.Regexp
+	// exactly, ignoring case
+	Nick string
+	// any of these
+	Types []LogMessageType
+
+	// [From, To) - zero for no limit
+	From, To time.Time
+}
+
+// SearchMatch is a message a search found, and how well it matched its Text. Scores only mean
+// anything within one search: bigger is better, and without Text they're all 0.
+type SearchMatch struct {
+	LogMessage
+	Score float64
+}
+
+// Match is the filter applied to one message, for stores that can't do it themselves
+func (f SearchFilter) Match(msg LogMessage) bool {
+	if msg.NetworkId != f.NetworkId || msg.Channel != f.Channel {
+		return false
+	}
+	if f.Text != "" && !containsPhrase(msg.Data.Text, f.Text) {
+		return false
+	}
+	if f.Regex != nil && !f.Regex.MatchString(msg.Data.Text) {
+		return false
+	}
+	if f.Nick != "" && !strings.EqualFold(msg.Nick, f.Nick) {
+		return false
+	}
+	if len(f.Types) > 0 {
+		found := false
+		for _, t := range f.Types {
+			if msg.Type == t {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if !f.From.IsZero() && msg.Time.Before(f.From) {
+		return false
+	}
+	if !f.To.IsZero() && !msg.Time.Before(f.To) {
+		return false
+	}
+	return true
+}
+
+// Score is how many times Text turns up in msg, for stores without a full text index to rank by
+func (f SearchFilter) Score(msg LogMessage) float64 {
+	if f.Text == "" {
+		return 0
+	}
+	return float64(countPhrase(msg.Data.Text, f.Text, len(msg.Data.Text)+1))
+}
+
+func isWordChar(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// SearchWords is the words in a search's Text, which is what a full text index can look for
+func SearchWords(text string) []string {
+	return strings.FieldsFunc(text, func(r rune) bool { return !isWordChar(r) })
+}
+
+// containsPhrase is whether phrase is in text without running into the words either side of it
+func containsPhrase(text, phrase string) bool {
+	return countPhrase(text, phrase, 1) > 0
+}
+
+// countPhrase is how many times (up to most) containsPhrase finds phrase in text
+func countPhrase(text, phrase string, most int) int {
+	text, phrase = strings.ToLower(text), strings.ToLower(phrase)
+	first, _ := utf8.DecodeRuneInString(phrase)
+	last, _ := utf8.DecodeLastRuneInString(phrase)
+	count := 0
+	for at := 0; at <= len(text) && count < most; {
+		n := strings.Index(text[at:], phrase)
+		if n == -1 {
+			break
+		}
+		start, end := at+n, at+n+len(phrase)
+		before, _ := utf8.DecodeLastRuneInString(text[:start])
+		after, _ := utf8.DecodeRuneInString(text[end:])
+		if (start == 0 || !isWordChar(before) || !isWordChar(first)) && (end == len(text) || !isWordChar(after) || !isWordChar(last)) {
+			count++
+		}
+		_, size := utf8.DecodeRuneInString(text[start:])
+		at = start + size
+	}
+	return count
+}
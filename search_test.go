@@ -0,0 +1,59 @@
+package irclogsme
+
+import (
+	"labix.org/v2/mgo/bson"
+	"regexp"
+	"testing"
+)
+
+var matchTests = []struct {
+	text   string
+	filter SearchFilter
+	match  bool
+}{
+	{"hello world", SearchFilter{Text: "hello world"}, true},
+	{"say HELLO World again", SearchFilter{Text: "hello world"}, true},
+	{"hello, world", SearchFilter{Text: "hello world"}, false},
+	{"shell", SearchFilter{Text: "hell"}, false},
+	{"hell's bells", SearchFilter{Text: "hell"}, true},
+	{"shell hell", SearchFilter{Text: "hell"}, true},
+	{"c++ rocks", SearchFilter{Text: "c++"}, true},
+	{"abc++", SearchFilter{Text: "c++"}, false},
+	{"wait...", SearchFilter{Text: "..."}, true},
+	{"über alles", SearchFilter{Text: "ÜBER"}, true},
+	{"hello world", SearchFilter{Regex: regexp.MustCompile(`^h\w+ w`)}, true},
+	{"say hello world", SearchFilter{Regex: regexp.MustCompile(`^h\w+ w`)}, false},
+	{"hello world", SearchFilter{Text: "world", Regex: regexp.MustCompile(`^hello`)}, true},
+	{"hello world", SearchFilter{Text: "moon", Regex: regexp.MustCompile(`^hello`)}, false},
+}
+
+func TestSearchFilterMatch(t *testing.T) {
+	networkId := bson.NewObjectId()
+	for _, tt := range matchTests {
+		tt.filter.NetworkId, tt.filter.Channel = networkId, "#chan"
+		msg := LogMessage{NetworkId: networkId, Channel: "#chan", Type: LMT_PRIVMSG, Data: TextPayload(tt.text)}
+		if got := tt.filter.Match(msg); got != tt.match {
+			t.Errorf("text %q, regex %v: %q matched %v, want %v", tt.filter.Text, tt.filter.Regex, tt.text, got, tt.match)
+		}
+	}
+}
+
+var scoreTests = []struct {
+	text, q string
+	score   float64
+}{
+	{"hello world", "hello", 1},
+	{"hello hello, HELLO", "hello", 3},
+	{"shell hello", "hell", 0},
+	{"hello world", "", 0},
+	{"c++ and c++", "c++", 2},
+}
+
+func TestSearchFilterScore(t *testing.T) {
+	for _, tt := range scoreTests {
+		msg := LogMessage{Type: LMT_PRIVMSG, Data: TextPayload(tt.text)}
+		if got := (SearchFilter{Text: tt.q}).Score(msg); got != tt.score {
+			t.Errorf("%q in %q: %v, want %v", tt.q, tt.text, got, tt.score)
+		}
+	}
+}
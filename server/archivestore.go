@@ -0,0 +1,232 @@
+package server
+
+import (
+	"github.com/lukegb/irclogsme"
+	"github.com/lukegb/irclogsme/archive"
+	"labix.org/v2/mgo/bson"
+	"os"
+	"sort"
+	"time"
+)
+
+// archiveStore serves days which retention has moved out of the database from the archive
+// files instead. Counting only sees what's still in the database.
+type archiveStore struct {
+	Store
+	dir string
+}
+
+func NewArchiveStore(store Store, dir string) Store {
+	return &archiveStore{Store: store, dir: dir}
+}
+
+// isNotFound copes with both mgo.ErrNotFound and ours
+func isNotFound(err error) bool {
+	return err != nil && err.Error() == errNotFound.Error()
+}
+
+func (a *archiveStore) ChannelDates(networkId bson.ObjectId, channel string) ([]string, error) {
+	dates, err := a.Store.ChannelDates(networkId, channel)
+	if err != nil {
+		return nil, err
+	}
+	archived, err := archive.Dates(a.dir, networkId, channel)
+	if err != nil {
+		return nil, err
+	}
+	if len(archived) == 0 {
+		return dates, nil
+	}
+
+	seen := make(map[string]bool)
+	all := make([]string, 0, len(dates)+len(archived))
+	for _, date := range append(dates, archived...) {
+		if !seen[date] {
+			seen[date] = true
+			all = append(all, date)
+		}
+	}
+	sort.Strings(all)
+	return all, nil
+}
+
+func (a *archiveStore) DayLogs(networkId bson.ObjectId, channel string, splitDate string) ([]irclogsme.LogMessage, error) {
+	logs, err := a.Store.DayLogs(networkId, channel, splitDate)
+	if err != nil || len(logs) > 0 {
+		return logs, err
+	}
+	archived, err := archive.ReadDay(a.dir, networkId, channel, splitDate)
+	if os.IsNotExist(err) {
+		return logs, nil
+	}
+	return archived, err
+}
+
+func (a *archiveStore) LogsBetween(networkId bson.ObjectId, channel string, from, to time.Time) ([]irclogsme.LogMessage, error) {
+	logs, err := a.Store.LogsBetween(networkId, channel, from, to)
+	if err != nil {
+		return nil, err
+	}
+	dates, err := archive.Dates(a.dir, networkId, channel)
+	if err != nil {
+		return nil, err
+	}
+
+	// SplitDates can be in any timezone, so allow a day either side
+	first, last := from.AddDate(0, 0, -1).Format("2006-01-02"), to.AddDate(0, 0, 1).Format("2006-01-02")
+	added := false
+	for _, date := range dates {
+		if date < first || date > last {
+			continue
+		}
+		archived, err := archive.ReadDay(a.dir, networkId, channel, date)
+		if err != nil {
+			return nil, err
+		}
+		for _, msg := range archived {
+			if !msg.Time.Before(from) && msg.Time.Before(to) {
+				logs = append(logs, msg)
+				added = true
+			}
+		}
+	}
+	if added {
+		sort.Stable(logsByTime(logs))
+	}
+	return logs, nil
+}
+
+// LogsFrom carries on into the archive. Archived days are older than anything left in the
+// database, but not by much, so the two are merged rather than one following the other.
+func (a *archiveStore) LogsFrom(networkId bson.ObjectId, channel string, pos irclogsme.Position, backwards bool, limit int) ([]irclogsme.LogMessage, error) {
+	logs, err := a.Store.LogsFrom(networkId, channel, pos, backwards, limit)
+	if err != nil || (backwards && len(logs) >= limit) {
+		return logs, err
+	}
+	dates, err := archive.Dates(a.dir, networkId, channel)
+	if err != nil {
+		return nil, err
+	}
+	if backwards {
+		sort.Sort(sort.Reverse(sort.StringSlice(dates)))
+	}
+
+	// SplitDates can be in any timezone, so allow a day either side
+	first, last := "", "9999-99-99"
+	if !pos.IsZero() {
+		first, last = pos.Time.AddDate(0, 0, -1).Format("2006-01-02"), pos.Time.AddDate(0, 0, 1).Format("2006-01-02")
+	}
+	seen := make(map[bson.ObjectId]bool)
+	for _, msg := range logs {
+		seen[msg.Id] = true
+	}
+	added := 0
+	for _, date := range dates {
+		if (!backwards && date < first) || (backwards && date > last) {
+			continue
+		}
+		archived, err := archive.ReadDay(a.dir, networkId, channel, date)
+		if err != nil {
+			return nil, err
+		}
+		for _, msg := range archived {
+			if seen[msg.Id] || !(pos.IsZero() || (backwards && pos.Follows(msg)) || (!backwards && pos.Precedes(msg))) {
+				continue
+			}
+			logs = append(logs, msg)
+			added++
+		}
+		if added >= limit {
+			break
+		}
+	}
+	if added == 0 {
+		return logs, nil
+	}
+
+	sort.Sort(logsByTime(logs))
+	if backwards {
+		reverseLogs(logs)
+	}
+	if len(logs) > limit {
+		logs = logs[:limit]
+	}
+	return logs, nil
+}
+
+func (a *archiveStore) Log(id bson.ObjectId) (irclogsme.LogMessage, error) {
+	log, err := a.Store.Log(id)
+	if !isNotFound(err) {
+		return log, err
+	}
+	archived, ok, aerr := archive.FindLog(a.dir, id)
+	if aerr != nil {
+		return log, aerr
+	} else if !ok {
+		return log, err
+	}
+	return archived, nil
+}
+
+// Search ranks what's in the database, then carries on into the archive, newest day first. There's
+// no index to rank archived days by, so their matches all come after the database's, newest first,
+// and they're only read as far as the page needs - if that's short of the end, Total is too.
+func (a *archiveStore) Search(filter irclogsme.SearchFilter, offset, limit int) (SearchPage, error) {
+	page, err := a.Store.Search(filter, offset, limit)
+	if err != nil {
+		return page, err
+	}
+	dates, err := archive.Dates(a.dir, filter.NetworkId, filter.Channel)
+	if err != nil || len(dates) == 0 {
+		return page, err
+	}
+	// retention only deletes a day once it's archived it, so a day in both is the database's
+	inDatabase, err := a.Store.ChannelDates(filter.NetworkId, filter.Channel)
+	if err != nil {
+		return page, err
+	}
+	skipDay := make(map[string]bool)
+	for _, date := range inDatabase {
+		skipDay[date] = true
+	}
+
+	// how many archived matches to step over before the page starts
+	skip := offset - page.Total
+	if skip < 0 {
+		skip = 0
+	}
+	first, last := "", "9999-99-99"
+	if !filter.From.IsZero() {
+		first = filter.From.AddDate(0, 0, -1).Format("2006-01-02")
+	}
+	if !filter.To.IsZero() {
+		last = filter.To.AddDate(0, 0, 1).Format("2006-01-02")
+	}
+	for n := len(dates) - 1; n >= 0; n-- {
+		if dates[n] < first || dates[n] > last || skipDay[dates[n]] {
+			continue
+		}
+		if len(page.Matches) >= limit {
+			// there might be more, but the page is full
+			page.Truncated = true
+			return page, nil
+		}
+		archived, err := archive.ReadDay(a.dir, filter.NetworkId, filter.Channel, dates[n])
+		if err != nil {
+			return page, err
+		}
+		for i := len(archived) - 1; i >= 0; i-- {
+			msg := archived[i]
+			if !filter.Match(msg) {
+				continue
+			}
+			page.Total++
+			if skip > 0 {
+				skip--
+			} else if len(page.Matches) < limit {
+				page.Matches = append(page.Matches, irclogsme.SearchMatch{LogMessage: msg})
+			}
+		}
+	}
+	return page, nil
+}
@@ -0,0 +1,33 @@
+package server
+
+import (
+	"net/http"
+	"strings"
+)
+
+// corsHandler lets browsers on origins call h. "*" lets anyone; no origins lets nobody.
+func corsHandler(origins []string, h http.Handler) http.Handler {
+	allowed := make(map[string]bool)
+	for _, origin := range origins {
+		allowed[strings.ToLower(strings.TrimSuffix(origin, "/"))] = true
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		heads := w.Header()
+		if allowed["*"] {
+			heads.Set("Access-Control-Allow-Origin", "*")
+		} else if origin := r.Header.Get("Origin"); origin != "" {
+			heads.Add("Vary", "Origin")
+			if allowed[strings.ToLower(origin)] {
+				heads.Set("Access-Control-Allow-Origin", origin)
+			}
+		}
+		if r.Method == "OPTIONS" {
+			heads.Add("Access-Control-Allow-Headers", "origin, x-requested-with, accept")
+			w.WriteHeader(200)
+			w.Write([]byte("ok"))
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,61 @@
+package server
+
+import (
+	"fmt"
+	"log"
+)
+
+// errors more than one handler gives. The messages are what v1 always said.
+var (
+	errBadFormat = badRequest("bad_format", "bad format")
+	errBadTz     = badRequest("bad_tz", "bad tz")
+	errBadDate   = badRequest("bad_date", "bad date")
+)
+
+// apiError is an error with the status it's served with. Code says which error it is, for
+// clients that want to tell them apart - v1 only shows the message.
+type apiError struct {
+	Status  int
+	Code    string
+	Message string
+}
+
+func (e *apiError) Error() string {
+	return e.Message
+}
+
+func newApiError(status int, code string, format string, args ...interface{}) *apiError {
+	return &apiError{Status: status, Code: code, Message: fmt.Sprintf(format, args...)}
+}
+
+func badRequest(code string, format string, args ...interface{}) *apiError {
+	return newApiError(400, code, format, args...)
+}
+
+func notFound(code string, format string, args ...interface{}) *apiError {
+	return newApiError(404, code, format, args...)
+}
+
+// asApiError makes anything an apiError. Store errors other than not found are our fault, and
+// what went wrong is logged rather than shown.
+func asApiError(err error) *apiError {
+	if apiErr, ok := err.(*apiError); ok {
+		return apiErr
+	}
+	if isNotFound(err) {
+		return notFound("not_found", "not found")
+	}
+	log.Println("internal error:", err)
+	return newApiError(500, "internal", "internal error")
+}
+
+// statusOf is the status err should be served with
+func statusOf(err error) int {
+	if apiErr, ok := err.(*apiError); ok {
+		return apiErr.Status
+	}
+	if isNotFound(err) {
+		return 404
+	}
+	return 500
+}
@@ -0,0 +1,54 @@
+package server
+
+import (
+	"github.com/lukegb/irclogsme"
+	"github.com/lukegb/irclogsme/export"
+	"log"
+	"mime"
+	"net/http"
+	"time"
+)
+
+// exportChannel streams ?from=&to= (days, both included, both optional) as a tar.gz or zip of
+// ?format= files, one per day. It only returns an error if nothing's been written - once the
+// archive's started there's no taking the 200 back, so later errors just cut it short.
+func exportChannel(w http.ResponseWriter, r *http.Request, store Store, network irclogsme.NetworkConfig, channelName string) error {
+	values := r.URL.Query()
+	format, archiveType := values.Get("format"), values.Get("archive")
+	if format == "" {
+		format = export.FORMAT_TEXT
+	}
+	if archiveType == "" {
+		archiveType = export.ARCHIVE_TARGZ
+	}
+	exp, err := export.New(network, channelName, format, archiveType)
+	if err != nil {
+		return badRequest("bad_format", "%s", err.Error())
+	}
+
+	from, to := values.Get("from"), values.Get("to")
+	for _, date := range []string{from, to} {
+		if _, err := time.Parse("2006-01-02", date); date != "" && err != nil {
+			return errBadDate
+		}
+	}
+	dates, err := store.ChannelDates(network.Id, channelName)
+	if err != nil {
+		return err
+	}
+	dates = export.InRange(dates, from, to)
+	if len(dates) == 0 {
+		return notFound("no_logs", "not found")
+	}
+
+	w.Header().Set("Content-Type", exp.ContentType())
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": exp.FileName()}))
+	w.WriteHeader(200)
+	err = exp.Write(w, dates, func(date string) ([]irclogsme.LogMessage, error) {
+		return store.DayLogs(network.Id, channelName, date)
+	})
+	if err != nil {
+		log.Printf("export of %s on %s failed part way: %s", channelName, network.Name, err.Error())
+	}
+	return nil
+}
@@ -0,0 +1,208 @@
+package server
+
+import (
+	"bytes"
+	"net/url"
+	"strings"
+)
+
+const (
+	FORMAT_RAW   = "raw"
+	FORMAT_PLAIN = "plain"
+	FORMAT_SPANS = "spans"
+)
+
+const (
+	mircBold          = '\x02'
+	mircColour        = '\x03'
+	mircHexColour     = '\x04'
+	mircReset         = '\x0f'
+	mircMonospace     = '\x11'
+	mircReverse       = '\x16'
+	mircItalic        = '\x1d'
+	mircStrikethrough = '\x1e'
+	mircUnderline     = '\x1f'
+)
+
+type Span struct {
+	Text string `json:"text"`
+
+	Bold          bool `json:"bold,omitempty"`
+	Italic        bool `json:"italic,omitempty"`
+	Underline     bool `json:"underline,omitempty"`
+	Strikethrough bool `json:"strikethrough,omitempty"`
+	Monospace     bool `json:"monospace,omitempty"`
+
+	Fg *int `json:"fg,omitempty"`
+	Bg *int `json:"bg,omitempty"`
+}
+
+type FormattedText struct {
+	Text  string `json:"text"`
+	Spans []Span `json:"spans"`
+}
+
+// spanStyle is the formatting state while walking a message; -1 means no colour
+type spanStyle struct {
+	bold, italic, underline, strikethrough, monospace, reverse bool
+	fg, bg                                                     int
+}
+
+var noStyle = spanStyle{fg: -1, bg: -1}
+
+func (s spanStyle) span(text string) Span {
+	sp := Span{
+		Text:          text,
+		Bold:          s.bold,
+		Italic:        s.italic,
+		Underline:     s.underline,
+		Strikethrough: s.strikethrough,
+		Monospace:     s.monospace,
+	}
+	fg, bg := s.fg, s.bg
+	if s.reverse {
+		fg, bg = bg, fg
+		// reversing with no colours set still has to look reversed
+		if fg == -1 {
+			fg = 0
+		}
+		if bg == -1 {
+			bg = 1
+		}
+	}
+	if fg != -1 {
+		sp.Fg = &fg
+	}
+	if bg != -1 {
+		sp.Bg = &bg
+	}
+	return sp
+}
+
+// readColourNumber reads up to two decimal digits from the start of s
+func readColourNumber(s string) (int, int) {
+	n, i := 0, 0
+	for i < len(s) && i < 2 && s[i] >= '0' && s[i] <= '9' {
+		n = n*10 + int(s[i]-'0')
+		i++
+	}
+	if i == 0 {
+		return -1, 0
+	}
+	return n, i
+}
+
+func isHexColour(s string) bool {
+	if len(s) < 6 {
+		return false
+	}
+	for i := 0; i < 6; i++ {
+		c := s[i]
+		if !((c >= '0' && c <= '9') || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F')) {
+			return false
+		}
+	}
+	return true
+}
+
+// parseFormatting splits an IRC message into styled spans, dropping the control codes
+func parseFormatting(msg string) []Span {
+	spans := make([]Span, 0)
+	style := noStyle
+	var buf bytes.Buffer
+
+	flush := func() {
+		if buf.Len() == 0 {
+			return
+		}
+		spans = append(spans, style.span(buf.String()))
+		buf.Reset()
+	}
+
+	for i := 0; i < len(msg); i++ {
+		switch msg[i] {
+		case mircBold:
+			flush()
+			style.bold = !style.bold
+		case mircItalic:
+			flush()
+			style.italic = !style.italic
+		case mircUnderline:
+			flush()
+			style.underline = !style.underline
+		case mircStrikethrough:
+			flush()
+			style.strikethrough = !style.strikethrough
+		case mircMonospace:
+			flush()
+			style.monospace = !style.monospace
+		case mircReverse:
+			flush()
+			style.reverse = !style.reverse
+		case mircReset:
+			flush()
+			style = noStyle
+		case mircColour:
+			flush()
+			fg, n := readColourNumber(msg[i+1:])
+			if n == 0 {
+				// a bare \x03 resets colours
+				style.fg, style.bg = -1, -1
+				continue
+			}
+			i += n
+			style.fg = fg
+			if i+2 < len(msg) && msg[i+1] == ',' {
+				if bg, m := readColourNumber(msg[i+2:]); m > 0 {
+					style.bg = bg
+					i += m + 1
+				}
+			}
+		case mircHexColour:
+			// we don't do RGB, but we do need to eat the codes
+			flush()
+			if isHexColour(msg[i+1:]) {
+				i += 6
+				if i+1 < len(msg) && msg[i+1] == ',' && isHexColour(msg[i+2:]) {
+					i += 7
+				}
+			}
+		default:
+			buf.WriteByte(msg[i])
+		}
+	}
+	flush()
+
+	return spans
+}
+
+func stripFormatting(msg string) string {
+	if strings.IndexFunc(msg, isFormattingCode) == -1 {
+		return msg
+	}
+	var buf bytes.Buffer
+	for _, span := range parseFormatting(msg) {
+		buf.WriteString(span.Text)
+	}
+	return buf.String()
+}
+
+func isFormattingCode(r rune) bool {
+	switch r {
+	case mircBold, mircColour, mircHexColour, mircReset, mircMonospace, mircReverse, mircItalic, mircStrikethrough, mircUnderline:
+		return true
+	}
+	return false
+}
+
+func validFormat(format string) bool {
+	return format == FORMAT_RAW || format == FORMAT_PLAIN || format == FORMAT_SPANS
+}
+
+// formatRequested pulls the wanted message format out of the query string
+func formatRequested(values url.Values) string {
+	if f := values.Get("format"); f != "" {
+		return f
+	}
+	return FORMAT_RAW
+}
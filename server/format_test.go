@@ -0,0 +1,63 @@
+package server
+
+import (
+	"reflect"
+	"testing"
+)
+
+func colour(n int) *int {
+	return &n
+}
+
+var formattingTests = []struct {
+	in    string
+	spans []Span
+}{
+	{"", []Span{}},
+	{"plain", []Span{{Text: "plain"}}},
+	{"\x02bold\x02 not", []Span{{Text: "bold", Bold: true}, {Text: " not"}}},
+	{"\x1ditalic\x1funder\x0freset", []Span{{Text: "italic", Italic: true}, {Text: "under", Italic: true, Underline: true}, {Text: "reset"}}},
+	{"\x1estrike\x11mono", []Span{{Text: "strike", Strikethrough: true}, {Text: "mono", Strikethrough: true, Monospace: true}}},
+	{"\x034red", []Span{{Text: "red", Fg: colour(4)}}},
+	{"\x0304,12red on blue", []Span{{Text: "red on blue", Fg: colour(4), Bg: colour(12)}}},
+	// three digits is two digits of colour and a digit of text
+	{"\x03123", []Span{{Text: "3", Fg: colour(12)}}},
+	// a comma without a number after it is just text
+	{"\x034,x", []Span{{Text: ",x", Fg: colour(4)}}},
+	{"\x034,", []Span{{Text: ",", Fg: colour(4)}}},
+	{"\x034red\x03plain", []Span{{Text: "red", Fg: colour(4)}, {Text: "plain"}}},
+	{"\x034,5a\x036b", []Span{{Text: "a", Fg: colour(4), Bg: colour(5)}, {Text: "b", Fg: colour(6), Bg: colour(5)}}},
+	{"\x16rev", []Span{{Text: "rev", Fg: colour(0), Bg: colour(1)}}},
+	{"\x034,5\x16rev", []Span{{Text: "rev", Fg: colour(5), Bg: colour(4)}}},
+	{"\x04ff0000red\x04", []Span{{Text: "red"}}},
+	{"\x04ff0000,00ff00both", []Span{{Text: "both"}}},
+	{"\x04nothex", []Span{{Text: "nothex"}}},
+	{"\x02\x02", []Span{}},
+}
+
+func TestParseFormatting(t *testing.T) {
+	for _, tt := range formattingTests {
+		spans := parseFormatting(tt.in)
+		if !reflect.DeepEqual(spans, tt.spans) {
+			t.Errorf("parseFormatting(%q) = %+v, want %+v", tt.in, spans, tt.spans)
+		}
+	}
+}
+
+var stripTests = []struct {
+	in, out string
+}{
+	{"", ""},
+	{"no codes", "no codes"},
+	{"\x02bold\x02 \x0304,12colour\x03 \x1ditalic", "bold colour italic"},
+	{"\x03123", "3"},
+	{"\x04ff0000hex", "hex"},
+}
+
+func TestStripFormatting(t *testing.T) {
+	for _, tt := range stripTests {
+		if out := stripFormatting(tt.in); out != tt.out {
+			t.Errorf("stripFormatting(%q) = %q, want %q", tt.in, out, tt.out)
+		}
+	}
+}
@@ -4,9 +4,9 @@ import (
 	"bufio"
 	"code.google.com/p/go.net/websocket"
 	"encoding/json"
-	"errors"
+	"flag"
 	"github.com/lukegb/irclogsme"
-	"labix.org/v2/mgo"
+	"github.com/lukegb/irclogsme/config"
 	"labix.org/v2/mgo/bson"
 	"log"
 	"net/http"
@@ -35,8 +35,9 @@ type FullChannel struct {
 }
 
 type LogKick struct {
-	Target  string
-	Message string
+	Target       string
+	Message      string
+	MessageSpans []Span `json:",omitempty"`
 }
 
 type Log struct {
@@ -48,6 +49,10 @@ type Log struct {
 	Ident string `json:"ident"`
 	Host  string `json:"host"`
 
+	Account string `json:"account,omitempty"`
+	MsgId   string `json:"msgid,omitempty"`
+	ReplyTo string `json:"reply_to,omitempty"`
+
 	Type string `json:"type"`
 
 	Data interface{} `json:"data"`
@@ -60,14 +65,6 @@ type Logs struct {
 
 func jsonResponsinator(z func(r *http.Request) (interface{}, int)) func(http.ResponseWriter, *http.Request) {
 	return func(w http.ResponseWriter, r *http.Request) {
-		heads := w.Header()
-		heads.Add("Access-Control-Allow-Origin", "*")
-		if r.Method == "OPTIONS" {
-			heads.Add("Access-Control-Allow-Headers", "origin, x-requested-with, accept")
-			w.WriteHeader(200)
-			w.Write([]byte("ok"))
-			return
-		}
 		resp, status := z(r)
 		if erre, ok := resp.(error); ok {
 			if erre.Error() == "not found" {
@@ -97,74 +94,108 @@ func networkMorph(nc irclogsme.NetworkConfig) Network {
 	return res
 }
 
-func channelMorph(networkId bson.ObjectId, channelName string, db *mgo.Database) (*FullChannel, error) {
+// channelMorph lists the channel's days - in loc if it's not nil, otherwise in the channel's own timezone
+func channelMorph(network irclogsme.NetworkConfig, channelName string, loc *time.Location, store Store) (*FullChannel, error) {
 	channel := new(FullChannel)
 	channel.Name = channelName
 
-	collect := db.C("logs")
-	q := collect.Find(bson.M{"networkid": networkId, "channel": channelName})
-	var dates []string
-	err := q.Distinct("splitdate", &dates)
+	dates, err := store.ChannelDates(network.Id, channelName)
 	if err != nil {
 		return nil, err
 	}
+	if loc != nil {
+		dates = rebucketDates(dates, network.LocationFor(channelName), loc)
+	}
 
 	channel.LogDates = dates
 
 	return channel, nil
 }
 
-func networkOk(networkName string, db *mgo.Database) (irclogsme.NetworkConfig, error) {
-	result := new(irclogsme.NetworkConfig)
-	err := db.C("networks").Find(bson.M{"name": networkName}).One(result)
-	if err != nil {
-		return *result, err
+func networkOk(networkName string, store Store) (irclogsme.NetworkConfig, error) {
+	return store.Network(networkName)
+}
+
+// channelOk turns the channel bit of the URL into the name we log under. '#' is implied,
+// any other channel type is spelt out - /api/net/foo is #foo, /api/net/&foo is &foo
+func channelOk(channelSegment string, network irclogsme.NetworkConfig) (string, bool) {
+	channelName := "#" + channelSegment
+	if channelSegment != "" && channelSegment[0] != '#' && irclogsme.IsChannelName(network.ChannelTypes(), channelSegment) {
+		channelName = channelSegment
 	}
-	return *result, nil
+	return network.FindChannel(channelName)
 }
 
-func channelOk(channelName string, network irclogsme.NetworkConfig) bool {
-	_, channelOk := network.Channels[channelName]
-	return channelOk
+func formatMorph(sdata string, format string) interface{} {
+	switch format {
+	case FORMAT_PLAIN:
+		return stripFormatting(sdata)
+	case FORMAT_SPANS:
+		return FormattedText{Text: stripFormatting(sdata), Spans: parseFormatting(sdata)}
+	}
+	return sdata
+}
+
+// apiVersion is which API a response is for, where v1 and v2 say the same thing differently
+type apiVersion int
+
+const (
+	API_V1 apiVersion = 1
+	API_V2 apiVersion = 2
+)
+
+// messageId is id as v spells it. v1 has always given bson's ObjectIdHex("..."), which clients
+// pick apart; v2 gives just the hex.
+func (v apiVersion) messageId(id bson.ObjectId) string {
+	if v == API_V1 {
+		return id.String()
+	}
+	return id.Hex()
 }
 
-func logMorph(log irclogsme.LogMessage) Log {
+func logMorph(log irclogsme.LogMessage, format string, version apiVersion) Log {
+	// stores should have done this already, but a row that predates typed payloads mustn't
+	// become a blank line
+	log.Upgrade()
 	res := Log{
-		Id:    log.Id.String(),
+		Id:    version.messageId(log.Id),
 		Time:  log.Time,
 		Nick:  log.Nick,
 		Ident: log.Ident,
 		Host:  log.Host,
+
+		Account: log.Account,
+		MsgId:   log.MsgId,
+		ReplyTo: log.ReplyTo,
 	}
 	// now to specify
 	switch log.Type {
 	case irclogsme.LMT_PRIVMSG:
 		res.Type = "privmsg"
-		res.Data = log.Payload
+		res.Data = log.Data.Text
 	case irclogsme.LMT_NOTICE:
 		res.Type = "notice"
-		res.Data = log.Payload
+		res.Data = log.Data.Text
 	case irclogsme.LMT_JOIN:
 		res.Type = "join"
 	case irclogsme.LMT_PART:
 		res.Type = "part"
-		res.Data = log.Payload
+		res.Data = log.Data.Text
 	case irclogsme.LMT_TOPIC:
 		res.Type = "topic"
-		res.Data = log.Payload
+		res.Data = log.Data.Text
 	case irclogsme.LMT_QUIT:
 		res.Type = "quit"
-		res.Data = log.Payload
+		res.Data = log.Data.Text
 	case irclogsme.LMT_ACTION:
 		res.Type = "action"
-		res.Data = log.Payload
+		res.Data = log.Data.Text
+	case irclogsme.LMT_NICK:
+		res.Type = "nick"
+		res.Data = log.Data.Text
 	case irclogsme.LMT_KICK:
 		res.Type = "kick"
-		lk := LogKick{Target: log.Target.(string)}
-		if message, ok := log.Payload.(string); ok {
-			lk.Message = message
-		}
-		res.Data = lk
+		res.Data = LogKick{Target: log.Data.Target, Message: log.Data.Text}
 	}
 	if sdata, ok := res.Data.(string); ok {
 		if !utf8.ValidString(sdata) {
@@ -177,40 +208,51 @@ func logMorph(log irclogsme.LogMessage) Log {
 			res.Data = lk
 		}
 	}
+	if format != FORMAT_RAW {
+		if sdata, ok := res.Data.(string); ok {
+			res.Data = formatMorph(sdata, format)
+		} else if lk, ok := res.Data.(LogKick); ok {
+			if format == FORMAT_SPANS {
+				lk.MessageSpans = parseFormatting(lk.Message)
+			}
+			lk.Message = stripFormatting(lk.Message)
+			res.Data = lk
+		}
+	}
 	return res
 }
 
-func wsHandler(ws *websocket.Conn, networkId bson.ObjectId, channelName string, coll *mgo.Collection) {
-	// get the last object id
+func wsHandler(ws *websocket.Conn, networkId bson.ObjectId, channelName string, format string, version apiVersion, store Store) {
+	// get the last object id - as either version spells it
 	bufReader := bufio.NewReader(ws)
 	objectId, err := bufReader.ReadString('\n')
-	objectId = objectId[:len(objectId)-1]
 	if err != nil {
 		panic(err)
 	}
-	objectIdH := bson.ObjectIdHex(objectId)
+	objectIdH, ok := parseMessageId(strings.TrimSpace(objectId))
+	if !ok {
+		ws.Write([]byte("BAD ID\n"))
+		return
+	}
 
-	var lastLog irclogsme.LogMessage
-	err = coll.Find(bson.M{"_id": objectIdH}).One(&lastLog)
+	lastLog, err := store.Log(objectIdH)
 	if err != nil {
 		panic(err)
 	}
 	ws.Write([]byte("RUNNING\n"))
 
 	// check any newer
-	var logs []irclogsme.LogMessage
 	timer := time.Tick(1 * time.Second)
 	for {
 		<-timer
-		q := coll.Find(bson.M{"networkid": networkId, "channel": channelName, "time": bson.M{"$gt": lastLog.Time}}).Sort("time")
-		err := q.All(&logs)
+		logs, err := store.LogsAfter(networkId, channelName, lastLog.Time)
 		if err != nil {
 			panic(err)
 		}
 
 		for _, loga := range logs {
 			log.Println(loga)
-			logFormat := logMorph(loga)
+			logFormat := logMorph(loga, format, version)
 			form, err := json.Marshal(logFormat)
 			if err != nil {
 				panic(err)
@@ -224,149 +266,52 @@ func wsHandler(ws *websocket.Conn, networkId bson.ObjectId, channelName string,
 	}
 }
 
+// NewHandler serves the API out of store, to browsers on corsOrigins
+func NewHandler(store Store, corsOrigins []string) http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("/api/v2/", v2Routes(store))
+	mux.Handle("/api/", v1Routes(store))
+	return corsHandler(corsOrigins, mux)
+}
+
+// what the server does if nothing says otherwise
+var DEFAULT_SETTINGS = config.Settings{
+	DBConnString: "mongodb://localhost/irclogsme",
+	ListenAddr:   ":5022",
+	CORSOrigins:  []string{"*"},
+	ReadTimeout:  config.Duration(30 * time.Second),
+}
+
+// what OpenStore understands
+var STORE_SCHEMES = []string{"mongodb", "sqlite", "postgres", "postgresql", "memory"}
+
 func Start() {
-	dbc, err := mgo.Dial("mongodb://localhost/irclogsme")
+	loader := config.NewLoader(flag.CommandLine, config.DB|config.LISTEN|config.TLS|config.CORS|config.TIMEOUTS|config.ARCHIVE)
+	loader.Schemes = STORE_SCHEMES
+	flag.Parse()
+	settings, err := loader.Load(DEFAULT_SETTINGS)
 	if err != nil {
 		log.Fatalln(err)
 	}
-	db := dbc.DB("")
-
-	prefix := "/api/"
-	http.HandleFunc(prefix, func(w http.ResponseWriter, r *http.Request) {
-		// figure out what mode we're in
-		chopped := ""
-		if len(r.URL.Path) > len(prefix) {
-			chopped = r.URL.Path[len(prefix):]
-		}
-		choppedBits := strings.Split(chopped, "/")
-		slashCount := strings.Count(chopped, "/")
-		if slashCount == 3 && choppedBits[2] == "ws" { // websoketz
-			serverName := choppedBits[0]
-			channelName := "#" + choppedBits[1]
-			// fetch the network
-			network, err := networkOk(serverName, db)
-			if err != nil {
-				http.Error(w, err.Error(), 500)
-			}
-
-			// check if the channel's in the list
-			if !channelOk(channelName, network) {
-				http.Error(w, "not found", 404)
-			}
 
-			// return logs
-			coll := db.C("logs")
-			q := coll.Find(bson.M{"networkid": network.Id, "channel": channelName}).Sort("time")
-			count, err := q.Count()
-			if err != nil {
-				http.Error(w, err.Error(), 500)
-			} else if count == 0 {
-				http.Error(w, "not found", 404)
-			}
-
-			// OK, let's go
-			websocket.Handler(func(ws *websocket.Conn) { wsHandler(ws, network.Id, channelName, coll) }).ServeHTTP(w, r)
-		} else if slashCount == 3 { // date, server and channel - return logs!
-			jsonResponsinator(func(r *http.Request) (interface{}, int) {
-				serverName := choppedBits[0]
-				channelName := "#" + choppedBits[1]
-				logDate := choppedBits[2]
-
-				// fetch the network
-				network, err := networkOk(serverName, db)
-				if err != nil {
-					return err, 500
-				}
-
-				// check if the channel's in the list
-				if !channelOk(channelName, network) {
-					return errors.New("not found"), 404
-				}
-
-				// return logs
-				coll := db.C("logs")
-				q := coll.Find(bson.M{"networkid": network.Id, "channel": channelName, "splitdate": logDate}).Sort("time")
-				var qRes []irclogsme.LogMessage
-				err = q.All(&qRes)
-				if err != nil {
-					return err, 500
-				}
-
-				if len(qRes) == 0 {
-					return errors.New("not found"), 404
-				}
-
-				res := make([]Log, len(qRes))
-				for k, v := range qRes {
-					res[k] = logMorph(v)
-				}
-
-				var response Logs
-				response.Logs = res
-				fullChan, err := channelMorph(network.Id, channelName, db)
-				if err != nil {
-					return err, 500
-				}
-				response.Channel = *fullChan
-
-				return response, 200
-			})(w, r)
-		} else if slashCount == 2 { // server and channel passed?
-			jsonResponsinator(func(r *http.Request) (interface{}, int) {
-				serverName := choppedBits[0]
-				channelName := "#" + choppedBits[1]
-
-				// fetch the network
-				network, err := networkOk(serverName, db)
-				if err != nil {
-					return err, 500
-				}
-
-				// check if the channel's in the list
-				if !channelOk(channelName, network) {
-					return errors.New("not found"), 404
-				}
-
-				// checks out OK, channelmorph
-				res, err := channelMorph(network.Id, channelName, db)
-				if err != nil {
-					return err, 500
-				}
-
-				return res, 200
-			})(w, r)
-		} else if slashCount == 1 { // server passed?
-			jsonResponsinator(func(r *http.Request) (interface{}, int) {
-				serverName := choppedBits[0]
-				// perform lookup
-				result := new(irclogsme.NetworkConfig)
-				err := db.C("networks").Find(bson.M{"name": serverName}).One(result)
-				if err != nil {
-					return err, 500
-				}
-				true_result := networkMorph(*result)
-				return true_result, 200
-			})(w, r)
-		} else if slashCount == 0 {
-			jsonResponsinator(func(r *http.Request) (interface{}, int) {
-				result := make([]irclogsme.NetworkConfig, 0)
-				err := db.C("networks").Find(bson.M{}).All(&result)
-				if err != nil {
-					return err, 500
-				}
-
-				true_result := make([]Network, len(result))
-				for n, val := range result {
-					true_result[n] = networkMorph(val)
-				}
-				return true_result, 200
-			})(w, r)
-		} else {
-			jsonResponsinator(func(r *http.Request) (interface{}, int) {
-				return errors.New("not found"), 400
-			})(w, r)
-		}
-	})
+	store, err := OpenStore(settings.DBConnString)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	if settings.ArchiveDir != "" {
+		store = NewArchiveStore(store, settings.ArchiveDir)
+	}
 
-	log.Fatalln(http.ListenAndServe(":5022", nil))
+	srv := &http.Server{
+		Addr:         settings.ListenAddr,
+		Handler:      NewHandler(store, settings.CORSOrigins),
+		ReadTimeout:  time.Duration(settings.ReadTimeout),
+		WriteTimeout: time.Duration(settings.WriteTimeout),
+	}
+	if settings.TLSCert != "" {
+		log.Printf("serving https on %s", settings.ListenAddr)
+		log.Fatalln(srv.ListenAndServeTLS(settings.TLSCert, settings.TLSKey))
+	}
+	log.Printf("serving http on %s", settings.ListenAddr)
+	log.Fatalln(srv.ListenAndServe())
 }
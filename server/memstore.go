@@ -0,0 +1,215 @@
+package server
+
+import (
+	"github.com/lukegb/irclogsme"
+	"labix.org/v2/mgo/bson"
+	"sort"
+	"sync"
+	"time"
+)
+
+// MemoryStore keeps everything in maps. It's for tests and for poking at the API without a database.
+type MemoryStore struct {
+	lock     sync.RWMutex
+	networks map[string]irclogsme.NetworkConfig
+	logs     []irclogsme.LogMessage
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{networks: make(map[string]irclogsme.NetworkConfig)}
+}
+
+// AddNetwork adds or replaces a network, giving it an id if it hasn't got one
+func (m *MemoryStore) AddNetwork(net irclogsme.NetworkConfig) irclogsme.NetworkConfig {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if net.Id == "" {
+		net.Id = bson.NewObjectId()
+	}
+	m.networks[net.Name] = net
+	return net
+}
+
+// AddLog stores a message, giving it an id and a SplitDate if it hasn't got them
+func (m *MemoryStore) AddLog(msg irclogsme.LogMessage) irclogsme.LogMessage {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if msg.Id == "" {
+		msg.Id = bson.NewObjectId()
+	}
+	if msg.SplitDate == "" {
+		msg.SplitDate = irclogsme.SplitDate(msg.Time, time.UTC)
+	}
+	m.logs = append(m.logs, msg)
+	sort.Stable(logsByTime(m.logs))
+	return msg
+}
+
+// logsByTime is oldest first, with ties going by id like the databases' ORDER BY time, id
+type logsByTime []irclogsme.LogMessage
+
+func (l logsByTime) Len() int { return len(l) }
+func (l logsByTime) Less(i, j int) bool {
+	return l[i].Time.Before(l[j].Time) || (l[i].Time.Equal(l[j].Time) && l[i].Id < l[j].Id)
+}
+func (l logsByTime) Swap(i, j int) { l[i], l[j] = l[j], l[i] }
+
+func reverseLogs(logs []irclogsme.LogMessage) {
+	for i, j := 0, len(logs)-1; i < j; i, j = i+1, j-1 {
+		logs[i], logs[j] = logs[j], logs[i]
+	}
+}
+
+// filter returns the channel's logs for which f is true, oldest first
+func (m *MemoryStore) filter(networkId bson.ObjectId, channel string, f func(irclogsme.LogMessage) bool) []irclogsme.LogMessage {
+	res := make([]irclogsme.LogMessage, 0)
+	for _, msg := range m.logs {
+		if msg.NetworkId == networkId && msg.Channel == channel && f(msg) {
+			res = append(res, msg)
+		}
+	}
+	return res
+}
+
+func (m *MemoryStore) Networks() ([]irclogsme.NetworkConfig, error) {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	names := make([]string, 0, len(m.networks))
+	for name := range m.networks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	res := make([]irclogsme.NetworkConfig, len(names))
+	for n, name := range names {
+		res[n] = m.networks[name]
+	}
+	return res, nil
+}
+
+func (m *MemoryStore) Network(name string) (irclogsme.NetworkConfig, error) {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	net, ok := m.networks[name]
+	if !ok {
+		return net, errNotFound
+	}
+	return net, nil
+}
+
+func (m *MemoryStore) ChannelDates(networkId bson.ObjectId, channel string) ([]string, error) {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	seen := make(map[string]bool)
+	dates := make([]string, 0)
+	for _, msg := range m.filter(networkId, channel, func(irclogsme.LogMessage) bool { return true }) {
+		if !seen[msg.SplitDate] {
+			seen[msg.SplitDate] = true
+			dates = append(dates, msg.SplitDate)
+		}
+	}
+	sort.Strings(dates)
+	return dates, nil
+}
+
+func (m *MemoryStore) CountChannelLogs(networkId bson.ObjectId, channel string) (int, error) {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	return len(m.filter(networkId, channel, func(irclogsme.LogMessage) bool { return true })), nil
+}
+
+func (m *MemoryStore) DayLogs(networkId bson.ObjectId, channel string, splitDate string) ([]irclogsme.LogMessage, error) {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	return m.filter(networkId, channel, func(msg irclogsme.LogMessage) bool {
+		return msg.SplitDate == splitDate
+	}), nil
+}
+
+func (m *MemoryStore) LogsBetween(networkId bson.ObjectId, channel string, from, to time.Time) ([]irclogsme.LogMessage, error) {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	return m.filter(networkId, channel, func(msg irclogsme.LogMessage) bool {
+		return !msg.Time.Before(from) && msg.Time.Before(to)
+	}), nil
+}
+
+func (m *MemoryStore) LogsAfter(networkId bson.ObjectId, channel string, t time.Time) ([]irclogsme.LogMessage, error) {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	return m.filter(networkId, channel, func(msg irclogsme.LogMessage) bool {
+		return msg.Time.After(t)
+	}), nil
+}
+
+func (m *MemoryStore) Log(id bson.ObjectId) (irclogsme.LogMessage, error) {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	for _, msg := range m.logs {
+		if msg.Id == id {
+			return msg, nil
+		}
+	}
+	return irclogsme.LogMessage{}, errNotFound
+}
+
+func (m *MemoryStore) LogsFrom(networkId bson.ObjectId, channel string, pos irclogsme.Position, backwards bool, limit int) ([]irclogsme.LogMessage, error) {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	found := m.filter(networkId, channel, func(msg irclogsme.LogMessage) bool {
+		switch {
+		case pos.IsZero():
+			return true
+		case backwards:
+			return pos.Follows(msg)
+		}
+		return pos.Precedes(msg)
+	})
+	if backwards {
+		reverseLogs(found)
+	}
+	if len(found) > limit {
+		found = found[:limit]
+	}
+	return found, nil
+}
+
+func (m *MemoryStore) Search(filter irclogsme.SearchFilter, offset, limit int) (SearchPage, error) {
+	m.lock.RLock()
+	found := m.filter(filter.NetworkId, filter.Channel, filter.Match)
+	m.lock.RUnlock()
+
+	// found is oldest first, so backwards and a stable sort leaves equal scores newest first
+	matches := make([]irclogsme.SearchMatch, 0, len(found))
+	for i := len(found) - 1; i >= 0; i-- {
+		matches = append(matches, irclogsme.SearchMatch{LogMessage: found[i], Score: filter.Score(found[i])})
+	}
+	sort.Stable(byScore(matches))
+
+	page := SearchPage{Total: len(matches), Matches: make([]irclogsme.SearchMatch, 0)}
+	if offset < len(matches) {
+		matches = matches[offset:]
+		if len(matches) > limit {
+			matches = matches[:limit]
+		}
+		page.Matches = matches
+	}
+	return page, nil
+}
+
+type byScore []irclogsme.SearchMatch
+
+func (b byScore) Len() int           { return len(b) }
+func (b byScore) Less(i, j int) bool { return b[i].Score > b[j].Score }
+func (b byScore) Swap(i, j int)      { b[i], b[j] = b[j], b[i] }
@@ -0,0 +1,179 @@
+package server
+
+import (
+	"github.com/lukegb/irclogsme"
+	"labix.org/v2/mgo"
+	"labix.org/v2/mgo/bson"
+	"regexp"
+	"strings"
+	"time"
+)
+
+type mongoStore struct {
+	db *mgo.Database
+}
+
+func (m *mongoStore) Networks() ([]irclogsme.NetworkConfig, error) {
+	result := make([]irclogsme.NetworkConfig, 0)
+	err := m.db.C("networks").Find(bson.M{}).All(&result)
+	return result, err
+}
+
+func (m *mongoStore) Network(name string) (irclogsme.NetworkConfig, error) {
+	var result irclogsme.NetworkConfig
+	err := m.db.C("networks").Find(bson.M{"name": name}).One(&result)
+	return result, err
+}
+
+func (m *mongoStore) ChannelDates(networkId bson.ObjectId, channel string) ([]string, error) {
+	var dates []string
+	err := m.db.C("logs").Find(bson.M{"networkid": networkId, "channel": channel}).Distinct("splitdate", &dates)
+	return dates, err
+}
+
+func (m *mongoStore) CountChannelLogs(networkId bson.ObjectId, channel string) (int, error) {
+	return m.db.C("logs").Find(bson.M{"networkid": networkId, "channel": channel}).Count()
+}
+
+func (m *mongoStore) DayLogs(networkId bson.ObjectId, channel string, splitDate string) ([]irclogsme.LogMessage, error) {
+	var logs []irclogsme.LogMessage
+	err := m.db.C("logs").Find(bson.M{"networkid": networkId, "channel": channel, "splitdate": splitDate}).Sort("time").All(&logs)
+	irclogsme.UpgradeAll(logs)
+	return logs, err
+}
+
+func (m *mongoStore) LogsBetween(networkId bson.ObjectId, channel string, from, to time.Time) ([]irclogsme.LogMessage, error) {
+	var logs []irclogsme.LogMessage
+	err := m.db.C("logs").Find(bson.M{"networkid": networkId, "channel": channel, "time": bson.M{"$gte": from, "$lt": to}}).Sort("time").All(&logs)
+	irclogsme.UpgradeAll(logs)
+	return logs, err
+}
+
+func (m *mongoStore) LogsAfter(networkId bson.ObjectId, channel string, t time.Time) ([]irclogsme.LogMessage, error) {
+	var logs []irclogsme.LogMessage
+	err := m.db.C("logs").Find(bson.M{"networkid": networkId, "channel": channel, "time": bson.M{"$gt": t}}).Sort("time").All(&logs)
+	irclogsme.UpgradeAll(logs)
+	return logs, err
+}
+
+func (m *mongoStore) Log(id bson.ObjectId) (irclogsme.LogMessage, error) {
+	var log irclogsme.LogMessage
+	err := m.db.C("logs").Find(bson.M{"_id": id}).One(&log)
+	log.Upgrade()
+	return log, err
+}
+
+func (m *mongoStore) LogsFrom(networkId bson.ObjectId, channel string, pos irclogsme.Position, backwards bool, limit int) ([]irclogsme.LogMessage, error) {
+	query := bson.M{"networkid": networkId, "channel": channel}
+	op, sort := "$gt", []string{"time", "_id"}
+	if backwards {
+		op, sort = "$lt", []string{"-time", "-_id"}
+	}
+	if pos.Id != "" {
+		query["$or"] = []bson.M{{"time": bson.M{op: pos.Time}}, {"time": pos.Time, "_id": bson.M{op: pos.Id}}}
+	} else if !pos.Time.IsZero() {
+		// just a moment, and messages at it are after it
+		if !backwards {
+			op = "$gte"
+		}
+		query["time"] = bson.M{op: pos.Time}
+	}
+
+	var logs []irclogsme.LogMessage
+	err := m.db.C("logs").Find(query).Sort(sort...).Limit(limit).All(&logs)
+	irclogsme.UpgradeAll(logs)
+	return logs, err
+}
+
+func (m *mongoStore) Search(filter irclogsme.SearchFilter, offset, limit int) (SearchPage, error) {
+	query := bson.M{"networkid": filter.NetworkId, "channel": filter.Channel}
+	// payload until the typed payload migration has run
+	either := make([]bson.M, 0)
+	ranked := false
+	if filter.Text != "" {
+		if words := irclogsme.SearchWords(filter.Text); len(words) > 0 {
+			// a quoted phrase, so it's the words together rather than any of them
+			query["$text"] = bson.M{"$search": `"` + strings.Replace(filter.Text, `"`, " ", -1) + `"`}
+			ranked = true
+		} else {
+			// no words for the index to look for, so this one's a scan
+			pattern := bson.RegEx{Pattern: regexp.QuoteMeta(filter.Text), Options: "i"}
+			either = append(either, bson.M{"$or": []bson.M{{"data.text": pattern}, {"payload": pattern}}})
+		}
+	}
+	if filter.Regex != nil {
+		pattern := bson.RegEx{Pattern: pcrePattern(filter.Regex)}
+		either = append(either, bson.M{"$or": []bson.M{{"data.text": pattern}, {"payload": pattern}}})
+	}
+	if len(either) > 0 {
+		query["$and"] = either
+	}
+	if filter.Nick != "" {
+		query["nick"] = bson.RegEx{Pattern: "^" + regexp.QuoteMeta(filter.Nick) + "$", Options: "i"}
+	}
+	if len(filter.Types) > 0 {
+		query["type"] = bson.M{"$in": filter.Types}
+	}
+	if !filter.From.IsZero() || !filter.To.IsZero() {
+		between := bson.M{}
+		if !filter.From.IsZero() {
+			between["$gte"] = filter.From
+		}
+		if !filter.To.IsZero() {
+			between["$lt"] = filter.To
+		}
+		query["time"] = between
+	}
+
+	page := SearchPage{Matches: make([]irclogsme.SearchMatch, 0)}
+	var err error
+	if page.Total, err = m.db.C("logs").Find(query).Count(); err != nil {
+		return page, err
+	}
+
+	if !ranked {
+		var logs []irclogsme.LogMessage
+		err := m.db.C("logs").Find(query).Sort("-time", "-_id").Skip(offset).Limit(limit).All(&logs)
+		irclogsme.UpgradeAll(logs)
+		for _, log := range logs {
+			page.Matches = append(page.Matches, irclogsme.SearchMatch{LogMessage: log})
+		}
+		return page, err
+	}
+
+	// Sort can't ask for the text score, so rank in a pipeline, then fetch the page
+	var scores []struct {
+		Id    bson.ObjectId `bson:"_id"`
+		Score float64
+	}
+	err = m.db.C("logs").Pipe([]bson.M{
+		{"$match": query},
+		{"$project": bson.M{"time": 1, "score": bson.M{"$meta": "textScore"}}},
+		{"$sort": bson.D{{Name: "score", Value: -1}, {Name: "time", Value: -1}, {Name: "_id", Value: -1}}},
+		{"$skip": offset},
+		{"$limit": limit},
+	}).All(&scores)
+	if err != nil || len(scores) == 0 {
+		return page, err
+	}
+	ids := make([]bson.ObjectId, len(scores))
+	for n, s := range scores {
+		ids[n] = s.Id
+	}
+	var logs []irclogsme.LogMessage
+	if err := m.db.C("logs").Find(bson.M{"_id": bson.M{"$in": ids}}).All(&logs); err != nil {
+		return page, err
+	}
+	irclogsme.UpgradeAll(logs)
+	byId := make(map[bson.ObjectId]irclogsme.LogMessage, len(logs))
+	for _, log := range logs {
+		byId[log.Id] = log
+	}
+	for _, s := range scores {
+		// anything that's gone since we ranked it is just left out
+		if log, ok := byId[s.Id]; ok {
+			page.Matches = append(page.Matches, irclogsme.SearchMatch{LogMessage: log, Score: s.Score})
+		}
+	}
+	return page, nil
+}
@@ -0,0 +1,347 @@
+package server
+
+import (
+	"fmt"
+	"github.com/lukegb/irclogsme"
+	"labix.org/v2/mgo/bson"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	PAGE_SIZE     = 100
+	PAGE_MAX_SIZE = 1000
+)
+
+type PagedLog struct {
+	Log
+
+	Date string `json:"date"`
+}
+
+// LogPage is a stretch of a channel, oldest first. Next and Prev are cursors for ?after= and
+// ?before= that get the pages either side of it, and are left out if there's nothing there yet.
+type LogPage struct {
+	Channel string     `json:"channel"`
+	Logs    []PagedLog `json:"logs"`
+
+	Next string `json:"next,omitempty"`
+	Prev string `json:"prev,omitempty"`
+}
+
+// a cursor is a Position as <unix nanoseconds>.<message id>. Clients shouldn't look inside.
+func encodeCursor(pos irclogsme.Position) string {
+	return fmt.Sprintf("%d.%s", pos.Time.UnixNano(), pos.Id.Hex())
+}
+
+func decodeCursor(s string) (irclogsme.Position, bool) {
+	dot := strings.Index(s, ".")
+	if dot == -1 {
+		return irclogsme.Position{}, false
+	}
+	nanos, err := strconv.ParseInt(s[:dot], 10, 64)
+	if err != nil || !bson.IsObjectIdHex(s[dot+1:]) {
+		return irclogsme.Position{}, false
+	}
+	return irclogsme.Position{Time: time.Unix(0, nanos).UTC(), Id: bson.ObjectIdHex(s[dot+1:])}, true
+}
+
+// parseMessageId takes a message id as hex, or as v1 spells them - ObjectIdHex("...")
+func parseMessageId(s string) (bson.ObjectId, bool) {
+	if strings.HasPrefix(s, `ObjectIdHex("`) && strings.HasSuffix(s, `")`) {
+		s = s[len(`ObjectIdHex("`) : len(s)-len(`")`)]
+	}
+	if !bson.IsObjectIdHex(s) {
+		return "", false
+	}
+	return bson.ObjectIdHex(s), true
+}
+
+// channelLog is message id, as long as it's in the channel
+func channelLog(store Store, network irclogsme.NetworkConfig, channelName string, id bson.ObjectId) (irclogsme.LogMessage, error) {
+	msg, err := store.Log(id)
+	if isNotFound(err) || (err == nil && (msg.NetworkId != network.Id || msg.Channel != channelName)) {
+		return msg, notFound("message_not_found", "%s has no message %s", channelName, id.Hex())
+	}
+	return msg, err
+}
+
+// parsePosition reads a cursor, a message id, a time (RFC 3339) or a day, which is its start in loc
+func parsePosition(s string, store Store, network irclogsme.NetworkConfig, channelName string, loc *time.Location) (irclogsme.Position, error) {
+	if pos, ok := decodeCursor(s); ok {
+		return pos, nil
+	}
+	if id, ok := parseMessageId(s); ok {
+		msg, err := channelLog(store, network, channelName, id)
+		if err != nil {
+			return irclogsme.Position{}, err
+		}
+		return irclogsme.PositionOf(msg), nil
+	}
+	if t, err := time.Parse(time.RFC3339Nano, s); err == nil {
+		return irclogsme.Position{Time: t}, nil
+	}
+	if start, _, err := dayBounds(s, loc); err == nil {
+		return irclogsme.Position{Time: start}, nil
+	}
+	return irclogsme.Position{}, badRequest("bad_cursor", "bad cursor %s", s)
+}
+
+// pageRequest is what the query string says about the page wanted - ?format=&tz=&limit=
+type pageRequest struct {
+	format string
+	// the reader's zone, or nil for the channel's
+	loc *time.Location
+	// dayLoc is loc or the channel's, for reading days
+	dayLoc *time.Location
+	limit  int
+}
+
+func parsePageRequest(values url.Values, network irclogsme.NetworkConfig, channelName string) (pageRequest, error) {
+	req := pageRequest{format: formatRequested(values), limit: PAGE_SIZE}
+	if !validFormat(req.format) {
+		return req, errBadFormat
+	}
+	var err error
+	if req.loc, err = tzRequested(values); err != nil {
+		return req, errBadTz
+	}
+	req.dayLoc = req.loc
+	if req.dayLoc == nil {
+		req.dayLoc = network.LocationFor(channelName)
+	}
+	if s := values.Get("limit"); s != "" {
+		req.limit, err = strconv.Atoi(s)
+		if err != nil || req.limit < 1 || req.limit > PAGE_MAX_SIZE {
+			return req, badRequest("bad_limit", "limit should be 1 to %d", PAGE_MAX_SIZE)
+		}
+	}
+	return req, nil
+}
+
+// page makes msgs, oldest first, a LogPage. newer and older say whether there's more either side.
+func (req pageRequest) page(channelName string, msgs []irclogsme.LogMessage, newer, older bool) LogPage {
+	res := LogPage{Channel: channelName, Logs: make([]PagedLog, len(msgs))}
+	if len(msgs) == 0 {
+		return res
+	}
+	if newer {
+		res.Next = encodeCursor(irclogsme.PositionOf(msgs[len(msgs)-1]))
+	}
+	if older {
+		res.Prev = encodeCursor(irclogsme.PositionOf(msgs[0]))
+	}
+	for n, msg := range msgs {
+		date := msg.SplitDate
+		if req.loc != nil {
+			date = irclogsme.SplitDate(msg.Time, req.loc)
+			msg.Time = msg.Time.In(req.loc)
+		}
+		res.Logs[n] = PagedLog{Log: logMorph(msg, req.format, API_V2), Date: date}
+	}
+	return res
+}
+
+// walk is up to limit messages from start towards stop (which can be zero, for no stop), oldest
+// first, and whether there's anything either side of them. Going on past start's side is
+// anything at all; going on towards stop is only anything before stop, so a walk that reaches
+// stop says there's nothing further.
+func walk(store Store, network irclogsme.NetworkConfig, channelName string, start, stop irclogsme.Position, backwards bool, limit int) (msgs []irclogsme.LogMessage, newer, older bool, err error) {
+	// one more than we want says whether there's more
+	found, err := store.LogsFrom(network.Id, channelName, start, backwards, limit+1)
+	if err != nil {
+		return nil, false, false, err
+	}
+	if !stop.IsZero() {
+		for n, msg := range found {
+			if (backwards && !stop.Precedes(msg)) || (!backwards && !stop.Follows(msg)) {
+				found = found[:n]
+				break
+			}
+		}
+	}
+	msgs = found
+	further := len(found) > limit
+	if further {
+		msgs = found[:limit]
+	}
+	if backwards {
+		reverseLogs(msgs)
+	}
+	if len(msgs) == 0 {
+		return msgs, false, false, nil
+	}
+
+	// and whether there's anything the other way
+	from := msgs[len(msgs)-1]
+	if !backwards {
+		from = msgs[0]
+	}
+	behind, err := store.LogsFrom(network.Id, channelName, irclogsme.PositionOf(from), !backwards, 1)
+	if err != nil {
+		return nil, false, false, err
+	}
+	if backwards {
+		return msgs, len(behind) > 0, further, nil
+	}
+	return msgs, further, len(behind) > 0, nil
+}
+
+// pageChannel answers the logs endpoint: ?after=&before=&limit=&direction=forward|backward.
+// after and before are anything parsePosition takes. Going forwards starts just after after (or
+// at the start of the channel) and stops at before; backwards is the other way round, from the
+// end of the channel if there's no before. The direction defaults to forwards if there's only
+// an after and backwards otherwise, so no parameters at all is the latest messages.
+func pageChannel(r *http.Request, store Store, network irclogsme.NetworkConfig, channelName string) (interface{}, error) {
+	values := r.URL.Query()
+	req, err := parsePageRequest(values, network, channelName)
+	if err != nil {
+		return nil, err
+	}
+
+	var after, before irclogsme.Position
+	if s := values.Get("after"); s != "" {
+		if after, err = parsePosition(s, store, network, channelName, req.dayLoc); err != nil {
+			return nil, err
+		}
+	}
+	if s := values.Get("before"); s != "" {
+		if before, err = parsePosition(s, store, network, channelName, req.dayLoc); err != nil {
+			return nil, err
+		}
+	}
+
+	var backwards bool
+	switch values.Get("direction") {
+	case "":
+		backwards = after.IsZero() || !before.IsZero()
+	case "forward":
+	case "backward":
+		backwards = true
+	default:
+		return nil, badRequest("bad_direction", "direction should be forward or backward")
+	}
+	start, stop := after, before
+	if backwards {
+		start, stop = before, after
+	}
+
+	msgs, newer, older, err := walk(store, network, channelName, start, stop, backwards, req.limit)
+	if err != nil {
+		return nil, err
+	}
+	return req.page(channelName, msgs, newer, older), nil
+}
+
+// rangeChannel answers the range endpoint: ?from=&to=, [from, to) oldest first. Either is anything
+// parsePosition takes, though times are the point. If there's more than ?limit= messages in the
+// range Next carries on, with ?before= as the end.
+func rangeChannel(r *http.Request, store Store, network irclogsme.NetworkConfig, channelName string) (interface{}, error) {
+	values := r.URL.Query()
+	req, err := parsePageRequest(values, network, channelName)
+	if err != nil {
+		return nil, err
+	}
+	if values.Get("from") == "" || values.Get("to") == "" {
+		return nil, badRequest("bad_range", "from and to are both needed")
+	}
+	from, err := parsePosition(values.Get("from"), store, network, channelName, req.dayLoc)
+	if err != nil {
+		return nil, err
+	}
+	to, err := parsePosition(values.Get("to"), store, network, channelName, req.dayLoc)
+	if err != nil {
+		return nil, err
+	}
+	if to.Time.Before(from.Time) {
+		return nil, badRequest("bad_range", "to is before from")
+	}
+
+	msgs, newer, older, err := walk(store, network, channelName, from, to, false, req.limit)
+	if err != nil {
+		return nil, err
+	}
+	return req.page(channelName, msgs, newer, older), nil
+}
+
+// AroundPage is the messages around a time or message. Focus is that message, or the first at
+// or after the time - it's empty if there's nothing after it.
+type AroundPage struct {
+	LogPage
+
+	Focus string `json:"focus,omitempty"`
+}
+
+// around is up to limit messages around at, oldest first, with the first at or after it
+// (or the message, if there is one) at focus. Half are before it if there are that many.
+func around(store Store, network irclogsme.NetworkConfig, channelName string, at irclogsme.Position, msg *irclogsme.LogMessage, limit int) (msgs []irclogsme.LogMessage, focus int, newer, older bool, err error) {
+	earlier, err := store.LogsFrom(network.Id, channelName, at, true, limit+1)
+	if err != nil {
+		return nil, 0, false, false, err
+	}
+	later, err := store.LogsFrom(network.Id, channelName, at, false, limit+1)
+	if err != nil {
+		return nil, 0, false, false, err
+	}
+	if msg != nil {
+		// neither side has the message itself
+		later = append([]irclogsme.LogMessage{*msg}, later...)
+	}
+
+	nOlder := limit / 2
+	if nOlder > len(earlier) {
+		nOlder = len(earlier)
+	}
+	nNewer := limit - nOlder
+	if nNewer > len(later) {
+		nNewer = len(later)
+	}
+	// and if there aren't enough after, more before
+	if nOlder = limit - nNewer; nOlder > len(earlier) {
+		nOlder = len(earlier)
+	}
+
+	msgs = make([]irclogsme.LogMessage, 0, nOlder+nNewer)
+	msgs = append(msgs, earlier[:nOlder]...)
+	reverseLogs(msgs)
+	msgs = append(msgs, later[:nNewer]...)
+	return msgs, nOlder, len(later) > nNewer, len(earlier) > nOlder, nil
+}
+
+// aroundChannel answers the around endpoint: ?at= is a time or a message id, and ?limit= how
+// many messages in all
+func aroundChannel(r *http.Request, store Store, network irclogsme.NetworkConfig, channelName string) (interface{}, error) {
+	values := r.URL.Query()
+	req, err := parsePageRequest(values, network, channelName)
+	if err != nil {
+		return nil, err
+	}
+	if values.Get("at") == "" {
+		return nil, badRequest("bad_cursor", "at is needed")
+	}
+
+	var at irclogsme.Position
+	var msg *irclogsme.LogMessage
+	if id, ok := parseMessageId(values.Get("at")); ok {
+		found, err := channelLog(store, network, channelName, id)
+		if err != nil {
+			return nil, err
+		}
+		msg, at = &found, irclogsme.PositionOf(found)
+	} else if at, err = parsePosition(values.Get("at"), store, network, channelName, req.dayLoc); err != nil {
+		return nil, err
+	}
+
+	msgs, focus, newer, older, err := around(store, network, channelName, at, msg, req.limit)
+	if err != nil {
+		return nil, err
+	}
+	res := AroundPage{LogPage: req.page(channelName, msgs, newer, older)}
+	if focus < len(msgs) {
+		res.Focus = res.Logs[focus].Id
+	}
+	return res, nil
+}
@@ -0,0 +1,140 @@
+package server
+
+import (
+	"fmt"
+	"github.com/lukegb/irclogsme"
+	"labix.org/v2/mgo/bson"
+	"reflect"
+	"testing"
+	"time"
+)
+
+var pagingStart = time.Date(2014, 3, 1, 12, 0, 0, 0, time.UTC)
+
+// pagingStore has ten messages a minute apart, called 0 to 9, except that 4 and 5 share a time
+func pagingStore() (*MemoryStore, irclogsme.NetworkConfig, []irclogsme.LogMessage) {
+	store := NewMemoryStore()
+	network := store.AddNetwork(irclogsme.NetworkConfig{Name: "examplenet"})
+	msgs := make([]irclogsme.LogMessage, 10)
+	for i := range msgs {
+		minute := i
+		if i == 5 {
+			minute = 4
+		}
+		msgs[i] = store.AddLog(irclogsme.LogMessage{
+			Id:        bson.ObjectIdHex(fmt.Sprintf("53114a0000000000000000%02x", i)),
+			Type:      irclogsme.LMT_PRIVMSG,
+			NetworkId: network.Id,
+			Channel:   "#chan",
+			Time:      pagingStart.Add(time.Duration(minute) * time.Minute),
+			Nick:      "alice",
+			Data:      irclogsme.TextPayload(fmt.Sprint(i)),
+		})
+	}
+	return store, network, msgs
+}
+
+// the names of msgs, in order
+func pagingNames(msgs []irclogsme.LogMessage) []string {
+	names := make([]string, 0, len(msgs))
+	for _, msg := range msgs {
+		names = append(names, msg.Data.Text)
+	}
+	return names
+}
+
+// positions in a walk test: -1 is the zero Position, 100+n is minute n with no id, and anything
+// else is message n
+func pagingPosition(msgs []irclogsme.LogMessage, n int) irclogsme.Position {
+	switch {
+	case n == -1:
+		return irclogsme.Position{}
+	case n >= 100:
+		return irclogsme.Position{Time: pagingStart.Add(time.Duration(n-100) * time.Minute)}
+	}
+	return irclogsme.PositionOf(msgs[n])
+}
+
+var walkTests = []struct {
+	name        string
+	start, stop int
+	backwards   bool
+	limit       int
+	msgs        []string
+	newer       bool
+	older       bool
+}{
+	{"the start", -1, -1, false, 3, []string{"0", "1", "2"}, true, false},
+	{"after a message", 2, -1, false, 3, []string{"3", "4", "5"}, true, true},
+	{"running out", 7, -1, false, 3, []string{"8", "9"}, false, true},
+	{"nothing after", 9, -1, false, 3, []string{}, false, false},
+	{"the end", -1, -1, true, 3, []string{"7", "8", "9"}, false, true},
+	{"before a message", 3, -1, true, 5, []string{"0", "1", "2"}, true, false},
+	{"between two sharing a time", 4, -1, false, 2, []string{"5", "6"}, true, true},
+	{"after a time", 104, -1, false, 3, []string{"4", "5", "6"}, true, true},
+	{"before a time", 104, -1, true, 3, []string{"1", "2", "3"}, true, true},
+	{"stopping at a message", -1, 3, false, 2, []string{"0", "1"}, true, false},
+	{"the stop isn't more", -1, 3, false, 3, []string{"0", "1", "2"}, false, false},
+	{"a limit past the stop", -1, 3, false, 10, []string{"0", "1", "2"}, false, false},
+	{"stopping at a time", 2, 104, false, 5, []string{"3"}, false, true},
+	{"stopping backwards", 8, 5, true, 5, []string{"6", "7"}, true, false},
+	{"stopping backwards at the limit", 8, 5, true, 1, []string{"7"}, true, true},
+}
+
+func TestWalk(t *testing.T) {
+	store, network, msgs := pagingStore()
+	for _, tt := range walkTests {
+		got, newer, older, err := walk(store, network, "#chan", pagingPosition(msgs, tt.start), pagingPosition(msgs, tt.stop), tt.backwards, tt.limit)
+		if err != nil {
+			t.Errorf("%s: %s", tt.name, err)
+			continue
+		}
+		if names := pagingNames(got); !reflect.DeepEqual(names, tt.msgs) {
+			t.Errorf("%s: %q, want %q", tt.name, names, tt.msgs)
+		}
+		if newer != tt.newer || older != tt.older {
+			t.Errorf("%s: newer %v older %v, want %v %v", tt.name, newer, older, tt.newer, tt.older)
+		}
+	}
+}
+
+var aroundTests = []struct {
+	name string
+	// a message, or 100+n for minute n
+	at    int
+	limit int
+	msgs  []string
+	focus int
+	newer bool
+	older bool
+}{
+	{"a message", 5, 4, []string{"3", "4", "5", "6"}, 2, true, true},
+	{"a time two messages share", 104, 4, []string{"2", "3", "4", "5"}, 2, true, true},
+	{"the first message", 0, 4, []string{"0", "1", "2", "3"}, 0, true, false},
+	{"the last message", 9, 4, []string{"6", "7", "8", "9"}, 3, false, true},
+	{"after everything", 120, 4, []string{"6", "7", "8", "9"}, 4, false, true},
+	{"all of it", 5, 10, []string{"0", "1", "2", "3", "4", "5", "6", "7", "8", "9"}, 5, false, false},
+	{"an odd limit", 5, 3, []string{"4", "5", "6"}, 1, true, true},
+}
+
+func TestAround(t *testing.T) {
+	store, network, msgs := pagingStore()
+	for _, tt := range aroundTests {
+		at := pagingPosition(msgs, tt.at)
+		var msg *irclogsme.LogMessage
+		if tt.at < 100 {
+			msg = &msgs[tt.at]
+		}
+		got, focus, newer, older, err := around(store, network, "#chan", at, msg, tt.limit)
+		if err != nil {
+			t.Errorf("%s: %s", tt.name, err)
+			continue
+		}
+		if names := pagingNames(got); !reflect.DeepEqual(names, tt.msgs) {
+			t.Errorf("%s: %q, want %q", tt.name, names, tt.msgs)
+		}
+		if focus != tt.focus || newer != tt.newer || older != tt.older {
+			t.Errorf("%s: focus %d newer %v older %v, want %d %v %v", tt.name, focus, newer, older, tt.focus, tt.newer, tt.older)
+		}
+	}
+}
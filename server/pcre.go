@@ -0,0 +1,124 @@
+package server
+
+import (
+	"fmt"
+	"regexp"
+	"regexp/syntax"
+	"strings"
+)
+
+// pcrePattern spells a Go regexp so MongoDB's PCRE means the same by it. Passing the source
+// straight through mostly works, but not quite: $ and \z, \Q...\E, \pN and what . matches all
+// differ, and some of Go's syntax isn't PCRE's at all.
+func pcrePattern(re *regexp.Regexp) string {
+	parsed, err := syntax.Parse(re.String(), syntax.Perl)
+	if err != nil {
+		// it compiled, so this can't happen - but if it does, don't match anything
+		return `(?!)`
+	}
+	var b strings.Builder
+	writePcre(&b, parsed)
+	return b.String()
+}
+
+func writePcre(b *strings.Builder, re *syntax.Regexp) {
+	switch re.Op {
+	case syntax.OpNoMatch:
+		b.WriteString(`(?!)`)
+	case syntax.OpEmptyMatch:
+		b.WriteString(`(?:)`)
+	case syntax.OpLiteral:
+		if re.Flags&syntax.FoldCase != 0 {
+			b.WriteString(`(?i:`)
+		} else {
+			b.WriteString(`(?:`)
+		}
+		for _, r := range re.Rune {
+			writePcreRune(b, r)
+		}
+		b.WriteString(`)`)
+	case syntax.OpCharClass:
+		b.WriteString(`[`)
+		if len(re.Rune) == 0 {
+			// matches nothing
+			b.WriteString(`^\x{0}-\x{10FFFF}`)
+		}
+		for n := 0; n+1 < len(re.Rune); n += 2 {
+			writePcreRune(b, re.Rune[n])
+			if re.Rune[n+1] != re.Rune[n] {
+				b.WriteString(`-`)
+				writePcreRune(b, re.Rune[n+1])
+			}
+		}
+		b.WriteString(`]`)
+	case syntax.OpAnyCharNotNL:
+		b.WriteString(`[^\n]`)
+	case syntax.OpAnyChar:
+		b.WriteString(`[\s\S]`)
+	case syntax.OpBeginLine:
+		b.WriteString(`(?m:^)`)
+	case syntax.OpEndLine:
+		b.WriteString(`(?m:$)`)
+	case syntax.OpBeginText:
+		b.WriteString(`\A`)
+	case syntax.OpEndText:
+		b.WriteString(`\z`)
+	case syntax.OpWordBoundary:
+		b.WriteString(`\b`)
+	case syntax.OpNoWordBoundary:
+		b.WriteString(`\B`)
+	case syntax.OpCapture:
+		// nobody sees the groups, so they needn't capture
+		b.WriteString(`(?:`)
+		writePcre(b, re.Sub[0])
+		b.WriteString(`)`)
+	case syntax.OpStar, syntax.OpPlus, syntax.OpQuest, syntax.OpRepeat:
+		b.WriteString(`(?:`)
+		writePcre(b, re.Sub[0])
+		b.WriteString(`)`)
+		switch re.Op {
+		case syntax.OpStar:
+			b.WriteString(`*`)
+		case syntax.OpPlus:
+			b.WriteString(`+`)
+		case syntax.OpQuest:
+			b.WriteString(`?`)
+		default:
+			if re.Max == -1 {
+				fmt.Fprintf(b, `{%d,}`, re.Min)
+			} else {
+				fmt.Fprintf(b, `{%d,%d}`, re.Min, re.Max)
+			}
+		}
+		if re.Flags&syntax.NonGreedy != 0 {
+			b.WriteString(`?`)
+		}
+	case syntax.OpConcat:
+		b.WriteString(`(?:`)
+		for _, sub := range re.Sub {
+			writePcre(b, sub)
+		}
+		b.WriteString(`)`)
+	case syntax.OpAlternate:
+		b.WriteString(`(?:`)
+		for n, sub := range re.Sub {
+			if n > 0 {
+				b.WriteString(`|`)
+			}
+			writePcre(b, sub)
+		}
+		b.WriteString(`)`)
+	default:
+		b.WriteString(`(?!)`)
+	}
+}
+
+// writePcreRune leaves letters and digits alone and spells out everything else, so nothing's
+// taken for syntax inside or outside a class
+func writePcreRune(b *strings.Builder, r rune) {
+	if r < 0x80 && (r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9') {
+		b.WriteRune(r)
+		return
+	}
+	fmt.Fprintf(b, `\x{%X}`, r)
+}
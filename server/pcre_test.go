@@ -0,0 +1,33 @@
+package server
+
+import (
+	"regexp"
+	"testing"
+)
+
+var pcreTests = []struct {
+	in, out string
+}{
+	// Go's $ is the very end, PCRE's would also match before a trailing newline
+	{`a$`, `(?:(?:a)\z)`},
+	{`^h\w+ w`, `(?:\A(?:h)(?:[0-9A-Z\x{5F}a-z])+(?:\x{20}w))`},
+	{`(?m)^foo$`, `(?:(?m:^)(?:foo)(?m:$))`},
+	{`(?i)hello`, `(?i:HELLO)`},
+	// PCRE has \Q...\E too, but this way nothing in it can break out
+	{`\Qa.b\E`, `(?:a\x{2E}b)`},
+	{`x.y`, `(?:(?:x)[^\n](?:y))`},
+	{`(?s)x.y`, `(?:(?:x)[\s\S](?:y))`},
+	{`a{2,}?`, `(?:(?:a)){2,}?`},
+	{`[^a-c\d]`, `[\x{0}-\x{2F}\x{3A}-\x{60}d-\x{10FFFF}]`},
+	{`\bword\b`, `(?:\b(?:word)\b)`},
+	{`(?P<name>x)|`, `(?:(?:(?:x))|(?:))`},
+	{`é`, `(?:\x{E9})`},
+}
+
+func TestPcrePattern(t *testing.T) {
+	for _, tt := range pcreTests {
+		if got := pcrePattern(regexp.MustCompile(tt.in)); got != tt.out {
+			t.Errorf("%s: %s, want %s", tt.in, got, tt.out)
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package server
+
+import (
+	"github.com/lukegb/irclogsme"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const (
+	PERMALINK_CONTEXT     = 5
+	PERMALINK_MAX_CONTEXT = 100
+)
+
+// Permalink is one message, where it was said, and what was said either side of it
+type Permalink struct {
+	Network string `json:"network"`
+	Channel string `json:"channel"`
+	Date    string `json:"date"`
+	// the message's day, with it as the fragment
+	Day string `json:"day"`
+
+	Message PagedLog   `json:"message"`
+	Before  []PagedLog `json:"before"`
+	After   []PagedLog `json:"after"`
+
+	// cursors for the logs endpoint, for more context
+	Next string `json:"next,omitempty"`
+	Prev string `json:"prev,omitempty"`
+}
+
+// channelSegment is the channel bit of a URL for channelName - channelOk backwards
+func channelSegment(channelName string) string {
+	return strings.TrimPrefix(channelName, "#")
+}
+
+// messageNetwork is the network msg was logged on
+func messageNetwork(store Store, msg irclogsme.LogMessage) (irclogsme.NetworkConfig, error) {
+	nets, err := store.Networks()
+	if err != nil {
+		return irclogsme.NetworkConfig{}, err
+	}
+	for _, net := range nets {
+		if net.Id == msg.NetworkId {
+			return net, nil
+		}
+	}
+	return irclogsme.NetworkConfig{}, errNotFound
+}
+
+// permalink answers /api/v2/messages/<id>/?context=, with context messages either side. Ids are
+// the same whether the message is in the database or has been archived, so the link doesn't break.
+func permalink(r *http.Request, store Store, p params) (interface{}, error) {
+	id, ok := parseMessageId(p["id"])
+	if !ok {
+		return nil, badRequest("bad_id", "bad message id %s", p["id"])
+	}
+	msg, err := store.Log(id)
+	var network irclogsme.NetworkConfig
+	if err == nil {
+		network, err = messageNetwork(store, msg)
+	}
+	if isNotFound(err) {
+		return nil, notFound("message_not_found", "no message %s", id.Hex())
+	} else if err != nil {
+		return nil, err
+	}
+
+	values := r.URL.Query()
+	req, err := parsePageRequest(values, network, msg.Channel)
+	if err != nil {
+		return nil, err
+	}
+	context := PERMALINK_CONTEXT
+	if s := values.Get("context"); s != "" {
+		context, err = strconv.Atoi(s)
+		if err != nil || context < 0 || context > PERMALINK_MAX_CONTEXT {
+			return nil, badRequest("bad_context", "context should be 0 to %d", PERMALINK_MAX_CONTEXT)
+		}
+	}
+
+	pos := irclogsme.PositionOf(msg)
+	before, err := store.LogsFrom(network.Id, msg.Channel, pos, true, context+1)
+	if err != nil {
+		return nil, err
+	}
+	after, err := store.LogsFrom(network.Id, msg.Channel, pos, false, context+1)
+	if err != nil {
+		return nil, err
+	}
+	older, newer := len(before) > context, len(after) > context
+	if older {
+		before = before[:context]
+	}
+	if newer {
+		after = after[:context]
+	}
+	reverseLogs(before)
+
+	msgs := make([]irclogsme.LogMessage, 0, len(before)+1+len(after))
+	msgs = append(msgs, before...)
+	msgs = append(msgs, msg)
+	msgs = append(msgs, after...)
+	page := req.page(msg.Channel, msgs, newer, older)
+
+	res := Permalink{
+		Network: network.Name,
+		Channel: msg.Channel,
+		Message: page.Logs[len(before)],
+		Before:  page.Logs[:len(before)],
+		After:   page.Logs[len(before)+1:],
+		Next:    page.Next,
+		Prev:    page.Prev,
+	}
+	res.Date = res.Message.Date
+	res.Day = contextLink(v2Days(network, channelSegment(msg.Channel)), res.Date, values.Get("tz"), msg)
+	return res, nil
+}
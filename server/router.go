@@ -0,0 +1,95 @@
+package server
+
+import (
+	"net/http"
+	"strings"
+)
+
+// params are the :name segments of the route that matched, by name
+type params map[string]string
+
+type handlerFunc func(w http.ResponseWriter, r *http.Request, p params)
+
+type route struct {
+	method   string // "" for any
+	segments []string
+	handler  handlerFunc
+}
+
+// router picks a handler by method and path. Patterns are like /api/:network/:channel/ - a
+// :name segment matches any one non-empty segment. Trailing slashes don't matter. Routes are
+// tried in the order they were added, so literal segments go before a :name in the same place.
+type router struct {
+	routes []route
+	// slashes is how v1 always matched: only what's before the last slash counts, so
+	// /api/net/chan is /api/net/, and a :name can be empty
+	slashes bool
+
+	notFound  handlerFunc
+	badMethod func(w http.ResponseWriter, r *http.Request, allowed []string)
+}
+
+func (rt *router) splitPath(path string) []string {
+	if rt.slashes {
+		segments := strings.Split(strings.TrimPrefix(path, "/"), "/")
+		return segments[:len(segments)-1]
+	}
+	return strings.Split(strings.Trim(path, "/"), "/")
+}
+
+// Get adds a route for GET, which HEAD gets too
+func (rt *router) Get(pattern string, h handlerFunc) {
+	rt.routes = append(rt.routes, route{method: "GET", segments: rt.splitPath(pattern), handler: h})
+}
+
+// Any adds a route for every method
+func (rt *router) Any(pattern string, h handlerFunc) {
+	rt.routes = append(rt.routes, route{segments: rt.splitPath(pattern), handler: h})
+}
+
+func (r route) match(segments []string, emptyOk bool) (params, bool) {
+	if len(segments) != len(r.segments) {
+		return nil, false
+	}
+	p := make(params)
+	for n, want := range r.segments {
+		if strings.HasPrefix(want, ":") {
+			if segments[n] == "" && !emptyOk {
+				return nil, false
+			}
+			p[want[1:]] = segments[n]
+		} else if segments[n] != want {
+			return nil, false
+		}
+	}
+	return p, true
+}
+
+func (rt *router) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	segments := rt.splitPath(r.URL.Path)
+	method := r.Method
+	if method == "HEAD" {
+		method = "GET"
+	}
+
+	var allowed []string
+	for _, route := range rt.routes {
+		p, ok := route.match(segments, rt.slashes)
+		if !ok {
+			continue
+		}
+		if route.method != "" && route.method != method {
+			allowed = append(allowed, route.method)
+			continue
+		}
+		route.handler(w, r, p)
+		return
+	}
+
+	if len(allowed) > 0 {
+		w.Header().Set("Allow", strings.Join(allowed, ", "))
+		rt.badMethod(w, r, allowed)
+		return
+	}
+	rt.notFound(w, r, nil)
+}
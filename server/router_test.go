@@ -0,0 +1,109 @@
+package server
+
+import (
+	"github.com/lukegb/irclogsme"
+	"labix.org/v2/mgo/bson"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// routesStore has a channel with three messages on 2014-03-01, the last a kick from before
+// kicks had their own type
+func routesStore() *MemoryStore {
+	store := NewMemoryStore()
+	network := store.AddNetwork(irclogsme.NetworkConfig{
+		Name:         "examplenet",
+		FriendlyName: "Example Net",
+		Channels:     map[string]irclogsme.ChannelConfig{"#chan": {}},
+	})
+	at := time.Date(2014, 3, 1, 12, 0, 0, 0, time.UTC)
+	store.AddLog(irclogsme.LogMessage{
+		Id: bson.ObjectIdHex("53114a000000000000000001"), NetworkId: network.Id, Channel: "#chan",
+		Time: at, Nick: "alice", Type: irclogsme.LMT_PRIVMSG, Data: irclogsme.TextPayload("hello there"),
+	})
+	store.AddLog(irclogsme.LogMessage{
+		Id: bson.ObjectIdHex("53114a000000000000000002"), NetworkId: network.Id, Channel: "#chan",
+		Time: at.Add(time.Minute), Nick: "bob", Type: irclogsme.LMT_PRIVMSG, Data: irclogsme.TextPayload("hello hello"),
+	})
+	store.AddLog(irclogsme.LogMessage{
+		Id: bson.ObjectIdHex("53114a000000000000000003"), NetworkId: network.Id, Channel: "#chan",
+		Time: at.Add(2 * time.Minute), Nick: "alice", Type: irclogsme.LMT_PART, Data: irclogsme.KickPayload("bob", "bye"),
+	})
+	return store
+}
+
+var routeTests = []struct {
+	method string
+	path   string
+	status int
+	// bits of the body, in order
+	body []string
+}{
+	// v1 goes by the slashes, the way it always has: whatever's after the last one is ignored
+	{"GET", "/api/", 200, []string{`"name":"examplenet"`}},
+	{"GET", "/api/examplenet", 200, []string{`"name":"examplenet"`}},
+	{"POST", "/api/examplenet/", 200, []string{`"friendly_name":"Example Net"`}},
+	{"GET", "/api/examplenet/chan/", 200, []string{`"2014-03-01"`}},
+	{"GET", "/api/examplenet/nochan/", 404, []string{`"error":"not found"`}},
+	{"GET", "/api/examplenet/chan/2014-03-01/", 200, []string{`"hello there"`, `"hello hello"`, `"type":"part"`, `"data":"bye"`}},
+	{"GET", "/api/examplenet/chan/2014-03-01/junk", 200, []string{`"hello there"`}},
+	{"GET", "/api/examplenet/chan/2014-03-02/", 404, []string{`"error"`}},
+	{"GET", "/api/examplenet/chan/2014-03-01/more/", 404, []string{`"error":"not found"`}},
+	// search and export are v2 only
+	{"GET", "/api/examplenet/chan/search/?q=hello", 404, []string{`"error"`}},
+	{"GET", "/api/examplenet/chan/export/", 404, []string{`"error"`}},
+	{"GET", "/api/examplenet/chan/ws/?format=nope", 400, []string{"bad format"}},
+	{"GET", "/other/", 404, nil},
+
+	// v2 doesn't mind about trailing slashes, but does about methods and empty segments
+	{"GET", "/api/v2/networks", 200, []string{`"name":"examplenet"`}},
+	{"GET", "/api/v2/networks/examplenet", 200, []string{`"friendly_name":"Example Net"`}},
+	{"GET", "/api/v2/networks/nonet/", 404, []string{`"code":"network_not_found"`}},
+	{"POST", "/api/v2/networks/examplenet/", 405, []string{`"code":"method_not_allowed"`}},
+	{"GET", "/api/v2/networks/examplenet/channels/chan", 200, []string{`"2014-03-01"`}},
+	{"GET", "/api/v2/networks/examplenet/channels/", 404, []string{`"code":"not_found"`}},
+	// the mux cleans the path before we see it
+	{"GET", "/api/v2/networks/examplenet/channels//", 301, nil},
+	{"GET", "/api/v2/networks/examplenet/channels/chan/days/2014-03-01", 200, []string{`"hello there"`, `"hello hello"`, `"type":"part"`, `"data":"bye"`}},
+	{"GET", "/api/v2/networks/examplenet/channels/chan/days/2014-03-02/", 404, []string{`"code":"no_logs"`}},
+	{"GET", "/api/v2/networks/examplenet/channels/chan/days/march/", 400, []string{`"code":"bad_date"`}},
+	{"GET", "/api/v2/messages/53114a000000000000000002/", 200, []string{`"hello hello"`}},
+	{"GET", "/api/v2/messages/nope/", 400, []string{`"code":"bad_id"`}},
+	{"GET", "/api/v2/messages/53114a0000000000000000ff/", 404, []string{`"code"`}},
+	{"GET", "/api/v2/networks/examplenet/channels/chan/logs/?limit=2", 200, []string{`"hello hello"`, `"type":"part"`}},
+	{"GET", "/api/v2/networks/examplenet/channels/chan/range/?from=2014-03-01T12:00:00Z&to=2014-03-01T12:01:30Z", 200, []string{`"hello there"`, `"hello hello"`}},
+	{"GET", "/api/v2/networks/examplenet/channels/chan/range/", 400, []string{`"code":"bad_range"`}},
+	{"GET", "/api/v2/networks/examplenet/channels/chan/around/?at=53114a000000000000000002&limit=3", 200, []string{`"hello there"`, `"hello hello"`, `"type":"part"`}},
+	{"GET", "/api/v2/networks/examplenet/channels/chan/around/", 400, []string{`"code":"bad_cursor"`}},
+	{"GET", "/api/v2/networks/examplenet/channels/chan/search/?q=hello", 200, []string{`"total":2`, `"hello hello"`, `"hello there"`}},
+	{"GET", "/api/v2/networks/examplenet/channels/chan/search/?regex=(", 400, []string{`"code":"bad_regex"`}},
+	{"GET", "/api/v2/networks/examplenet/channels/chan/export/?archive=zip", 200, []string{"PK", "examplenet-#chan/2014-03-01.log"}},
+	{"GET", "/api/v2/networks/examplenet/channels/chan/export/?from=2014-03-02", 404, []string{`"code":"no_logs"`}},
+	{"GET", "/api/v2/networks/examplenet/channels/chan/export/?archive=nope", 400, []string{`"code":"bad_format"`}},
+	{"GET", "/api/v2/networks/examplenet/channels/chan/ws/?format=nope", 400, []string{`"code":"bad_format"`}},
+	{"GET", "/api/v2/networks/examplenet/channels/nochan/ws/", 404, []string{`"code"`}},
+}
+
+func TestRoutes(t *testing.T) {
+	h := NewHandler(routesStore(), nil)
+	for _, tt := range routeTests {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(tt.method, tt.path, nil))
+		body := w.Body.String()
+		if w.Code != tt.status {
+			t.Errorf("%s %s: %d, want %d: %s", tt.method, tt.path, w.Code, tt.status, body)
+			continue
+		}
+		rest := body
+		for _, want := range tt.body {
+			n := strings.Index(rest, want)
+			if n == -1 {
+				t.Errorf("%s %s: no %s in order in %s", tt.method, tt.path, want, body)
+				break
+			}
+			rest = rest[n+len(want):]
+		}
+	}
+}
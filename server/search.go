@@ -0,0 +1,182 @@
+package server
+
+import (
+	"github.com/lukegb/irclogsme"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	SEARCH_PER_PAGE     = 50
+	SEARCH_MAX_PER_PAGE = 200
+)
+
+// the names logMorph gives each type, for ?type=
+var typeNames = map[string]irclogsme.LogMessageType{
+	"privmsg": irclogsme.LMT_PRIVMSG,
+	"notice":  irclogsme.LMT_NOTICE,
+	"join":    irclogsme.LMT_JOIN,
+	"part":    irclogsme.LMT_PART,
+	"topic":   irclogsme.LMT_TOPIC,
+	"kick":    irclogsme.LMT_KICK,
+	"quit":    irclogsme.LMT_QUIT,
+	"action":  irclogsme.LMT_ACTION,
+	"nick":    irclogsme.LMT_NICK,
+}
+
+type SearchHit struct {
+	Log
+
+	// how well it matched q - only comparable with the other hits
+	Score float64 `json:"score"`
+	Date  string  `json:"date"`
+	// the hit's day, with the hit as the fragment
+	Context string `json:"context"`
+}
+
+type SearchResults struct {
+	Channel string `json:"channel"`
+
+	Total int `json:"total"`
+	// we stopped counting once the page was full, so Total is a lower bound
+	Truncated bool `json:"truncated"`
+
+	Page    int `json:"page"`
+	PerPage int `json:"per_page"`
+
+	Hits []SearchHit `json:"hits"`
+}
+
+// searchRequest is a search as the query string has it
+type searchRequest struct {
+	filter  irclogsme.SearchFilter
+	page    int
+	perPage int
+}
+
+// parseSearch reads ?q=&nick=&type=privmsg,action&from=&to=&regex=&page=&per_page=. from and to
+// are days, both included, in loc.
+func parseSearch(values url.Values, network irclogsme.NetworkConfig, channelName string, loc *time.Location) (searchRequest, error) {
+	req := searchRequest{page: 1, perPage: SEARCH_PER_PAGE}
+	req.filter = irclogsme.SearchFilter{
+		NetworkId: network.Id,
+		Channel:   channelName,
+		Text:      values.Get("q"),
+		Nick:      values.Get("nick"),
+	}
+
+	if types := values.Get("type"); types != "" {
+		for _, name := range strings.Split(types, ",") {
+			t, ok := typeNames[strings.ToLower(strings.TrimSpace(name))]
+			if !ok {
+				return req, badRequest("bad_type", "bad type")
+			}
+			req.filter.Types = append(req.filter.Types, t)
+		}
+	}
+
+	if from := values.Get("from"); from != "" {
+		start, _, err := dayBounds(from, loc)
+		if err != nil {
+			return req, badRequest("bad_date", "bad from")
+		}
+		req.filter.From = start
+	}
+	if to := values.Get("to"); to != "" {
+		_, end, err := dayBounds(to, loc)
+		if err != nil {
+			return req, badRequest("bad_date", "bad to")
+		}
+		req.filter.To = end
+	}
+
+	if pattern := values.Get("regex"); pattern != "" {
+		regex, err := regexp.Compile(pattern)
+		if err != nil {
+			return req, badRequest("bad_regex", "bad regex")
+		}
+		req.filter.Regex = regex
+	}
+
+	if page := values.Get("page"); page != "" {
+		n, err := strconv.Atoi(page)
+		if err != nil || n < 1 {
+			return req, badRequest("bad_page", "bad page")
+		}
+		req.page = n
+	}
+	if perPage := values.Get("per_page"); perPage != "" {
+		n, err := strconv.Atoi(perPage)
+		if err != nil || n < 1 || n > SEARCH_MAX_PER_PAGE {
+			return req, badRequest("bad_page", "bad per_page")
+		}
+		req.perPage = n
+	}
+	return req, nil
+}
+
+// contextLink is the day endpoint for msg, in the zone the reader asked for if they did. days is
+// the path the channel's days are under, which depends on the API version.
+func contextLink(days string, date string, tz string, msg irclogsme.LogMessage) string {
+	link := url.URL{Path: days + date + "/", Fragment: msg.Id.Hex()}
+	if tz != "" {
+		link.RawQuery = url.Values{"tz": {tz}}.Encode()
+	}
+	return link.String()
+}
+
+// searchChannel answers the search endpoint, linking hits to their days under days
+func searchChannel(r *http.Request, store Store, network irclogsme.NetworkConfig, channelName, days string) (interface{}, error) {
+	values := r.URL.Query()
+	format := formatRequested(values)
+	if !validFormat(format) {
+		return nil, errBadFormat
+	}
+	loc, err := tzRequested(values)
+	if err != nil {
+		return nil, errBadTz
+	}
+	dayLoc := loc
+	if dayLoc == nil {
+		dayLoc = network.LocationFor(channelName)
+	}
+
+	req, err := parseSearch(values, network, channelName, dayLoc)
+	if err != nil {
+		return nil, err
+	}
+
+	// the store ranks and pages
+	page, err := store.Search(req.filter, (req.page-1)*req.perPage, req.perPage)
+	if err != nil {
+		return nil, err
+	}
+
+	res := SearchResults{
+		Channel:   channelName,
+		Total:     page.Total,
+		Truncated: page.Truncated,
+		Page:      req.page,
+		PerPage:   req.perPage,
+		Hits:      make([]SearchHit, 0, len(page.Matches)),
+	}
+	for _, match := range page.Matches {
+		msg := match.LogMessage
+		date := msg.SplitDate
+		if loc != nil {
+			date = irclogsme.SplitDate(msg.Time, loc)
+			msg.Time = msg.Time.In(loc)
+		}
+		res.Hits = append(res.Hits, SearchHit{
+			Log:     logMorph(msg, format, API_V2),
+			Score:   match.Score,
+			Date:    date,
+			Context: contextLink(days, date, values.Get("tz"), msg),
+		})
+	}
+	return res, nil
+}
@@ -0,0 +1,61 @@
+package server
+
+import (
+	"github.com/lukegb/irclogsme"
+	"github.com/lukegb/irclogsme/sqldb"
+	"labix.org/v2/mgo/bson"
+	"time"
+)
+
+type sqlStore struct {
+	db *sqldb.DB
+}
+
+func (s *sqlStore) Networks() ([]irclogsme.NetworkConfig, error) {
+	return s.db.Networks()
+}
+
+func (s *sqlStore) Network(name string) (irclogsme.NetworkConfig, error) {
+	net, ok, err := s.db.Network(name)
+	if err == nil && !ok {
+		err = errNotFound
+	}
+	return net, err
+}
+
+func (s *sqlStore) ChannelDates(networkId bson.ObjectId, channel string) ([]string, error) {
+	return s.db.ChannelDates(networkId, channel)
+}
+
+func (s *sqlStore) CountChannelLogs(networkId bson.ObjectId, channel string) (int, error) {
+	return s.db.CountChannelLogs(networkId, channel)
+}
+
+func (s *sqlStore) DayLogs(networkId bson.ObjectId, channel string, splitDate string) ([]irclogsme.LogMessage, error) {
+	return s.db.DayLogs(networkId, channel, splitDate)
+}
+
+func (s *sqlStore) LogsBetween(networkId bson.ObjectId, channel string, from, to time.Time) ([]irclogsme.LogMessage, error) {
+	return s.db.LogsBetween(networkId, channel, from, to)
+}
+
+func (s *sqlStore) LogsAfter(networkId bson.ObjectId, channel string, t time.Time) ([]irclogsme.LogMessage, error) {
+	return s.db.LogsAfter(networkId, channel, t)
+}
+
+func (s *sqlStore) Log(id bson.ObjectId) (irclogsme.LogMessage, error) {
+	log, ok, err := s.db.Log(id)
+	if err == nil && !ok {
+		err = errNotFound
+	}
+	return log, err
+}
+
+func (s *sqlStore) LogsFrom(networkId bson.ObjectId, channel string, pos irclogsme.Position, backwards bool, limit int) ([]irclogsme.LogMessage, error) {
+	return s.db.LogsFrom(networkId, channel, pos, backwards, limit)
+}
+
+func (s *sqlStore) Search(filter irclogsme.SearchFilter, offset, limit int) (SearchPage, error) {
+	matches, total, err := s.db.SearchLogs(filter, offset, limit)
+	return SearchPage{Matches: matches, Total: total}, err
+}
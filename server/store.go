@@ -0,0 +1,78 @@
+package server
+
+import (
+	"errors"
+	"github.com/lukegb/irclogsme"
+	"github.com/lukegb/irclogsme/indexes"
+	"github.com/lukegb/irclogsme/sqldb"
+	"labix.org/v2/mgo"
+	"labix.org/v2/mgo/bson"
+	"log"
+	"strings"
+	"time"
+)
+
+// same text as mgo.ErrNotFound, so jsonResponsinator turns either into a 404
+var errNotFound = errors.New("not found")
+
+// Store is everything the API needs to read. The handlers only ever talk to one of these.
+// Lookups of a single thing return errNotFound (or mgo.ErrNotFound) if it isn't there;
+// lists are just empty.
+type Store interface {
+	Networks() ([]irclogsme.NetworkConfig, error)
+	Network(name string) (irclogsme.NetworkConfig, error)
+
+	ChannelDates(networkId bson.ObjectId, channel string) ([]string, error)
+	CountChannelLogs(networkId bson.ObjectId, channel string) (int, error)
+
+	// DayLogs and LogsBetween are oldest first; LogsBetween is [from, to)
+	DayLogs(networkId bson.ObjectId, channel string, splitDate string) ([]irclogsme.LogMessage, error)
+	LogsBetween(networkId bson.ObjectId, channel string, from, to time.Time) ([]irclogsme.LogMessage, error)
+
+	// LogsAfter is everything newer than t, for tailing a channel
+	LogsAfter(networkId bson.ObjectId, channel string, t time.Time) ([]irclogsme.LogMessage, error)
+	Log(id bson.ObjectId) (irclogsme.LogMessage, error)
+
+	// LogsFrom is up to limit messages after pos, oldest first - or before it, newest first, if
+	// backwards. See irclogsme.Position for what after means.
+	LogsFrom(networkId bson.ObjectId, channel string, pos irclogsme.Position, backwards bool, limit int) ([]irclogsme.LogMessage, error)
+
+	// Search ranks the messages matching the filter, best first and then newest first, and
+	// returns limit of them after skipping offset
+	Search(filter irclogsme.SearchFilter, offset, limit int) (SearchPage, error)
+}
+
+// SearchPage is one page of a search
+type SearchPage struct {
+	Matches []irclogsme.SearchMatch
+
+	// how many matched altogether - or at least, if Truncated
+	Total     int
+	Truncated bool
+}
+
+// OpenStore connects to mongodb://, sqlite:// or postgres:// - memory:// gets you an empty
+// MemoryStore, which is only really useful for poking at the API
+func OpenStore(connString string) (Store, error) {
+	switch {
+	case strings.HasPrefix(connString, "mongodb://"):
+		dbc, err := mgo.Dial(connString)
+		if err != nil {
+			return nil, err
+		}
+		// not fatal - everything works without them, just slowly
+		if err := indexes.Ensure(dbc.DB(""), indexes.SERVER_COLLECTIONS, log.Printf); err != nil {
+			log.Println("couldn't check indexes:", err)
+		}
+		return &mongoStore{db: dbc.DB("")}, nil
+	case strings.HasPrefix(connString, "sqlite://"), strings.HasPrefix(connString, "postgres://"), strings.HasPrefix(connString, "postgresql://"):
+		db, err := sqldb.Open(connString)
+		if err != nil {
+			return nil, err
+		}
+		return &sqlStore{db: db}, nil
+	case strings.HasPrefix(connString, "memory://"):
+		return NewMemoryStore(), nil
+	}
+	return nil, errors.New("no such database provider for " + connString)
+}
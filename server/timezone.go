@@ -0,0 +1,49 @@
+package server
+
+import (
+	"github.com/lukegb/irclogsme"
+	"net/url"
+	"sort"
+	"time"
+)
+
+// tzRequested is the zone the reader wants days split in (?tz=Europe/London), or nil for the
+// channel's own days
+func tzRequested(values url.Values) (*time.Location, error) {
+	tz := values.Get("tz")
+	if tz == "" {
+		return nil, nil
+	}
+	return irclogsme.LoadLocation(tz)
+}
+
+// dayBounds is [start, end) of a day in loc
+func dayBounds(splitDate string, loc *time.Location) (time.Time, time.Time, error) {
+	start, err := time.ParseInLocation("2006-01-02", splitDate, loc)
+	if err != nil {
+		return start, start, err
+	}
+	return start, start.AddDate(0, 0, 1), nil
+}
+
+// rebucketDates turns a channel's days, split in from, into the days in to which they overlap.
+// We only know which days have logs, not when in the day they were, so this can include a day
+// at either end which turns out to be empty.
+func rebucketDates(dates []string, from, to *time.Location) []string {
+	seen := make(map[string]bool)
+	res := make([]string, 0, len(dates))
+	for _, date := range dates {
+		start, end, err := dayBounds(date, from)
+		if err != nil {
+			continue
+		}
+		for _, d := range []string{irclogsme.SplitDate(start, to), irclogsme.SplitDate(end.Add(-time.Nanosecond), to)} {
+			if !seen[d] {
+				seen[d] = true
+				res = append(res, d)
+			}
+		}
+	}
+	sort.Strings(res)
+	return res
+}
@@ -0,0 +1,167 @@
+package server
+
+import (
+	"code.google.com/p/go.net/websocket"
+	"errors"
+	"github.com/lukegb/irclogsme"
+	"net/http"
+	"time"
+)
+
+// v1Json adapts a jsonResponsinator function to the router
+func v1Json(f func(r *http.Request, p params) (interface{}, int)) handlerFunc {
+	return func(w http.ResponseWriter, r *http.Request, p params) {
+		jsonResponsinator(func(r *http.Request) (interface{}, int) { return f(r, p) })(w, r)
+	}
+}
+
+// v1Channel finds the network and channel of /api/<network>/<channel>/..., in v1's words
+func v1Channel(store Store, p params) (irclogsme.NetworkConfig, string, int, error) {
+	network, err := networkOk(p["network"], store)
+	if err != nil {
+		return network, "", 500, err
+	}
+	channelName, ok := channelOk(p["channel"], network)
+	if !ok {
+		return network, "", 404, errors.New("not found")
+	}
+	return network, channelName, 200, nil
+}
+
+// v1Routes is the API as it's always been - /api/<network>/<channel>/<date>/ and so on, errors
+// as {"error": "..."}, any method. Don't change what it says: add to v2 instead.
+func v1Routes(store Store) *router {
+	notFound := v1Json(func(r *http.Request, p params) (interface{}, int) {
+		return errors.New("not found"), 404
+	})
+	rt := &router{
+		slashes:   true,
+		notFound:  notFound,
+		badMethod: func(w http.ResponseWriter, r *http.Request, allowed []string) { notFound(w, r, nil) },
+	}
+
+	rt.Any("/api/", v1Json(func(r *http.Request, p params) (interface{}, int) {
+		result, err := store.Networks()
+		if err != nil {
+			return err, 500
+		}
+
+		true_result := make([]Network, len(result))
+		for n, val := range result {
+			true_result[n] = networkMorph(val)
+		}
+		return true_result, 200
+	}))
+
+	rt.Any("/api/:network/", v1Json(func(r *http.Request, p params) (interface{}, int) {
+		result, err := networkOk(p["network"], store)
+		if err != nil {
+			return err, 500
+		}
+		return networkMorph(result), 200
+	}))
+
+	rt.Any("/api/:network/:channel/", v1Json(func(r *http.Request, p params) (interface{}, int) {
+		loc, err := tzRequested(r.URL.Query())
+		if err != nil {
+			return errors.New("bad tz"), 400
+		}
+		network, channelName, status, err := v1Channel(store, p)
+		if err != nil {
+			return err, status
+		}
+
+		res, err := channelMorph(network, channelName, loc, store)
+		if err != nil {
+			return err, 500
+		}
+		return res, 200
+	}))
+
+	rt.Any("/api/:network/:channel/ws/", func(w http.ResponseWriter, r *http.Request, p params) {
+		format := formatRequested(r.URL.Query())
+		if !validFormat(format) {
+			http.Error(w, "bad format", 400)
+			return
+		}
+		network, channelName, status, err := v1Channel(store, p)
+		if err != nil {
+			http.Error(w, err.Error(), status)
+			return
+		}
+
+		count, err := store.CountChannelLogs(network.Id, channelName)
+		if err != nil {
+			http.Error(w, err.Error(), 500)
+			return
+		} else if count == 0 {
+			http.Error(w, "not found", 404)
+			return
+		}
+
+		websocket.Handler(func(ws *websocket.Conn) { wsHandler(ws, network.Id, channelName, format, API_V1, store) }).ServeHTTP(w, r)
+	})
+
+	rt.Any("/api/:network/:channel/:date/", v1Json(func(r *http.Request, p params) (interface{}, int) {
+		format := formatRequested(r.URL.Query())
+		if !validFormat(format) {
+			return errors.New("bad format"), 400
+		}
+		loc, err := tzRequested(r.URL.Query())
+		if err != nil {
+			return errors.New("bad tz"), 400
+		}
+		network, channelName, status, err := v1Channel(store, p)
+		if err != nil {
+			return err, status
+		}
+
+		response, err := dayLogs(store, network, channelName, p["date"], format, loc, API_V1)
+		if err != nil {
+			return err, statusOf(err)
+		}
+		return response, 200
+	}))
+
+	return rt
+}
+
+// dayLogs is a day of a channel - the channel's day, or the reader's if loc isn't nil
+func dayLogs(store Store, network irclogsme.NetworkConfig, channelName string, logDate string, format string, loc *time.Location, version apiVersion) (*Logs, error) {
+	var qRes []irclogsme.LogMessage
+	var err error
+	if loc != nil {
+		// the reader's day, not the channel's
+		var start, end time.Time
+		if start, end, err = dayBounds(logDate, loc); err != nil {
+			return nil, errBadDate
+		}
+		qRes, err = store.LogsBetween(network.Id, channelName, start, end)
+	} else {
+		qRes, err = store.DayLogs(network.Id, channelName, logDate)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if len(qRes) == 0 {
+		return nil, notFound("no_logs", "not found")
+	}
+
+	res := make([]Log, len(qRes))
+	for k, v := range qRes {
+		if loc != nil {
+			v.Time = v.Time.In(loc)
+		}
+		res[k] = logMorph(v, format, version)
+	}
+
+	response := new(Logs)
+	response.Logs = res
+	fullChan, err := channelMorph(network, channelName, loc, store)
+	if err != nil {
+		return nil, err
+	}
+	response.Channel = *fullChan
+	return response, nil
+}
@@ -0,0 +1,207 @@
+package server
+
+import (
+	"code.google.com/p/go.net/websocket"
+	"encoding/json"
+	"github.com/lukegb/irclogsme"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+const V2_PREFIX = "/api/v2/"
+
+// V2Error is every v2 error. Code is one of a fixed set - network_not_found, bad_date and so
+// on - and doesn't change, unlike Error, which is for people.
+type V2Error struct {
+	Error string `json:"error"`
+	Code  string `json:"code"`
+}
+
+// v2Handler answers a v2 request with something to serve as JSON, or an error
+type v2Handler func(r *http.Request, p params) (interface{}, error)
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	body, err := json.Marshal(v)
+	if err != nil {
+		status = 500
+		body, _ = json.Marshal(V2Error{Error: "internal error", Code: "internal"})
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	w.Write(body)
+}
+
+func writeV2Error(w http.ResponseWriter, err error) {
+	apiErr := asApiError(err)
+	writeJSON(w, apiErr.Status, V2Error{Error: apiErr.Message, Code: apiErr.Code})
+}
+
+func v2Json(h v2Handler) handlerFunc {
+	return func(w http.ResponseWriter, r *http.Request, p params) {
+		resp, err := h(r, p)
+		if err != nil {
+			writeV2Error(w, err)
+			return
+		}
+		writeJSON(w, 200, resp)
+	}
+}
+
+// v2Network looks up :network
+func v2Network(store Store, p params) (irclogsme.NetworkConfig, error) {
+	network, err := store.Network(p["network"])
+	if isNotFound(err) {
+		return network, notFound("network_not_found", "no network %s", p["network"])
+	}
+	return network, err
+}
+
+// v2Channel looks up :network and :channel. Like v1, # is implied - foo is #foo, %23foo is ##foo.
+func v2Channel(store Store, p params) (irclogsme.NetworkConfig, string, error) {
+	network, err := v2Network(store, p)
+	if err != nil {
+		return network, "", err
+	}
+	channelName, ok := channelOk(p["channel"], network)
+	if !ok {
+		return network, "", notFound("channel_not_found", "%s has no channel %s", network.Name, channelName)
+	}
+	return network, channelName, nil
+}
+
+// v2ChannelJson is v2Json for the endpoints under a channel
+func v2ChannelJson(store Store, f func(r *http.Request, store Store, network irclogsme.NetworkConfig, channelName string) (interface{}, error)) handlerFunc {
+	return v2Json(func(r *http.Request, p params) (interface{}, error) {
+		network, channelName, err := v2Channel(store, p)
+		if err != nil {
+			return nil, err
+		}
+		return f(r, store, network, channelName)
+	})
+}
+
+// v2Days is where a channel's days are
+func v2Days(network irclogsme.NetworkConfig, channelSegment string) string {
+	return V2_PREFIX + "networks/" + url.PathEscape(network.Name) + "/channels/" + url.PathEscape(channelSegment) + "/days/"
+}
+
+type networksByName []Network
+
+func (n networksByName) Len() int           { return len(n) }
+func (n networksByName) Less(i, j int) bool { return n[i].Name < n[j].Name }
+func (n networksByName) Swap(i, j int)      { n[i], n[j] = n[j], n[i] }
+
+// v2Routes is /api/v2/networks/<network>/channels/<channel>/... Everything's GET, and errors
+// are V2Errors with a status to match.
+func v2Routes(store Store) *router {
+	rt := &router{
+		notFound: func(w http.ResponseWriter, r *http.Request, p params) {
+			writeV2Error(w, notFound("not_found", "no such endpoint"))
+		},
+		badMethod: func(w http.ResponseWriter, r *http.Request, allowed []string) {
+			writeV2Error(w, newApiError(405, "method_not_allowed", "%s isn't allowed here - use %s", r.Method, strings.Join(allowed, ", ")))
+		},
+	}
+
+	rt.Get(V2_PREFIX+"networks/", v2Json(func(r *http.Request, p params) (interface{}, error) {
+		nets, err := store.Networks()
+		if err != nil {
+			return nil, err
+		}
+		res := make([]Network, len(nets))
+		for n, net := range nets {
+			res[n] = networkMorph(net)
+		}
+		sort.Sort(networksByName(res))
+		return res, nil
+	}))
+
+	rt.Get(V2_PREFIX+"messages/:id/", v2Json(func(r *http.Request, p params) (interface{}, error) {
+		return permalink(r, store, p)
+	}))
+
+	rt.Get(V2_PREFIX+"networks/:network/", v2Json(func(r *http.Request, p params) (interface{}, error) {
+		network, err := v2Network(store, p)
+		if err != nil {
+			return nil, err
+		}
+		return networkMorph(network), nil
+	}))
+
+	rt.Get(V2_PREFIX+"networks/:network/channels/:channel/", v2Json(func(r *http.Request, p params) (interface{}, error) {
+		loc, err := tzRequested(r.URL.Query())
+		if err != nil {
+			return nil, errBadTz
+		}
+		network, channelName, err := v2Channel(store, p)
+		if err != nil {
+			return nil, err
+		}
+		return channelMorph(network, channelName, loc, store)
+	}))
+
+	rt.Get(V2_PREFIX+"networks/:network/channels/:channel/days/:date/", v2Json(func(r *http.Request, p params) (interface{}, error) {
+		format := formatRequested(r.URL.Query())
+		if !validFormat(format) {
+			return nil, errBadFormat
+		}
+		loc, err := tzRequested(r.URL.Query())
+		if err != nil {
+			return nil, errBadTz
+		}
+		if _, err := time.Parse("2006-01-02", p["date"]); err != nil {
+			return nil, errBadDate
+		}
+		network, channelName, err := v2Channel(store, p)
+		if err != nil {
+			return nil, err
+		}
+
+		res, err := dayLogs(store, network, channelName, p["date"], format, loc, API_V2)
+		if apiErr, ok := err.(*apiError); ok && apiErr.Code == "no_logs" {
+			return nil, notFound("no_logs", "%s has no logs on %s", channelName, p["date"])
+		}
+		return res, err
+	}))
+
+	rt.Get(V2_PREFIX+"networks/:network/channels/:channel/logs/", v2ChannelJson(store, pageChannel))
+	rt.Get(V2_PREFIX+"networks/:network/channels/:channel/range/", v2ChannelJson(store, rangeChannel))
+	rt.Get(V2_PREFIX+"networks/:network/channels/:channel/around/", v2ChannelJson(store, aroundChannel))
+
+	rt.Get(V2_PREFIX+"networks/:network/channels/:channel/search/", v2Json(func(r *http.Request, p params) (interface{}, error) {
+		network, channelName, err := v2Channel(store, p)
+		if err != nil {
+			return nil, err
+		}
+		return searchChannel(r, store, network, channelName, v2Days(network, p["channel"]))
+	}))
+
+	rt.Get(V2_PREFIX+"networks/:network/channels/:channel/export/", func(w http.ResponseWriter, r *http.Request, p params) {
+		network, channelName, err := v2Channel(store, p)
+		if err == nil {
+			err = exportChannel(w, r, store, network, channelName)
+		}
+		if err != nil {
+			writeV2Error(w, err)
+		}
+	})
+
+	rt.Get(V2_PREFIX+"networks/:network/channels/:channel/ws/", func(w http.ResponseWriter, r *http.Request, p params) {
+		format := formatRequested(r.URL.Query())
+		if !validFormat(format) {
+			writeV2Error(w, errBadFormat)
+			return
+		}
+		network, channelName, err := v2Channel(store, p)
+		if err != nil {
+			writeV2Error(w, err)
+			return
+		}
+		websocket.Handler(func(ws *websocket.Conn) { wsHandler(ws, network.Id, channelName, format, API_V2, store) }).ServeHTTP(w, r)
+	})
+
+	return rt
+}
@@ -0,0 +1,333 @@
+package sqldb
+
+import (
+	"database/sql"
+	"github.com/lukegb/irclogsme"
+	"labix.org/v2/mgo/bson"
+	"strings"
+	"time"
+)
+
+const RAW_LINE_PAGE = 1000
+
+const logColumns = `id, network_id, channel, time, split_date, nick, ident, host, account, msgid, reply_to, type, target, payload, raw_id`
+
+func scanLog(row scanner) (irclogsme.LogMessage, error) {
+	var msg irclogsme.LogMessage
+	var id, networkId string
+	var target, payload, rawId sql.NullString
+	err := row.Scan(&id, &networkId, &msg.Channel, &msg.Time, &msg.SplitDate, &msg.Nick, &msg.Ident, &msg.Host, &msg.Account, &msg.MsgId, &msg.ReplyTo, &msg.Type, &target, &payload, &rawId)
+	if err != nil {
+		return msg, err
+	}
+	msg.Id = objectId(id)
+	msg.NetworkId = objectId(networkId)
+	msg.Data = irclogsme.Payload{Version: irclogsme.PAYLOAD_VERSION, Text: payload.String, Target: target.String}
+	msg.RawId = objectId(rawId.String)
+	return msg, nil
+}
+
+func (db *DB) InsertLog(msg irclogsme.LogMessage) error {
+	if msg.Id == "" {
+		msg.Id = bson.NewObjectId()
+	}
+	_, err := db.exec(`INSERT INTO logs (`+logColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		msg.Id.Hex(), msg.NetworkId.Hex(), msg.Channel, utc(msg.Time), msg.SplitDate,
+		msg.Nick, msg.Ident, msg.Host, msg.Account, msg.MsgId, msg.ReplyTo,
+		msg.Type, nullableString(msg.Data.Target), nullableString(msg.Data.Text), nullableId(msg.RawId))
+	return err
+}
+
+func (db *DB) queryLogs(query string, args ...interface{}) ([]irclogsme.LogMessage, error) {
+	rows, err := db.query(`SELECT `+logColumns+` FROM logs WHERE `+query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	msgs := make([]irclogsme.LogMessage, 0)
+	for rows.Next() {
+		msg, err := scanLog(rows)
+		if err != nil {
+			return nil, err
+		}
+		msgs = append(msgs, msg)
+	}
+	return msgs, rows.Err()
+}
+
+// ChannelDates is every SplitDate which has logs in it
+func (db *DB) ChannelDates(networkId bson.ObjectId, channel string) ([]string, error) {
+	rows, err := db.query(`SELECT DISTINCT split_date FROM logs WHERE network_id = ? AND channel = ? ORDER BY split_date`, networkId.Hex(), channel)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	dates := make([]string, 0)
+	for rows.Next() {
+		var date string
+		if err := rows.Scan(&date); err != nil {
+			return nil, err
+		}
+		dates = append(dates, date)
+	}
+	return dates, rows.Err()
+}
+
+func (db *DB) DayLogs(networkId bson.ObjectId, channel string, splitDate string) ([]irclogsme.LogMessage, error) {
+	return db.queryLogs(`network_id = ? AND channel = ? AND split_date = ? ORDER BY time, id`, networkId.Hex(), channel, splitDate)
+}
+
+// LogsBetween is [from, to), oldest first
+func (db *DB) LogsBetween(networkId bson.ObjectId, channel string, from, to time.Time) ([]irclogsme.LogMessage, error) {
+	return db.queryLogs(`network_id = ? AND channel = ? AND time >= ? AND time < ? ORDER BY time, id`, networkId.Hex(), channel, utc(from), utc(to))
+}
+
+// LogsAfter is everything newer than t, for tailing a channel
+func (db *DB) LogsAfter(networkId bson.ObjectId, channel string, t time.Time) ([]irclogsme.LogMessage, error) {
+	return db.queryLogs(`network_id = ? AND channel = ? AND time > ? ORDER BY time, id`, networkId.Hex(), channel, utc(t))
+}
+
+// LogsFrom is up to limit messages after pos, oldest first - or before it, newest first, if
+// backwards
+func (db *DB) LogsFrom(networkId bson.ObjectId, channel string, pos irclogsme.Position, backwards bool, limit int) ([]irclogsme.LogMessage, error) {
+	query := `network_id = ? AND channel = ?`
+	args := []interface{}{networkId.Hex(), channel}
+	op, order := `>`, ` ORDER BY time, id`
+	if backwards {
+		op, order = `<`, ` ORDER BY time DESC, id DESC`
+	}
+	if !pos.IsZero() {
+		// no id is "", which is before every other
+		query += ` AND ((time = ? AND id ` + op + ` ?) OR time ` + op + ` ?)`
+		args = append(args, utc(pos.Time), pos.Id.Hex(), utc(pos.Time))
+	}
+	query += order + ` LIMIT ?`
+	args = append(args, limit)
+	return db.queryLogs(query, args...)
+}
+
+// SearchLogs ranks the messages matching f, best first and then newest first, and returns limit
+// of them after the first offset, along with how many matched altogether
+func (db *DB) SearchLogs(f irclogsme.SearchFilter, offset, limit int) ([]irclogsme.SearchMatch, int, error) {
+	// score is 0 unless there are words to rank by
+	from, score := `logs`, `0`
+	var scoreArgs []interface{}
+	query := `network_id = ? AND channel = ?`
+	args := []interface{}{f.NetworkId.Hex(), f.Channel}
+	if f.Text != "" {
+		// the index finds the words and ranks them, LIKE makes sure they're together as typed
+		if words := irclogsme.SearchWords(f.Text); len(words) > 0 {
+			// postgres splits the text up the same way it did the payload
+			if db.Dialect == DIALECT_POSTGRES {
+				score = `ts_rank(to_tsvector('simple', COALESCE(payload, '')), phraseto_tsquery('simple', ?))`
+				scoreArgs = append(scoreArgs, f.Text)
+				query += ` AND to_tsvector('simple', COALESCE(payload, '')) @@ phraseto_tsquery('simple', ?)`
+				args = append(args, f.Text)
+			} else {
+				// matchinfo only works in the query that did the MATCH
+				from = `logs JOIN (SELECT docid, bm25(matchinfo(logs_fts, 'pcnalx')) AS score FROM logs_fts WHERE logs_fts MATCH ?) fts ON fts.docid = logs.rowid`
+				score = `fts.score`
+				scoreArgs = append(scoreArgs, `"`+strings.Join(words, " ")+`"`)
+			}
+		}
+		query += ` AND LOWER(payload) LIKE ? ESCAPE '\'`
+		args = append(args, "%"+escapeLike(strings.ToLower(f.Text))+"%")
+	}
+	if f.Regex != nil {
+		if db.Dialect == DIALECT_POSTGRES {
+			query += ` AND COALESCE(payload, '') ~ ?`
+		} else {
+			query += ` AND COALESCE(payload, '') REGEXP ?`
+		}
+		args = append(args, f.Regex.String())
+	}
+	if f.Nick != "" {
+		query += ` AND LOWER(nick) = ?`
+		args = append(args, strings.ToLower(f.Nick))
+	}
+	if len(f.Types) > 0 {
+		query += ` AND type IN (?` + strings.Repeat(`, ?`, len(f.Types)-1) + `)`
+		for _, t := range f.Types {
+			args = append(args, t)
+		}
+	}
+	if !f.From.IsZero() {
+		query += ` AND time >= ?`
+		args = append(args, utc(f.From))
+	}
+	if !f.To.IsZero() {
+		query += ` AND time < ?`
+		args = append(args, utc(f.To))
+	}
+
+	// sqlite's join has its argument before the rest, postgres's score is in the SELECT - either
+	// way it comes first
+	var total int
+	countArgs := append(args[:0:0], args...)
+	if from != `logs` {
+		countArgs = append(scoreArgs, countArgs...)
+	}
+	if err := db.queryRow(`SELECT COUNT(*) FROM `+from+` WHERE `+query, countArgs...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	rows, err := db.query(`SELECT `+logColumns+`, `+score+` AS score FROM `+from+` WHERE `+query+` ORDER BY score DESC, time DESC, id DESC LIMIT ? OFFSET ?`,
+		append(append(scoreArgs, args...), limit, offset)...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	matches := make([]irclogsme.SearchMatch, 0)
+	for rows.Next() {
+		var match irclogsme.SearchMatch
+		if match.LogMessage, err = scanLog(scoredRow{rows, &match.Score}); err != nil {
+			return nil, 0, err
+		}
+		matches = append(matches, match)
+	}
+	return matches, total, rows.Err()
+}
+
+// scoredRow is a row of logColumns with a score on the end
+type scoredRow struct {
+	row   scanner
+	score *float64
+}
+
+func (s scoredRow) Scan(dest ...interface{}) error {
+	return s.row.Scan(append(dest, s.score)...)
+}
+
+func (db *DB) CountChannelLogs(networkId bson.ObjectId, channel string) (int, error) {
+	var count int
+	err := db.queryRow(`SELECT COUNT(*) FROM logs WHERE network_id = ? AND channel = ?`, networkId.Hex(), channel).Scan(&count)
+	return count, err
+}
+
+// Log fetches one message by id; ok is false if there's no such message
+func (db *DB) Log(id bson.ObjectId) (irclogsme.LogMessage, bool, error) {
+	msg, err := scanLog(db.queryRow(`SELECT `+logColumns+` FROM logs WHERE id = ?`, id.Hex()))
+	if err == sql.ErrNoRows {
+		return msg, false, nil
+	}
+	return msg, err == nil, err
+}
+
+// ExpiredDays is every SplitDate before cutoff which has logs in it
+func (db *DB) ExpiredDays(networkId bson.ObjectId, channel string, cutoff string) ([]string, error) {
+	rows, err := db.query(`SELECT DISTINCT split_date FROM logs WHERE network_id = ? AND channel = ? AND split_date < ? ORDER BY split_date`, networkId.Hex(), channel, cutoff)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	dates := make([]string, 0)
+	for rows.Next() {
+		var date string
+		if err := rows.Scan(&date); err != nil {
+			return nil, err
+		}
+		dates = append(dates, date)
+	}
+	return dates, rows.Err()
+}
+
+func (db *DB) DeleteDay(networkId bson.ObjectId, channel string, splitDate string) error {
+	_, err := db.exec(`DELETE FROM logs WHERE network_id = ? AND channel = ? AND split_date = ?`, networkId.Hex(), channel, splitDate)
+	return err
+}
+
+func (db *DB) InsertRawLine(line irclogsme.RawLine) error {
+	if line.Id == "" {
+		line.Id = bson.NewObjectId()
+	}
+	_, err := db.exec(`INSERT INTO raw_lines (id, network_id, time, command, line) VALUES (?, ?, ?, ?, ?)`,
+		line.Id.Hex(), line.NetworkId.Hex(), utc(line.Time), line.Command, line.Line)
+	return err
+}
+
+// LastRawCommandBefore returns the zero time if there's no such line
+func (db *DB) LastRawCommandBefore(networkId bson.ObjectId, command string, before time.Time) (time.Time, error) {
+	var t time.Time
+	err := db.queryRow(`SELECT time FROM raw_lines WHERE network_id = ? AND command = ? AND time < ? ORDER BY time DESC LIMIT 1`, networkId.Hex(), command, utc(before)).Scan(&t)
+	if err == sql.ErrNoRows {
+		return time.Time{}, nil
+	}
+	return t, err
+}
+
+// EachRawLine calls f for each line in [from, to), oldest first. Lines are fetched a page at a
+// time with nothing held open while f runs, so f is free to write to the database.
+func (db *DB) EachRawLine(networkId bson.ObjectId, from, to time.Time, f func(irclogsme.RawLine) error) error {
+	lastTime, lastId := utc(from), ""
+	for {
+		rows, err := db.query(`SELECT id, network_id, time, command, line FROM raw_lines WHERE network_id = ? AND ((time = ? AND id > ?) OR time > ?) AND time < ? ORDER BY time, id LIMIT ?`,
+			networkId.Hex(), lastTime, lastId, lastTime, utc(to), RAW_LINE_PAGE)
+		if err != nil {
+			return err
+		}
+
+		page := make([]irclogsme.RawLine, 0, RAW_LINE_PAGE)
+		for rows.Next() {
+			var line irclogsme.RawLine
+			var id, netId string
+			if err := rows.Scan(&id, &netId, &line.Time, &line.Command, &line.Line); err != nil {
+				rows.Close()
+				return err
+			}
+			line.Id = objectId(id)
+			line.NetworkId = objectId(netId)
+			page = append(page, line)
+			lastTime, lastId = utc(line.Time), id
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		for _, line := range page {
+			if err := f(line); err != nil {
+				return err
+			}
+		}
+		if len(page) < RAW_LINE_PAGE {
+			return nil
+		}
+	}
+}
+
+// RawLogIds is the ids of the messages in [from, to) which came from archived lines
+func (db *DB) RawLogIds(networkId bson.ObjectId, from, to time.Time) ([]bson.ObjectId, error) {
+	rows, err := db.query(`SELECT id FROM logs WHERE network_id = ? AND time >= ? AND time < ? AND raw_id IS NOT NULL`, networkId.Hex(), utc(from), utc(to))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := make([]bson.ObjectId, 0)
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, objectId(id))
+	}
+	return ids, rows.Err()
+}
+
+// DeleteLogs removes messages by id - keep it to a few hundred at a time, SQLite has a limit
+// on how many ?s a statement can have
+func (db *DB) DeleteLogs(ids []bson.ObjectId) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	args := make([]interface{}, len(ids))
+	for i, id := range ids {
+		args[i] = id.Hex()
+	}
+	_, err := db.exec(`DELETE FROM logs WHERE id IN (?`+strings.Repeat(`, ?`, len(ids)-1)+`)`, args...)
+	return err
+}
@@ -0,0 +1,171 @@
+package sqldb
+
+import (
+	"database/sql"
+	"github.com/lukegb/irclogsme"
+	"labix.org/v2/mgo/bson"
+)
+
+const networkColumns = `id, name, friendly_name, nick, user_name, enabled, irc_servers, auth_commands, case_mapping, chan_types, archive_raw_lines, retention_days, retention_archive, timezone`
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanNetwork(row scanner) (irclogsme.NetworkConfig, error) {
+	var net irclogsme.NetworkConfig
+	var id, ircServers, authCommands string
+	err := row.Scan(&id, &net.Name, &net.FriendlyName, &net.Nick, &net.User, &net.Enabled, &ircServers, &authCommands, &net.CaseMapping, &net.ChanTypes, &net.ArchiveRawLines, &net.Retention.Days, &net.Retention.Archive, &net.Timezone)
+	if err != nil {
+		return net, err
+	}
+	net.Id = objectId(id)
+	net.IrcServers = decodeList(ircServers)
+	net.AuthCommands = decodeList(authCommands)
+	net.Channels = make(map[string]irclogsme.ChannelConfig)
+	return net, nil
+}
+
+func (db *DB) loadChannels(net *irclogsme.NetworkConfig) error {
+	rows, err := db.query(`SELECT name, channel_key, retention_days, retention_archive, timezone, disabled FROM channels WHERE network_id = ?`, net.Id.Hex())
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var name string
+		var conf irclogsme.ChannelConfig
+		var retentionDays sql.NullInt64
+		var retentionArchive bool
+		if err := rows.Scan(&name, &conf.Key, &retentionDays, &retentionArchive, &conf.Timezone, &conf.Disabled); err != nil {
+			return err
+		}
+		if retentionDays.Valid {
+			conf.Retention = &irclogsme.RetentionPolicy{Days: int(retentionDays.Int64), Archive: retentionArchive}
+		}
+		net.Channels[name] = conf
+	}
+	return rows.Err()
+}
+
+// Networks returns every network with its channels
+func (db *DB) Networks() ([]irclogsme.NetworkConfig, error) {
+	rows, err := db.query(`SELECT ` + networkColumns + ` FROM networks ORDER BY name`)
+	if err != nil {
+		return nil, err
+	}
+	nets := make([]irclogsme.NetworkConfig, 0)
+	for rows.Next() {
+		net, err := scanNetwork(rows)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		nets = append(nets, net)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for i := range nets {
+		if err := db.loadChannels(&nets[i]); err != nil {
+			return nil, err
+		}
+	}
+	return nets, nil
+}
+
+// Network looks one network up by name; ok is false if there's no such network
+func (db *DB) Network(name string) (irclogsme.NetworkConfig, bool, error) {
+	net, err := scanNetwork(db.queryRow(`SELECT `+networkColumns+` FROM networks WHERE name = ?`, name))
+	if err == sql.ErrNoRows {
+		return net, false, nil
+	} else if err != nil {
+		return net, false, err
+	}
+	if err := db.loadChannels(&net); err != nil {
+		return net, false, err
+	}
+	return net, true, nil
+}
+
+func (db *DB) PendingCommands() ([]irclogsme.CommandMessage, error) {
+	rows, err := db.query(`SELECT id, network_id, type, channel, channel_key, target, message, complete FROM command_queue WHERE complete = ?`, false)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	cmds := make([]irclogsme.CommandMessage, 0)
+	for rows.Next() {
+		var cmd irclogsme.CommandMessage
+		var id, networkId string
+		if err := rows.Scan(&id, &networkId, &cmd.Type, &cmd.Channel, &cmd.Key, &cmd.Target, &cmd.Message, &cmd.Complete); err != nil {
+			return nil, err
+		}
+		cmd.Id = objectId(id)
+		cmd.NetworkId = objectId(networkId)
+		cmds = append(cmds, cmd)
+	}
+	return cmds, rows.Err()
+}
+
+func (db *DB) CommandComplete(id bson.ObjectId) error {
+	_, err := db.exec(`UPDATE command_queue SET complete = ? WHERE id = ?`, true, id.Hex())
+	return err
+}
+
+// SaveNetwork adds a network, giving it an id, or replaces the one with the same id - channels
+// and all
+func (db *DB) SaveNetwork(net irclogsme.NetworkConfig) (irclogsme.NetworkConfig, error) {
+	adding := net.Id == ""
+	if adding {
+		net.Id = bson.NewObjectId()
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return net, err
+	}
+	exec := func(query string, args ...interface{}) error {
+		_, err := tx.Exec(db.Rebind(query), args...)
+		return err
+	}
+
+	values := []interface{}{net.Name, net.FriendlyName, net.Nick, net.User, net.Enabled, encodeList(net.IrcServers), encodeList(net.AuthCommands), net.CaseMapping, net.ChanTypes, net.ArchiveRawLines, net.Retention.Days, net.Retention.Archive, net.Timezone, net.Id.Hex()}
+	if adding {
+		err = exec(`INSERT INTO networks (name, friendly_name, nick, user_name, enabled, irc_servers, auth_commands, case_mapping, chan_types, archive_raw_lines, retention_days, retention_archive, timezone, id) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`, values...)
+	} else {
+		err = exec(`UPDATE networks SET name = ?, friendly_name = ?, nick = ?, user_name = ?, enabled = ?, irc_servers = ?, auth_commands = ?, case_mapping = ?, chan_types = ?, archive_raw_lines = ?, retention_days = ?, retention_archive = ?, timezone = ? WHERE id = ?`, values...)
+	}
+	if err == nil {
+		err = exec(`DELETE FROM channels WHERE network_id = ?`, net.Id.Hex())
+	}
+	for name, conf := range net.Channels {
+		if err != nil {
+			break
+		}
+		var retentionDays interface{}
+		var retentionArchive bool
+		if conf.Retention != nil {
+			retentionDays, retentionArchive = conf.Retention.Days, conf.Retention.Archive
+		}
+		err = exec(`INSERT INTO channels (network_id, name, channel_key, retention_days, retention_archive, timezone, disabled) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+			net.Id.Hex(), name, conf.Key, retentionDays, retentionArchive, conf.Timezone, conf.Disabled)
+	}
+	if err != nil {
+		tx.Rollback()
+		return net, err
+	}
+	return net, tx.Commit()
+}
+
+func (db *DB) InsertCommand(cmd irclogsme.CommandMessage) (irclogsme.CommandMessage, error) {
+	if cmd.Id == "" {
+		cmd.Id = bson.NewObjectId()
+	}
+	_, err := db.exec(`INSERT INTO command_queue (id, network_id, type, channel, channel_key, target, message, complete) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		cmd.Id.Hex(), cmd.NetworkId.Hex(), cmd.Type, cmd.Channel, cmd.Key, cmd.Target, cmd.Message, cmd.Complete)
+	return cmd, err
+}
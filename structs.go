@@ -15,6 +15,7 @@ const (
 	LMT_KICK
 	LMT_QUIT
 	LMT_ACTION
+	LMT_NICK
 )
 
 const (
@@ -46,6 +47,8 @@ func (l LogMessageType) String() string {
 		return "QUIT"
 	case LMT_ACTION:
 		return "ACTION"
+	case LMT_NICK:
+		return "NICK"
 	}
 	return fmt.Sprintf("[unknown %d]", l)
 }
@@ -79,10 +82,32 @@ type LogMessage struct {
 	Ident string
 	Host  string
 
+	// from IRCv3 tags, where the network supports them
+	Account string `bson:",omitempty"`
+	MsgId   string `bson:",omitempty"`
+	ReplyTo string `bson:",omitempty"`
+
 	Type LogMessageType
 
-	Target  interface{}
-	Payload interface{}
+	Data Payload
+
+	// how target and payload were kept before Payload existed - only ever read, and only until
+	// the migration to Payload has run. See Upgrade.
+	LegacyTarget  interface{} `bson:"target,omitempty" json:"-"`
+	LegacyPayload interface{} `bson:"payload,omitempty" json:"-"`
+
+	// the archived line this came from, if raw archiving is on
+	RawId bson.ObjectId `bson:",omitempty"`
+}
+
+// RawLine is a line exactly as the network sent it, kept so we can parse it again
+type RawLine struct {
+	Id bson.ObjectId `bson:"_id,omitempty"`
+
+	NetworkId bson.ObjectId
+	Time      time.Time
+	Command   string
+	Line      string
 }
 
 type CommandMessage struct {
@@ -91,12 +116,31 @@ type CommandMessage struct {
 	NetworkId bson.ObjectId
 	Type      CommandMessageType
 	Channel   string
+	Key       string `bson:",omitempty"`
 	Target    string
 	Message   string
 	Complete  bool
 }
 
 type ChannelConfig struct {
+	Key string `bson:",omitempty"`
+
+	// overrides the network's policy if set
+	Retention *RetentionPolicy `bson:",omitempty"`
+
+	// overrides the network's timezone if set
+	Timezone string `bson:",omitempty"`
+
+	// still configured, and its logs still served, but not joined
+	Disabled bool `bson:",omitempty"`
+}
+
+// RetentionPolicy says how long logs stay in the database. The zero value keeps them forever.
+type RetentionPolicy struct {
+	Days int `bson:",omitempty"`
+
+	// move expired days into archive files instead of just deleting them
+	Archive bool `bson:",omitempty"`
 }
 
 type NetworkConfig struct {
@@ -113,7 +157,21 @@ type NetworkConfig struct {
 
 	IrcServers []string
 
+	// overridden by the network's ISUPPORT once connected
+	CaseMapping string `bson:",omitempty"`
+	ChanTypes   string `bson:",omitempty"`
+
 	AuthCommands []string
+
+	// keep every line we handle so logs can be rebuilt later
+	ArchiveRawLines bool `bson:",omitempty"`
+
+	// for channels which don't have their own
+	Retention RetentionPolicy `bson:",omitempty"`
+
+	// IANA name of the zone days are split in, for channels which don't have their own - the
+	// logger's local zone if unset
+	Timezone string `bson:",omitempty"`
 }
 
 type Config struct {
@@ -0,0 +1,119 @@
+// Package textformat writes messages the way other clients log them, for flat file logs and
+// exports.
+package textformat
+
+import (
+	"fmt"
+	"github.com/lukegb/irclogsme"
+	"time"
+)
+
+// the line formats we know how to write
+const (
+	IRSSI   = "irssi"
+	WEECHAT = "weechat"
+	ZNC     = "znc"
+)
+
+// Format renders messages the way some other client would have logged them
+type Format struct {
+	// Opened is written at the top of each new file, if it's not nil
+	Opened func(t time.Time) string
+	Line   func(msg irclogsme.LogMessage) string
+}
+
+var FORMATS = map[string]Format{
+	IRSSI:   {Opened: irssiOpened, Line: irssiLine},
+	WEECHAT: {Line: weechatLine},
+	ZNC:     {Line: zncLine},
+}
+
+// bracketed is " [reason]" or "" - irssi and friends leave the brackets off empty reasons
+func bracketed(open, s, close string) string {
+	if s == "" {
+		return ""
+	}
+	return " " + open + s + close
+}
+
+func irssiOpened(t time.Time) string {
+	return "--- Log opened " + t.Format("Mon Jan 02 15:04:05 2006")
+}
+
+func irssiLine(msg irclogsme.LogMessage) string {
+	ts := msg.Time.Format("15:04")
+	payload := msg.Data.Text
+	switch msg.Type {
+	case irclogsme.LMT_PRIVMSG:
+		return fmt.Sprintf("%s <%s> %s", ts, msg.Nick, payload)
+	case irclogsme.LMT_NOTICE:
+		return fmt.Sprintf("%s -%s:%s- %s", ts, msg.Nick, msg.Channel, payload)
+	case irclogsme.LMT_ACTION:
+		return fmt.Sprintf("%s  * %s %s", ts, msg.Nick, payload)
+	case irclogsme.LMT_JOIN:
+		return fmt.Sprintf("%s -!- %s [%s@%s] has joined %s", ts, msg.Nick, msg.Ident, msg.Host, msg.Channel)
+	case irclogsme.LMT_PART:
+		return fmt.Sprintf("%s -!- %s [%s@%s] has left %s [%s]", ts, msg.Nick, msg.Ident, msg.Host, msg.Channel, payload)
+	case irclogsme.LMT_QUIT:
+		return fmt.Sprintf("%s -!- %s [%s@%s] has quit [%s]", ts, msg.Nick, msg.Ident, msg.Host, payload)
+	case irclogsme.LMT_KICK:
+		return fmt.Sprintf("%s -!- %s was kicked from %s by %s [%s]", ts, msg.Data.Target, msg.Channel, msg.Nick, payload)
+	case irclogsme.LMT_TOPIC:
+		return fmt.Sprintf("%s -!- %s changed the topic of %s to: %s", ts, msg.Nick, msg.Channel, payload)
+	case irclogsme.LMT_NICK:
+		return fmt.Sprintf("%s -!- %s is now known as %s", ts, msg.Nick, payload)
+	}
+	return fmt.Sprintf("%s -!- [%s] %s", ts, msg.Type, payload)
+}
+
+func weechatLine(msg irclogsme.LogMessage) string {
+	ts := msg.Time.Format("2006-01-02 15:04:05")
+	payload := msg.Data.Text
+	switch msg.Type {
+	case irclogsme.LMT_PRIVMSG:
+		return fmt.Sprintf("%s\t%s\t%s", ts, msg.Nick, payload)
+	case irclogsme.LMT_NOTICE:
+		return fmt.Sprintf("%s\t--\tNotice(%s) -> %s: %s", ts, msg.Nick, msg.Channel, payload)
+	case irclogsme.LMT_ACTION:
+		return fmt.Sprintf("%s\t *\t%s %s", ts, msg.Nick, payload)
+	case irclogsme.LMT_JOIN:
+		return fmt.Sprintf("%s\t-->\t%s (%s@%s) has joined %s", ts, msg.Nick, msg.Ident, msg.Host, msg.Channel)
+	case irclogsme.LMT_PART:
+		return fmt.Sprintf("%s\t<--\t%s (%s@%s) has left %s%s", ts, msg.Nick, msg.Ident, msg.Host, msg.Channel, bracketed("(", payload, ")"))
+	case irclogsme.LMT_QUIT:
+		return fmt.Sprintf("%s\t<--\t%s (%s@%s) has quit%s", ts, msg.Nick, msg.Ident, msg.Host, bracketed("(", payload, ")"))
+	case irclogsme.LMT_KICK:
+		return fmt.Sprintf("%s\t<--\t%s has kicked %s%s", ts, msg.Nick, msg.Data.Target, bracketed("(", payload, ")"))
+	case irclogsme.LMT_TOPIC:
+		return fmt.Sprintf("%s\t--\t%s has changed topic for %s to \"%s\"", ts, msg.Nick, msg.Channel, payload)
+	case irclogsme.LMT_NICK:
+		return fmt.Sprintf("%s\t--\t%s is now known as %s", ts, msg.Nick, payload)
+	}
+	return fmt.Sprintf("%s\t--\t[%s] %s", ts, msg.Type, payload)
+}
+
+func zncLine(msg irclogsme.LogMessage) string {
+	ts := msg.Time.Format("[15:04:05]")
+	payload := msg.Data.Text
+	switch msg.Type {
+	case irclogsme.LMT_PRIVMSG:
+		return fmt.Sprintf("%s <%s> %s", ts, msg.Nick, payload)
+	case irclogsme.LMT_NOTICE:
+		return fmt.Sprintf("%s -%s- %s", ts, msg.Nick, payload)
+	case irclogsme.LMT_ACTION:
+		return fmt.Sprintf("%s * %s %s", ts, msg.Nick, payload)
+	case irclogsme.LMT_JOIN:
+		return fmt.Sprintf("%s *** Joins: %s (%s@%s)", ts, msg.Nick, msg.Ident, msg.Host)
+	case irclogsme.LMT_PART:
+		return fmt.Sprintf("%s *** Parts: %s (%s@%s) (%s)", ts, msg.Nick, msg.Ident, msg.Host, payload)
+	case irclogsme.LMT_QUIT:
+		return fmt.Sprintf("%s *** Quits: %s (%s@%s) (%s)", ts, msg.Nick, msg.Ident, msg.Host, payload)
+	case irclogsme.LMT_KICK:
+		return fmt.Sprintf("%s *** %s was kicked by %s (%s)", ts, msg.Data.Target, msg.Nick, payload)
+	case irclogsme.LMT_TOPIC:
+		return fmt.Sprintf("%s *** %s changes topic to '%s'", ts, msg.Nick, payload)
+	case irclogsme.LMT_NICK:
+		return fmt.Sprintf("%s *** %s is now known as %s", ts, msg.Nick, payload)
+	}
+	return fmt.Sprintf("%s *** [%s] %s", ts, msg.Type, payload)
+}
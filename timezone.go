@@ -0,0 +1,77 @@
+package irclogsme
+
+import (
+	"sync"
+	"time"
+)
+
+// days have always been split wherever the logger runs, so that's still what you get unless you say
+const DEFAULT_TIMEZONE = "Local"
+
+var (
+	locationsLock sync.Mutex
+	locations     = make(map[string]*time.Location)
+)
+
+// LoadLocation is time.LoadLocation, but remembers what it's loaded - we need one per message
+func LoadLocation(name string) (*time.Location, error) {
+	locationsLock.Lock()
+	defer locationsLock.Unlock()
+
+	if loc, ok := locations[name]; ok {
+		return loc, nil
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, err
+	}
+	locations[name] = loc
+	return loc, nil
+}
+
+// SplitDate is the day t falls on in loc, which is what logs are grouped by
+func SplitDate(t time.Time, loc *time.Location) string {
+	return t.In(loc).Format("2006-01-02")
+}
+
+// TimezoneFor is the name of the zone a channel's days are split in
+func (n NetworkConfig) TimezoneFor(channel string) string {
+	casemapping := n.ChannelCaseMapping()
+	folded := FoldName(casemapping, channel)
+	for name, conf := range n.Channels {
+		if FoldName(casemapping, name) == folded && conf.Timezone != "" {
+			return conf.Timezone
+		}
+	}
+	if n.Timezone != "" {
+		return n.Timezone
+	}
+	return DEFAULT_TIMEZONE
+}
+
+// LocationFor is TimezoneFor loaded, falling back to UTC if the zone doesn't exist -
+// CheckTimezones is how you find out about that
+func (n NetworkConfig) LocationFor(channel string) *time.Location {
+	loc, err := LoadLocation(n.TimezoneFor(channel))
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+// CheckTimezones makes sure every zone the network mentions exists
+func (n NetworkConfig) CheckTimezones() error {
+	if n.Timezone != "" {
+		if _, err := LoadLocation(n.Timezone); err != nil {
+			return err
+		}
+	}
+	for _, conf := range n.Channels {
+		if conf.Timezone != "" {
+			if _, err := LoadLocation(conf.Timezone); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}